@@ -0,0 +1,164 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/pflag"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db/postgresql"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/diff"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/metrics"
+)
+
+const (
+	exitCodeNoChanges   = 0
+	exitCodeChanges     = 1
+	exitCodeFailed      = 2
+	outputFormatText    = "text"
+	outputFormatJSON    = "json"
+	defaultDirPath      = "."
+	defaultTimeout      = 30 * time.Second
+	usageMessagePattern = `usage: %s [flags] [dir]
+
+prints the managed cluster label changes that syncing the non-k8s gitops objects in the files of dir (defaults to the
+current directory, e.g. the root of a git repo checkout) would apply, compared to the labels in the database. the
+database is configured by the DATABASE_URL environment variable and is only read. identifiers with a hub name pattern
+or a managed cluster selector are resolved against the status of the managed clusters in the database. exits with 1 if
+there are changes.
+
+flags:
+`
+)
+
+// function to handle defers with exit, see https://stackoverflow.com/a/27629493/553720.
+func doMain() int {
+	flagSet := pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(os.Stderr, usageMessagePattern, os.Args[0])
+		flagSet.PrintDefaults()
+	}
+
+	gitPath := flagSet.String("git-path", "",
+		"the path (relative to dir) to load objects from, as the subscription's git-path annotation")
+	recursive := flagSet.Bool("recursive", false,
+		"load files in nested directories of the git-path, as the subscription's gitops-recursive annotation")
+	includePatterns := flagSet.StringSlice("include", nil,
+		"glob patterns of files to load, as the subscription's gitops-include annotation")
+	excludePatterns := flagSet.StringSlice("exclude", nil,
+		"glob patterns of files not to load, as the subscription's gitops-exclude annotation")
+	outputFormat := flagSet.StringP("output", "o", outputFormatText,
+		fmt.Sprintf("the format of the diff (%s / %s)", outputFormatText, outputFormatJSON))
+	timeout := flagSet.Duration("timeout", defaultTimeout, "the timeout of reading the labels from the database")
+
+	if err := flagSet.Parse(os.Args[1:]); err != nil {
+		return exitCodeFailed
+	}
+
+	if flagSet.NArg() > 1 || (*outputFormat != outputFormatText && *outputFormat != outputFormatJSON) {
+		flagSet.Usage()
+		return exitCodeFailed
+	}
+
+	dirPath := defaultDirPath
+	if flagSet.NArg() == 1 {
+		dirPath = flagSet.Arg(0)
+	}
+
+	// metrics of the db layer are not exposed
+	gitOpsMetrics, err := metrics.NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitCodeFailed
+	}
+
+	postgreSQL, err := postgresql.NewPostgreSQL(gitOpsMetrics)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitCodeFailed
+	}
+
+	defer postgreSQL.Stop()
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), *timeout)
+	defer cancelFunc()
+
+	labelsDiff, err := diff.GetDiff(ctx, postgreSQL, postgreSQL, dirPath, &dbsyncer.WorkPath{
+		Path:            *gitPath,
+		Recursive:       *recursive,
+		IncludePatterns: *includePatterns,
+		ExcludePatterns: *excludePatterns,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitCodeFailed
+	}
+
+	if err := printDiff(labelsDiff, *outputFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitCodeFailed
+	}
+
+	if len(labelsDiff.Hubs) != 0 {
+		return exitCodeChanges
+	}
+
+	return exitCodeNoChanges
+}
+
+// printDiff prints the diff to stdout in the given format.
+func printDiff(labelsDiff *diff.Diff, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		diffBytes, err := json.MarshalIndent(labelsDiff, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal diff - %w", err)
+		}
+
+		fmt.Println(string(diffBytes))
+
+		return nil
+	}
+
+	for _, hubDiff := range labelsDiff.Hubs {
+		fmt.Printf("hub %s:\n", hubDiff.Name)
+
+		for _, managedClusterDiff := range hubDiff.ManagedClusters {
+			fmt.Printf("  managed cluster %s:\n", managedClusterDiff.Name)
+
+			for _, labelChange := range managedClusterDiff.LabelChanges {
+				fmt.Printf("    %s\n", formatLabelChange(labelChange))
+			}
+		}
+	}
+
+	return nil
+}
+
+// formatLabelChange returns a diff-like line of a label change, e.g. "+ key=value (kind/name)".
+func formatLabelChange(labelChange *diff.LabelChange) string {
+	object := labelChange.Object
+	if object == "" {
+		object = "label key is not allowed"
+	}
+
+	switch labelChange.Operation {
+	case diff.LabelOperationAdd:
+		return fmt.Sprintf("+ %s=%s (%s)", labelChange.Key, labelChange.Value, object)
+	case diff.LabelOperationUpdate:
+		return fmt.Sprintf("~ %s=%s -> %s (%s)", labelChange.Key, labelChange.CurrentValue, labelChange.Value,
+			object)
+	default:
+		return fmt.Sprintf("- %s=%s (%s)", labelChange.Key, labelChange.CurrentValue, object)
+	}
+}
+
+func main() {
+	os.Exit(doMain())
+}
@@ -4,9 +4,12 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"runtime"
 	"time"
@@ -19,20 +22,39 @@ import (
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db/postgresql"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/metrics"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/tracing"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 const (
-	metricsHost                     = "0.0.0.0"
-	metricsPort               int32 = 8965
-	envVarControllerNamespace       = "POD_NAMESPACE"
-	envVarSyncInterval              = "SYNC_INTERVAL"
-	envVarGitStorageDirPath         = "SUBSCRIPTION_GIT_STORAGE_DIR_PATH"
-	leaderElectionLockName          = "hub-of-hubs-gitops-lock"
+	metricsHost                             = "0.0.0.0"
+	metricsPort                       int32 = 8965
+	healthProbePort                   int32 = 8966
+	envVarControllerNamespace               = "POD_NAMESPACE"
+	envVarSyncInterval                      = "SYNC_INTERVAL"
+	envVarGitStorageDirPath                 = "SUBSCRIPTION_GIT_STORAGE_DIR_PATH"
+	envVarSyncLivenessWindow                = "SYNC_LIVENESS_WINDOW"
+	defaultSyncLivenessWindow               = 10 * time.Minute
+	envVarDriftDetectionMode                = "DRIFT_DETECTION_MODE"
+	envVarDriftDetectionInterval            = "DRIFT_DETECTION_INTERVAL"
+	defaultDriftDetectionInterval           = 5 * time.Minute
+	envVarDynamicIdentifiersInterval        = "DYNAMIC_IDENTIFIERS_INTERVAL"
+	defaultDynamicIdentifiersInterval       = time.Duration(0)
+	readinessCheckTimeout                   = 5 * time.Second
+	leaderElectionLockName                  = "hub-of-hubs-gitops-lock"
+	planModeFlagName                        = "plan-mode"
 )
 
-var errEnvVarNotFound = errors.New("environment variable not found")
+var (
+	errEnvVarNotFound            = errors.New("environment variable not found")
+	errInvalidDriftDetectionMode = errors.New("invalid drift detection mode")
+	errNonPositiveDuration       = errors.New("duration must be positive")
+	errNegativeDuration          = errors.New("duration must not be negative")
+)
 
 func printVersion(log logr.Logger) {
 	log.Info(fmt.Sprintf("Go Version: %s", runtime.Version()))
@@ -73,10 +95,86 @@ func getGitStorageDir() (string, error) {
 	return gitStorageDirPath, nil
 }
 
+// getSyncLivenessWindow returns the max duration allowed between completed sync cycles, defaults to 10 minutes.
+func getSyncLivenessWindow() (time.Duration, error) {
+	syncLivenessWindowString, found := os.LookupEnv(envVarSyncLivenessWindow)
+	if !found {
+		return defaultSyncLivenessWindow, nil
+	}
+
+	syncLivenessWindow, err := time.ParseDuration(syncLivenessWindowString)
+	if err != nil {
+		return 0, fmt.Errorf("the environment var %s is not a valid duration - %w",
+			envVarSyncLivenessWindow, err)
+	}
+
+	return syncLivenessWindow, nil
+}
+
+// getDriftDetectionConfig returns the drift detection mode and interval. the drift detection is disabled by default,
+// and the interval defaults to 5 minutes.
+func getDriftDetectionConfig() (string, time.Duration, error) {
+	driftDetectionMode, found := os.LookupEnv(envVarDriftDetectionMode)
+	if !found {
+		driftDetectionMode = controller.DriftDetectionModeDisabled
+	}
+
+	switch driftDetectionMode {
+	case controller.DriftDetectionModeDisabled, controller.DriftDetectionModeReport,
+		controller.DriftDetectionModeCorrect:
+	default:
+		return "", 0, fmt.Errorf("%w: the environment var %s should be one of %s / %s / %s", errInvalidDriftDetectionMode,
+			envVarDriftDetectionMode, controller.DriftDetectionModeDisabled, controller.DriftDetectionModeReport,
+			controller.DriftDetectionModeCorrect)
+	}
+
+	driftDetectionIntervalString, found := os.LookupEnv(envVarDriftDetectionInterval)
+	if !found {
+		return driftDetectionMode, defaultDriftDetectionInterval, nil
+	}
+
+	driftDetectionInterval, err := time.ParseDuration(driftDetectionIntervalString)
+	if err != nil {
+		return "", 0, fmt.Errorf("the environment var %s is not a valid duration - %w",
+			envVarDriftDetectionInterval, err)
+	}
+
+	if driftDetectionInterval <= 0 {
+		return "", 0, fmt.Errorf("%w: %s", errNonPositiveDuration, envVarDriftDetectionInterval)
+	}
+
+	return driftDetectionMode, driftDetectionInterval, nil
+}
+
+// getDynamicIdentifiersInterval returns the interval between re-evaluations of dynamic identifiers. zero (the default)
+// disables the re-evaluation.
+func getDynamicIdentifiersInterval() (time.Duration, error) {
+	dynamicIdentifiersIntervalString, found := os.LookupEnv(envVarDynamicIdentifiersInterval)
+	if !found {
+		return defaultDynamicIdentifiersInterval, nil
+	}
+
+	dynamicIdentifiersInterval, err := time.ParseDuration(dynamicIdentifiersIntervalString)
+	if err != nil {
+		return 0, fmt.Errorf("the environment var %s is not a valid duration - %w",
+			envVarDynamicIdentifiersInterval, err)
+	}
+
+	if dynamicIdentifiersInterval < 0 {
+		return 0, fmt.Errorf("%w: %s", errNegativeDuration, envVarDynamicIdentifiersInterval)
+	}
+
+	return dynamicIdentifiersInterval, nil
+}
+
 // function to handle defers with exit, see https://stackoverflow.com/a/27629493/553720.
 func doMain() int {
 	pflag.CommandLine.AddFlagSet(zap.FlagSet())
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+
+	planMode := pflag.Bool(planModeFlagName, false,
+		"only plan (publish) the changes of git storage syncs for all subscriptions, without applying them")
+
 	pflag.Parse()
 
 	ctrl.SetLogger(zap.Logger())
@@ -96,8 +194,46 @@ func doMain() int {
 		return 1
 	}
 
+	syncLivenessWindow, err := getSyncLivenessWindow()
+	if err != nil {
+		log.Error(err, "initialization error")
+		return 1
+	}
+
+	driftDetectionMode, driftDetectionInterval, err := getDriftDetectionConfig()
+	if err != nil {
+		log.Error(err, "initialization error")
+		return 1
+	}
+
+	dynamicIdentifiersInterval, err := getDynamicIdentifiersInterval()
+	if err != nil {
+		log.Error(err, "initialization error")
+		return 1
+	}
+
+	// metrics are exposed through the manager's metrics endpoint
+	gitOpsMetrics, err := metrics.NewMetrics(ctrlmetrics.Registry)
+	if err != nil {
+		log.Error(err, "initialization error", "failed to initialize", "Metrics")
+		return 1
+	}
+
+	// spans are exported over OTLP only if an endpoint is configured
+	shutdownTracing, err := tracing.InitTracing(context.Background())
+	if err != nil {
+		log.Error(err, "initialization error", "failed to initialize", "Tracing")
+		return 1
+	}
+
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error(err, "failed to shutdown tracing")
+		}
+	}()
+
 	// db layer initialization
-	postgreSQL, err := postgresql.NewPostgreSQL()
+	postgreSQL, err := postgresql.NewPostgreSQL(gitOpsMetrics)
 	if err != nil {
 		log.Error(err, "initialization error", "failed to initialize", "PostgreSQL")
 		return 1
@@ -111,12 +247,19 @@ func doMain() int {
 		return 1
 	}
 
-	mgr, err := createManager(leaderElectionNamespace, gitStorageDirPath, postgreSQL, rbacAuthorizer, syncInterval)
+	mgr, err := createManager(leaderElectionNamespace, gitStorageDirPath, postgreSQL, postgreSQL, rbacAuthorizer,
+		syncInterval, *planMode, gitOpsMetrics, syncLivenessWindow, driftDetectionMode, driftDetectionInterval,
+		dynamicIdentifiersInterval)
 	if err != nil {
 		log.Error(err, "Failed to create manager")
 		return 1
 	}
 
+	if err := addReadinessChecks(mgr, gitStorageDirPath, postgreSQL, rbacAuthorizer); err != nil {
+		log.Error(err, "Failed to add readiness checks")
+		return 1
+	}
+
 	log.Info("Starting the Cmd.")
 
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -127,11 +270,14 @@ func doMain() int {
 	return 0
 }
 
-func createManager(leaderElectionNamespace string, gitStorageDirPath string, specDB db.SpecDB,
-	authorizer authorizer.Authorizer, syncInterval time.Duration,
+func createManager(leaderElectionNamespace string, gitStorageDirPath string, specDB db.SpecDB, statusDB db.StatusDB,
+	authorizer authorizer.Authorizer, syncInterval time.Duration, planMode bool, gitOpsMetrics *metrics.Metrics,
+	syncLivenessWindow time.Duration, driftDetectionMode string, driftDetectionInterval time.Duration,
+	dynamicIdentifiersInterval time.Duration,
 ) (ctrl.Manager, error) {
 	options := ctrl.Options{
 		MetricsBindAddress:      fmt.Sprintf("%s:%d", metricsHost, metricsPort),
+		HealthProbeBindAddress:  fmt.Sprintf("%s:%d", metricsHost, healthProbePort),
 		LeaderElection:          true,
 		LeaderElectionID:        leaderElectionLockName,
 		LeaderElectionNamespace: leaderElectionNamespace,
@@ -146,13 +292,58 @@ func createManager(leaderElectionNamespace string, gitStorageDirPath string, spe
 		return nil, fmt.Errorf("failed to add mgr: %w", err)
 	}
 
-	if err := controller.AddGitStorageWalker(mgr, gitStorageDirPath, specDB, authorizer, syncInterval); err != nil {
+	if err := controller.AddGitStorageWalker(mgr, gitStorageDirPath, specDB, statusDB, authorizer, syncInterval,
+		planMode, gitOpsMetrics, syncLivenessWindow, driftDetectionMode, driftDetectionInterval,
+		dynamicIdentifiersInterval); err != nil {
 		return nil, fmt.Errorf("failed to add db syncers: %w", err)
 	}
 
 	return mgr, nil
 }
 
+// addReadinessChecks adds readiness checks of the git storage dir, the db and the authorization endpoint to the mgr.
+func addReadinessChecks(mgr ctrl.Manager, gitStorageDirPath string, postgreSQL *postgresql.PostgreSQL,
+	rbacAuthorizer *authorizer.HubOfHubsAuthorizer,
+) error {
+	checkers := map[string]healthz.Checker{
+		"git-storage": func(_ *http.Request) error {
+			if _, err := ioutil.ReadDir(gitStorageDirPath); err != nil {
+				return fmt.Errorf("failed to read git storage dir %s - %w", gitStorageDirPath, err)
+			}
+
+			return nil
+		},
+		"db": func(req *http.Request) error {
+			ctx, cancelFunc := context.WithTimeout(req.Context(), readinessCheckTimeout)
+			defer cancelFunc()
+
+			if err := postgreSQL.Ping(ctx); err != nil {
+				return fmt.Errorf("db is not ready - %w", err)
+			}
+
+			return nil
+		},
+		"authorization": func(req *http.Request) error {
+			ctx, cancelFunc := context.WithTimeout(req.Context(), readinessCheckTimeout)
+			defer cancelFunc()
+
+			if err := rbacAuthorizer.CheckHealth(ctx); err != nil {
+				return fmt.Errorf("authorization is not ready - %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	for name, checker := range checkers {
+		if err := mgr.AddReadyzCheck(name, checker); err != nil {
+			return fmt.Errorf("failed to add %s readiness check: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
 func main() {
 	os.Exit(doMain())
 }
@@ -0,0 +1,120 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/validation"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	exitCodeValid       = 0
+	exitCodeInvalid     = 1
+	exitCodeFailed      = 2
+	outputFormatText    = "text"
+	outputFormatYAML    = "yaml"
+	defaultDirPath      = "."
+	usageMessagePattern = `usage: %s [flags] [dir]
+
+validates the non-k8s gitops objects in the files of dir (defaults to the current directory, e.g. the root of a git
+repo clone) the same way hub-of-hubs-gitops parses them. exits with 1 if issues were found.
+
+flags:
+`
+)
+
+// function to handle defers with exit, see https://stackoverflow.com/a/27629493/553720.
+func doMain() int {
+	return run(os.Args, os.Stdout, os.Stderr)
+}
+
+// run validates the directory given by the command line arguments, and writes the found issues to stdout and the
+// failures to stderr. returns the exit code.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flagSet := pflag.NewFlagSet(args[0], pflag.ContinueOnError)
+	flagSet.SetOutput(stderr)
+	flagSet.Usage = func() {
+		fmt.Fprintf(stderr, usageMessagePattern, args[0])
+		flagSet.PrintDefaults()
+	}
+
+	gitPath := flagSet.String("git-path", "",
+		"the path (relative to dir) to validate objects from, as the subscription's git-path annotation")
+	recursive := flagSet.Bool("recursive", false,
+		"validate files in nested directories of the git-path, as the subscription's gitops-recursive annotation")
+	includePatterns := flagSet.StringSlice("include", nil,
+		"glob patterns of files to validate, as the subscription's gitops-include annotation")
+	excludePatterns := flagSet.StringSlice("exclude", nil,
+		"glob patterns of files not to validate, as the subscription's gitops-exclude annotation")
+	outputFormat := flagSet.StringP("output", "o", outputFormatText,
+		fmt.Sprintf("the format of the found issues (%s / %s)", outputFormatText, outputFormatYAML))
+
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return exitCodeFailed
+	}
+
+	if flagSet.NArg() > 1 || (*outputFormat != outputFormatText && *outputFormat != outputFormatYAML) {
+		flagSet.Usage()
+		return exitCodeFailed
+	}
+
+	dirPath := defaultDirPath
+	if flagSet.NArg() == 1 {
+		dirPath = flagSet.Arg(0)
+	}
+
+	issues, err := validation.ValidateDirectory(dirPath, &dbsyncer.WorkPath{
+		Path:            *gitPath,
+		Recursive:       *recursive,
+		IncludePatterns: *includePatterns,
+		ExcludePatterns: *excludePatterns,
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return exitCodeFailed
+	}
+
+	if err := printIssues(stdout, stderr, issues, *outputFormat); err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return exitCodeFailed
+	}
+
+	if len(issues) != 0 {
+		return exitCodeInvalid
+	}
+
+	return exitCodeValid
+}
+
+// printIssues prints the found issues to stdout in the given format, and their count to stderr.
+func printIssues(stdout io.Writer, stderr io.Writer, issues []*validation.Issue, outputFormat string) error {
+	if outputFormat == outputFormatYAML {
+		issuesBytes, err := yaml.Marshal(issues)
+		if err != nil {
+			return fmt.Errorf("failed to marshal issues - %w", err)
+		}
+
+		fmt.Fprint(stdout, string(issuesBytes))
+
+		return nil
+	}
+
+	for _, issue := range issues {
+		fmt.Fprintln(stdout, issue.String())
+	}
+
+	fmt.Fprintf(stderr, "found %d issue(s)\n", len(issues))
+
+	return nil
+}
+
+func main() {
+	os.Exit(doMain())
+}
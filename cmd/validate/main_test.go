@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testAWSGroup = `kind: ManagedClustersGroup
+metadata:
+  name: aws
+spec:
+  identifiers:
+  - hubIdentifier:
+      name: hub1
+      managedClusterIdentifiers: [cluster1]
+`
+	testInvalidGroup = `kind: ManagedClustersGroup
+metadata:
+  name: gcp
+spec:
+  identifiers:
+  - hubIdentifier:
+      managedClusterIdentifiers: [cluster1]
+`
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name             string
+		files            map[string]string
+		flags            []string
+		expectedExitCode int
+		// expectedOutput is a substring of stdout. stdout is expected to be empty if not set.
+		expectedOutput string
+	}{
+		{
+			name:             "valid directory",
+			files:            map[string]string{"groups.yaml": testAWSGroup},
+			expectedExitCode: exitCodeValid,
+		},
+		{
+			name:             "issues in text",
+			files:            map[string]string{"groups.yaml": testAWSGroup, "invalid/groups.yaml": testInvalidGroup},
+			flags:            []string{"--recursive"},
+			expectedExitCode: exitCodeInvalid,
+			expectedOutput:   "invalid/groups.yaml (document 0) ManagedClustersGroup/gcp: schema error",
+		},
+		{
+			name:             "issues in yaml",
+			files:            map[string]string{"groups.yaml": testInvalidGroup},
+			flags:            []string{"-o", outputFormatYAML},
+			expectedExitCode: exitCodeInvalid,
+			expectedOutput:   "- file: groups.yaml\n  documentIndex: 0\n  object: ManagedClustersGroup/gcp\n",
+		},
+		{
+			name:             "files selected by git path",
+			files:            map[string]string{"valid/groups.yaml": testAWSGroup, "invalid/groups.yaml": testInvalidGroup},
+			flags:            []string{"--git-path", "valid"},
+			expectedExitCode: exitCodeValid,
+		},
+		{
+			name:             "files excluded",
+			files:            map[string]string{"groups.yaml": testAWSGroup, "invalid.yaml": testInvalidGroup},
+			flags:            []string{"--exclude", "invalid.yaml"},
+			expectedExitCode: exitCodeValid,
+		},
+		{
+			name:             "unsupported output format",
+			flags:            []string{"-o", "json"},
+			expectedExitCode: exitCodeFailed,
+		},
+		{
+			name:             "malformed pattern",
+			flags:            []string{"--include", "["},
+			expectedExitCode: exitCodeFailed,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dirPath := t.TempDir()
+
+			for filePath, contents := range test.files {
+				fullFilePath := filepath.Join(dirPath, filePath)
+				if err := os.MkdirAll(filepath.Dir(fullFilePath), 0o700); err != nil {
+					t.Fatalf("failed to create directory of file %s - %v", filePath, err)
+				}
+
+				if err := ioutil.WriteFile(fullFilePath, []byte(contents), 0o600); err != nil {
+					t.Fatalf("failed to write file %s - %v", filePath, err)
+				}
+			}
+
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+			exitCode := run(append(append([]string{"validate"}, test.flags...), dirPath), stdout, stderr)
+			if exitCode != test.expectedExitCode {
+				t.Fatalf("expected exit code %d, got %d (stderr: %s)", test.expectedExitCode, exitCode, stderr)
+			}
+
+			if test.expectedOutput == "" && stdout.Len() != 0 {
+				t.Fatalf("expected no output, got %s", stdout)
+			}
+
+			if !strings.Contains(stdout.String(), test.expectedOutput) {
+				t.Fatalf("expected output to contain %q, got %s", test.expectedOutput, stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+-- Copyright Contributors to the Open Cluster Management project
+
+-- Tables owned by hub-of-hubs-gitops, in addition to the hub-of-hubs spec / status schemas.
+
+CREATE TABLE IF NOT EXISTS spec.gitops_repos_sync_state (
+    repo_name character varying(254) NOT NULL,
+    syncer character varying(254) NOT NULL,
+    commit_id character varying(64) NOT NULL,
+    work_path text NOT NULL,
+    recursive boolean DEFAULT false NOT NULL,
+    include_patterns jsonb DEFAULT '[]'::jsonb NOT NULL,
+    exclude_patterns jsonb DEFAULT '[]'::jsonb NOT NULL,
+    user_identity text NOT NULL,
+    user_group text NOT NULL,
+    updated_at timestamp without time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (repo_name, syncer)
+);
+
+CREATE TABLE IF NOT EXISTS spec.gitops_managed_clusters_labels_audit (
+    id bigserial PRIMARY KEY,
+    user_identity text NOT NULL,
+    user_group text NOT NULL,
+    repo_path text NOT NULL,
+    commit_id character varying(64) NOT NULL,
+    file_path text NOT NULL,
+    leaf_hub_name character varying(63) NOT NULL,
+    managed_cluster_name character varying(63) NOT NULL,
+    label_key text NOT NULL,
+    label_value text,
+    operation character varying(16) NOT NULL,
+    created_at timestamp without time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS gitops_managed_clusters_labels_audit_cluster_idx ON
+    spec.gitops_managed_clusters_labels_audit (leaf_hub_name, managed_cluster_name);
+
+CREATE TABLE IF NOT EXISTS spec.gitops_managed_clusters_label_owners (
+    owner text NOT NULL,
+    leaf_hub_name character varying(63) NOT NULL,
+    managed_cluster_name character varying(63) NOT NULL,
+    label_key text NOT NULL,
+    PRIMARY KEY (label_key, owner, leaf_hub_name, managed_cluster_name)
+);
+
+CREATE INDEX IF NOT EXISTS gitops_managed_clusters_label_owners_owner_idx ON
+    spec.gitops_managed_clusters_label_owners (owner);
@@ -0,0 +1,89 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out.
+func (in *GitOpsSyncReport) DeepCopyInto(out *GitOpsSyncReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy returns a deep copy of the receiver.
+func (in *GitOpsSyncReport) DeepCopy() *GitOpsSyncReport {
+	if in == nil {
+		return nil
+	}
+
+	out := new(GitOpsSyncReport)
+	in.DeepCopyInto(out)
+
+	return out
+}
+
+// DeepCopyObject returns a deep copy of the receiver as a runtime.Object.
+func (in *GitOpsSyncReport) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *GitOpsSyncReportStatus) DeepCopyInto(out *GitOpsSyncReportStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+
+	if in.Files != nil {
+		out.Files = make([]FileSyncResult, len(in.Files))
+		for i := range in.Files {
+			in.Files[i].DeepCopyInto(&out.Files[i])
+		}
+	}
+
+	if in.Hubs != nil {
+		out.Hubs = make([]HubSyncResult, len(in.Hubs))
+		copy(out.Hubs, in.Hubs)
+	}
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *FileSyncResult) DeepCopyInto(out *FileSyncResult) {
+	*out = *in
+
+	if in.Errors != nil {
+		out.Errors = make([]string, len(in.Errors))
+		copy(out.Errors, in.Errors)
+	}
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *GitOpsSyncReportList) DeepCopyInto(out *GitOpsSyncReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+
+	if in.Items != nil {
+		out.Items = make([]GitOpsSyncReport, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver.
+func (in *GitOpsSyncReportList) DeepCopy() *GitOpsSyncReportList {
+	if in == nil {
+		return nil
+	}
+
+	out := new(GitOpsSyncReportList)
+	in.DeepCopyInto(out)
+
+	return out
+}
+
+// DeepCopyObject returns a deep copy of the receiver as a runtime.Object.
+func (in *GitOpsSyncReportList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
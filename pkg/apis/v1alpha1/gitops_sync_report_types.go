@@ -0,0 +1,82 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FileSyncOutcome is the outcome of syncing the objects of a single file.
+type FileSyncOutcome string
+
+const (
+	// FileSyncOutcomeApplied means that all objects of the file were applied.
+	FileSyncOutcomeApplied FileSyncOutcome = "Applied"
+	// FileSyncOutcomeParseError means that the file (or at least one of its objects) failed to be read / parsed.
+	FileSyncOutcomeParseError FileSyncOutcome = "ParseError"
+	// FileSyncOutcomeDBError means that at least one object of the file failed to be applied to the DB (or its k8s
+	// resources).
+	FileSyncOutcomeDBError FileSyncOutcome = "DBError"
+)
+
+// GitOpsSyncReport reports the result of the last sync of a subscription's git repo. it is named after the
+// subscription and is created in the subscription's namespace.
+type GitOpsSyncReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status GitOpsSyncReportStatus `json:"status,omitempty"`
+}
+
+// GitOpsSyncReportStatus holds the result of a git repo sync.
+type GitOpsSyncReportStatus struct {
+	// CommitID is the ID of the commit that was synced.
+	CommitID string `json:"commitID"`
+	// FromCommitID is the ID of the previously synced commit. empty if never synced.
+	FromCommitID string `json:"fromCommitID,omitempty"`
+	// Syncer is the name of the syncer that synced the repo.
+	Syncer string `json:"syncer"`
+	// FullSync is set if all files were synced rather than the files changed since FromCommitID.
+	FullSync bool `json:"fullSync"`
+	// Succeeded is set if the repo and all of its objects were synced successfully.
+	Succeeded bool `json:"succeeded"`
+	// Error of the repo sync, if failed before / after the objects were synced.
+	Error string `json:"error,omitempty"`
+	// StartTime is the time that the sync started.
+	StartTime metav1.Time `json:"startTime"`
+	// Duration of the sync.
+	Duration metav1.Duration `json:"duration"`
+	// Files are the outcomes of the synced (or un-deployed) files, sorted by path.
+	Files []FileSyncResult `json:"files,omitempty"`
+	// Hubs are the counts of the managed clusters that were applied / denied, by hub, sorted by name.
+	Hubs []HubSyncResult `json:"hubs,omitempty"`
+}
+
+// FileSyncResult holds the outcome of syncing the objects of a single file.
+type FileSyncResult struct {
+	// Path of the file, relative to the repo root.
+	Path string `json:"path"`
+	// Outcome is one of Applied, ParseError and DBError.
+	Outcome FileSyncOutcome `json:"outcome"`
+	// Errors of the file's objects, if failed.
+	Errors []string `json:"errors,omitempty"`
+	// Duration of syncing the file's objects.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// HubSyncResult holds the counts of the managed clusters of a single hub that were changed by a sync.
+type HubSyncResult struct {
+	// Name of the hub.
+	Name string `json:"name"`
+	// AppliedManagedClusters is the number of managed clusters that labels were assigned to / removed from.
+	AppliedManagedClusters int `json:"appliedManagedClusters"`
+	// DeniedManagedClusters is the number of managed clusters that were filtered out since the subscription's user is
+	// not authorized to access them.
+	DeniedManagedClusters int `json:"deniedManagedClusters"`
+}
+
+// GitOpsSyncReportList is a list of GitOpsSyncReport.
+type GitOpsSyncReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []GitOpsSyncReport `json:"items"`
+}
@@ -0,0 +1,27 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Group is the API group of the hub-of-hubs gitops types.
+	Group = "hub-of-hubs.open-cluster-management.io"
+	// Version is the API version of the hub-of-hubs gitops types.
+	Version = "v1alpha1"
+)
+
+// SchemeGroupVersion returns the group version of the hub-of-hubs gitops types.
+func SchemeGroupVersion() schema.GroupVersion {
+	return schema.GroupVersion{Group: Group, Version: Version}
+}
+
+// AddToScheme adds the hub-of-hubs gitops types to the given scheme.
+func AddToScheme(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion(), &GitOpsSyncReport{}, &GitOpsSyncReportList{})
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion())
+
+	return nil
+}
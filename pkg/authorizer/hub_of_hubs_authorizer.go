@@ -17,6 +17,9 @@ import (
 	"github.com/go-logr/logr"
 	opatypes "github.com/open-policy-agent/opa/server/types"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -86,8 +89,23 @@ func (auth *HubOfHubsAuthorizer) FilterManagedClustersForUser(ctx context.Contex
 		hubToAccessibleManagedClustersMap), nil
 }
 
+// CheckHealth checks that the authorization compile endpoint responds.
+func (auth *HubOfHubsAuthorizer) CheckHealth(ctx context.Context) error {
+	if _, err := auth.getPartialEvaluation(ctx, "", nil); err != nil {
+		return fmt.Errorf("authorization compile endpoint did not respond - %w", err)
+	}
+
+	return nil
+}
+
 func (auth *HubOfHubsAuthorizer) filterByAuthorization(ctx context.Context, user string, groups []string) string {
-	compileResponse, err := auth.getPartialEvaluation(ctx, user, groups)
+	spanCtx, span := tracing.StartSpan(ctx, "getPartialEvaluation", trace.WithAttributes(
+		attribute.String("user", user)))
+	compileResponse, err := auth.getPartialEvaluation(spanCtx, user, groups)
+
+	tracing.SetError(span, err)
+	span.End()
+
 	if err != nil {
 		auth.log.Error(err, "unable to get partial evaluation response")
 		return denyAll
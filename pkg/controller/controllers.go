@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"time"
 
+	gitopsv1alpha1 "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/apis/v1alpha1"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/authorizer"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/intervalpolicy"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/metrics"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
 	"k8s.io/apimachinery/pkg/runtime"
 	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
 	"open-cluster-management.io/multicloud-operators-subscription/pkg/apis"
@@ -15,11 +18,6 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-const (
-	managedClustersGroupStorageToDBSyncerTag = "ManagedClustersGroup"
-	managedClusterSetStorageToDBSyncerTag    = "HubOfHubsManagedClusterSet"
-)
-
 // AddToScheme adds all Resources to the Scheme.
 func AddToScheme(runtimeScheme *runtime.Scheme) error {
 	// Setup Scheme for all channel-subscription resources
@@ -30,35 +28,54 @@ func AddToScheme(runtimeScheme *runtime.Scheme) error {
 	if err := clusterv1beta1.Install(runtimeScheme); err != nil {
 		return fmt.Errorf("failed to install cluster/v1beta1 scheme to mgr scheme - %w", err)
 	}
+	// Setup Scheme for hub-of-hubs gitops resources
+	if err := gitopsv1alpha1.AddToScheme(runtimeScheme); err != nil {
+		return fmt.Errorf("failed to add hub-of-hubs gitops apis to mgr scheme - %w", err)
+	}
 
 	return nil
 }
 
 // AddGitStorageWalker adds the controllers that sync (/process) files from process into the DB to the Manager.
-func AddGitStorageWalker(mgr ctrl.Manager, gitStorageDirPath string, specDB db.SpecDB,
-	rbacAuthorizer authorizer.Authorizer, syncInterval time.Duration,
+func AddGitStorageWalker(mgr ctrl.Manager, gitStorageDirPath string, specDB db.SpecDB, statusDB db.StatusDB,
+	rbacAuthorizer authorizer.Authorizer, syncInterval time.Duration, planMode bool, gitOpsMetrics *metrics.Metrics,
+	livenessWindow time.Duration, driftDetectionMode string, driftDetectionInterval time.Duration,
+	dynamicIdentifiersInterval time.Duration,
 ) error {
 	k8sClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
 	if err != nil {
 		return fmt.Errorf("failed to start k8s client from mgr - %w", err)
 	}
 
-	tagToSyncerMap := map[string]dbsyncer.StorageToDBSyncer{
-		managedClustersGroupStorageToDBSyncerTag: dbsyncer.NewManagedClustersGroupStorageToDBSyncer(specDB,
+	kindToHandlerMap := map[string]*dbsyncer.GitResourceHandler{
+		yamltypes.ManagedClustersGroupKind: dbsyncer.NewManagedClustersGroupHandler(specDB, statusDB, rbacAuthorizer),
+		yamltypes.ManagedClusterSetKind: dbsyncer.NewManagedClusterSetHandler(specDB, statusDB, k8sClient,
 			rbacAuthorizer),
-		managedClusterSetStorageToDBSyncerTag: dbsyncer.NewManagedClusterSetStorageToDBSyncer(specDB,
-			k8sClient, rbacAuthorizer),
+		yamltypes.ManagedClusterLabelsKind: dbsyncer.NewManagedClusterLabelsHandler(specDB, statusDB, rbacAuthorizer),
 	}
 
-	if err := mgr.Add(&gitStorageWalker{
-		log:            ctrl.Log.WithName("git-storage-walker"),
-		k8sClient:      k8sClient,
-		rootDirPath:    gitStorageDirPath,
-		tagToSyncerMap: tagToSyncerMap,
-		intervalPolicy: intervalpolicy.NewExponentialBackoffPolicy(syncInterval),
-	}); err != nil {
+	walker := &gitStorageWalker{
+		log:                        ctrl.Log.WithName("git-storage-walker"),
+		k8sClient:                  k8sClient,
+		eventRecorder:              mgr.GetEventRecorderFor("hub-of-hubs-gitops"),
+		rootDirPath:                gitStorageDirPath,
+		dbSyncer:                   dbsyncer.NewStorageToDBSyncer(specDB, kindToHandlerMap, gitOpsMetrics),
+		intervalPolicy:             intervalpolicy.NewExponentialBackoffPolicy(syncInterval),
+		planMode:                   planMode,
+		metrics:                    gitOpsMetrics,
+		livenessWindow:             livenessWindow,
+		driftDetectionMode:         driftDetectionMode,
+		driftDetectionInterval:     driftDetectionInterval,
+		dynamicIdentifiersInterval: dynamicIdentifiersInterval,
+	}
+
+	if err := mgr.Add(walker); err != nil {
 		return fmt.Errorf("failed to add git-storage-walker to mgr - %w", err)
 	}
 
+	if err := mgr.AddHealthzCheck("git-storage-walker", walker.checkLiveness); err != nil {
+		return fmt.Errorf("failed to add git-storage-walker liveness check to mgr - %w", err)
+	}
+
 	return nil
 }
@@ -4,10 +4,42 @@ import (
 	"context"
 )
 
-// StorageToDBSyncer abstracts the functionality needed from a storage to DB syncer.
+// StorageToDBSyncer abstracts the functionality needed from a storage to DB syncer. it is safe for concurrent use,
+// operations on the same local git repo are serialized.
 type StorageToDBSyncer interface {
-	// SyncGitRepo operates on a local git repo to sync contained yaml files (depth 1). workPath is the relative
-	// path to sync objects from (sets workdir = gitRepoPath/workPath). If left empty, the workdir is gitRepoPath.
+	// SyncGitRepo operates on a local git repo to sync contained yaml files. workPath defines the files to sync objects
+	// from, relative to gitRepoPath. each yaml document is synced by the handler of its kind. if dryRun is set, the
+	// changes are only computed. returns the plan of the sync, or nil if there were no updates to sync.
 	SyncGitRepo(ctx context.Context, base64UserIdentity string, base64UserGroup string, gitRepoPath string,
-		workPath string, forceReconcile bool) bool
+		workPath *WorkPath, forceReconcile bool, dryRun bool) *SyncPlan
+	// DeleteGitRepo un-deploys all objects that were synced from a local git repo by the syncer. Returns true if all
+	// objects were un-deployed or if the syncer did not sync the repo.
+	DeleteGitRepo(ctx context.Context, gitRepoPath string) bool
+	// DetectDrift compares the labels that the objects of a local git repo assign at the synced commit with the labels
+	// in the DB. if correct is set, drifted labels are re-assigned / removed. returns the drift report, or nil if the
+	// repo was not synced by the syncer.
+	DetectDrift(ctx context.Context, gitRepoPath string, correct bool) *DriftReport
+	// ReevaluateDynamicObjects re-resolves the dynamic identifiers of the objects of a local git repo at the synced
+	// commit against the status DB, and applies the label additions and removals of managed clusters that joined / left
+	// the identified managed clusters since the previous re-evaluation. objects that reference other objects are
+	// re-evaluated as well. returns the report of the changed labels, or nil if the repo was not
+	// synced by the syncer.
+	ReevaluateDynamicObjects(ctx context.Context, gitRepoPath string) *DriftReport
+}
+
+// GitResourceHandler handles the git resources (yaml documents) of a specific kind.
+type GitResourceHandler struct {
+	syncGitResourceFunc syncGitResourceFunc
+	// deleteGitResourceFunc un-deploys a resource that was removed from the repo. nil if not supported.
+	deleteGitResourceFunc deleteGitResourceFunc
+	// pruneGitResourcesFunc un-deploys left-over objects after a repo is fully synced. nil if not supported.
+	pruneGitResourcesFunc pruneGitResourcesFunc
+	// detectDriftFunc detects the drift of the labels that a resource assigns. nil if not supported.
+	detectDriftFunc detectDriftFunc
+	// correctDriftFunc corrects the detected drift of the labels that a resource assigns. nil to re-assign / remove the
+	// drifted labels.
+	correctDriftFunc correctDriftFunc
+	// getReferencesFunc returns the objects that a resource references, whose changes re-sync the resource. nil if
+	// the kind does not reference objects.
+	getReferencesFunc getReferencesFunc
 }
@@ -0,0 +1,418 @@
+package dbsyncer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	set "github.com/deckarep/golang-set"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/authorizer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/tracing"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// detectDriftFunc returns the drift between the labels that a git resource assigns and the labels in the DB.
+type detectDriftFunc func(ctx context.Context, resource *gitResource) ([]*LabelDrift, error)
+
+// correctDriftFunc corrects the drift of the labels that a git resource assigns.
+type correctDriftFunc func(ctx context.Context, resource *gitResource, labelDrifts []*LabelDrift) error
+
+// DriftReport holds the drift between the labels that the objects of a local git repo (at the synced commit) assign
+// and the labels in the DB.
+type DriftReport struct {
+	// CommitID is the ID of the synced commit that the desired labels were read at.
+	CommitID string `yaml:"commit"`
+	// Drifts of the objects whose labels drifted.
+	Drifts []*ObjectDrift `yaml:"drifts"`
+	// Error of the drift detection, if failed before the objects were checked.
+	Error string `yaml:"error,omitempty"`
+}
+
+// ObjectDrift holds the drift of the labels that a single object assigns.
+type ObjectDrift struct {
+	// FilePath is the path of the object's file, relative to the repo root.
+	FilePath string `yaml:"file"`
+	// DocumentIndex is the index of the object's document within its file.
+	DocumentIndex int `yaml:"documentIndex"`
+	// Object identifies the object (kind/name).
+	Object string `yaml:"object"`
+	// LabelDrifts are the drifts of the object's labels. empty if the drift detection of the object failed.
+	LabelDrifts []*LabelDrift `yaml:"labelDrifts,omitempty"`
+	// Corrected is set if the drift was corrected.
+	Corrected bool `yaml:"corrected"`
+	// Error of the drift detection / correction, if failed.
+	Error string `yaml:"error,omitempty"`
+}
+
+// LabelDrift holds the drift of a label's assignment to managed clusters, as a map of hub -> managed clusters. only
+// managed clusters that the subscribed user is authorized to access are included.
+type LabelDrift struct {
+	// Key of the label.
+	Key string `yaml:"key"`
+	// Value of the label.
+	Value string `yaml:"value"`
+	// MissingManagedClusters are the managed clusters that should be assigned with the label but are not (or are
+	// assigned with a different value).
+	MissingManagedClusters map[string][]string `yaml:"missingManagedClusters,omitempty"`
+	// ExtraManagedClusters are the managed clusters that are assigned with the label but should not be.
+	ExtraManagedClusters map[string][]string `yaml:"extraManagedClusters,omitempty"`
+}
+
+// GetDriftedManagedClustersCount returns the number of (distinct) managed clusters whose labels drifted.
+func (report *DriftReport) GetDriftedManagedClustersCount() int {
+	return report.getManagedClustersCount(func(*ObjectDrift) bool { return true })
+}
+
+// GetCorrectedManagedClustersCount returns the number of (distinct) managed clusters whose drifted labels were
+// corrected.
+func (report *DriftReport) GetCorrectedManagedClustersCount() int {
+	return report.getManagedClustersCount(func(objectDrift *ObjectDrift) bool { return objectDrift.Corrected })
+}
+
+// getManagedClustersCount returns the number of (distinct) managed clusters in the drifts of the objects that match
+// the given predicate.
+func (report *DriftReport) getManagedClustersCount(predicate func(objectDrift *ObjectDrift) bool) int {
+	driftedManagedClusters := set.NewSet()
+
+	for _, objectDrift := range report.Drifts {
+		if !predicate(objectDrift) {
+			continue
+		}
+
+		for _, labelDrift := range objectDrift.LabelDrifts {
+			for _, hubToManagedClustersMap := range []map[string][]string{
+				labelDrift.MissingManagedClusters, labelDrift.ExtraManagedClusters,
+			} {
+				for hubName, clusters := range hubToManagedClustersMap {
+					for _, cluster := range clusters {
+						driftedManagedClusters.Add(fmt.Sprintf("%s/%s", hubName, cluster))
+					}
+				}
+			}
+		}
+	}
+
+	return driftedManagedClusters.Cardinality()
+}
+
+// DetectDrift compares the labels that the objects of a local git repo assign at the synced commit with the labels in
+// the DB, using the handler registered for each object's kind. If correct is set, drifted labels are re-assigned /
+// removed. Returns nil if the repo was not synced by the syncer.
+func (syncer *genericStorageToDBSyncer) DetectDrift(ctx context.Context, gitRepoFullPath string,
+	correct bool,
+) *DriftReport {
+	defer syncer.lockRepo(gitRepoFullPath)()
+
+	return syncer.detectDrift(ctx, gitRepoFullPath, &driftDetectionOptions{
+		correct:        correct,
+		documentFilter: func([]byte) bool { return true },
+	})
+}
+
+// ReevaluateDynamicObjects re-resolves the dynamic identifiers (hub name patterns / managed cluster selectors) of the
+// objects of a local git repo at the synced commit against the status DB, and applies the resulting label additions
+// and removals. objects that reference other objects (e.g. composed groups) are re-evaluated as well, since the
+// referenced objects may be dynamic. only the labels of managed clusters that joined / left the identified managed
+// clusters since the previous re-evaluation are changed, other drifts (e.g. manual label edits) are left to the drift
+// detection. labels of an object that were not re-evaluated before (e.g. after a restart) are compared with their
+// current assignment in the DB. Returns the report of the changed labels, or nil if the repo was not synced by the
+// syncer.
+func (syncer *genericStorageToDBSyncer) ReevaluateDynamicObjects(ctx context.Context,
+	gitRepoFullPath string,
+) *DriftReport {
+	ctx, span := tracing.StartSpan(ctx, "ReevaluateDynamicObjects", trace.WithAttributes(
+		attribute.String("repo", gitRepoFullPath)))
+	defer span.End()
+
+	defer syncer.lockRepo(gitRepoFullPath)()
+
+	previousMembershipStates := syncer.getMembershipStates(gitRepoFullPath)
+	currentMembershipStates := make(map[string]membershipState)
+
+	report := syncer.detectDrift(ctx, gitRepoFullPath, &driftDetectionOptions{
+		correct:        true,
+		documentFilter: syncer.isDynamic,
+		labelDriftsFilter: func(objectIdentifier string, resource *gitResource,
+			labelDrifts []*LabelDrift,
+		) []*LabelDrift {
+			currentMembershipStates[objectIdentifier] = resource.membership
+
+			return getMembershipChanges(labelDrifts, getMembershipBaseline(previousMembershipStates[objectIdentifier],
+				resource.assignedMembership), resource.membership)
+		},
+	})
+	if report == nil {
+		return nil
+	}
+
+	if report.Error != "" {
+		span.SetStatus(codes.Error, report.Error)
+		return report
+	}
+
+	// objects whose changes were not applied are evaluated against their previous membership (or the DB) again
+	for _, objectDrift := range report.Drifts {
+		if objectDrift.Error == "" {
+			continue
+		}
+
+		if previousMembershipState, found := previousMembershipStates[objectDrift.Object]; found {
+			currentMembershipStates[objectDrift.Object] = previousMembershipState
+		} else {
+			delete(currentMembershipStates, objectDrift.Object)
+		}
+	}
+
+	syncer.setMembershipStates(gitRepoFullPath, currentMembershipStates)
+
+	return report
+}
+
+// driftDetectionOptions configure a drift detection of the objects of a local git repo.
+type driftDetectionOptions struct {
+	// correct is set if drifted labels are re-assigned / removed.
+	correct bool
+	// documentFilter selects the documents whose objects are checked.
+	documentFilter func(document []byte) bool
+	// labelDriftsFilter narrows the drifts of an object before they are reported / corrected. nil keeps all drifts.
+	labelDriftsFilter func(objectIdentifier string, resource *gitResource, labelDrifts []*LabelDrift) []*LabelDrift
+}
+
+// isDynamic returns whether the object in the given document identifies a changing set of managed clusters: its
+// identifiers are dynamic, or it references other objects (e.g. a composed group), which may be dynamic.
+func (syncer *genericStorageToDBSyncer) isDynamic(document []byte) bool {
+	if len(syncer.getReferences(document)) > 0 {
+		return true
+	}
+
+	identifiers, err := yamltypes.NewIdentifiersFromBytes(document)
+
+	return err == nil && yamltypes.IdentifiersAreDynamic(identifiers)
+}
+
+// detectDrift detects (and corrects, if set) the drift of the objects of a local git repo at the synced commit, as
+// configured by the given options.
+func (syncer *genericStorageToDBSyncer) detectDrift(ctx context.Context, gitRepoFullPath string,
+	options *driftDetectionOptions,
+) *DriftReport {
+	syncState, err := syncer.specDB.GetGitRepoSyncState(ctx, gitReposSyncStateDBTableName,
+		getSubscriptionName(gitRepoFullPath), syncer.name)
+	if err != nil {
+		syncer.log.Error(err, "failed to get synced commit of local git repo", "root", gitRepoFullPath)
+		return &DriftReport{Drifts: make([]*ObjectDrift, 0), Error: fmt.Sprintf("failed to get synced commit - %s",
+			err.Error())}
+	}
+
+	if syncState.CommitID == "" {
+		return nil // repo was not synced by this syncer
+	}
+
+	report := &DriftReport{CommitID: syncState.CommitID, Drifts: make([]*ObjectDrift, 0)}
+
+	repo, err := git.PlainOpen(gitRepoFullPath)
+	if err != nil {
+		syncer.log.Error(err, "failed to open local git repo", "root", gitRepoFullPath)
+		report.Error = fmt.Sprintf("failed to open local git repo - %s", err.Error())
+
+		return report
+	}
+
+	// the desired labels are the ones that were synced
+	files, err := getFiles(repo, syncState.CommitID, getWorkPath(syncState))
+	if err != nil {
+		syncer.log.Error(err, "failed to get synced files of local git repo", "root", gitRepoFullPath,
+			"commit", syncState.CommitID)
+		report.Error = fmt.Sprintf("failed to get synced files - %s", err.Error())
+
+		return report
+	}
+
+	objects := newRepoObjects(repo, syncState.CommitID, getWorkPath(syncState))
+	managedClusters := &managedClustersSnapshot{}
+
+	for _, file := range files {
+		report.Drifts = append(report.Drifts, syncer.detectFileDrift(ctx, gitRepoFullPath, syncState, objects,
+			managedClusters, file, options)...)
+	}
+
+	return report
+}
+
+// detectFileDrift returns the drifts of the objects in the given file, that was synced with the given sync state.
+// objects may reference the given objects of the repo, and are resolved against the given snapshot of the managed
+// clusters. documents that do not match the options' filter are skipped.
+func (syncer *genericStorageToDBSyncer) detectFileDrift(ctx context.Context, gitRepoFullPath string,
+	syncState *db.GitRepoSyncState, objects *repoObjects, managedClusters *managedClustersSnapshot, file *object.File,
+	options *driftDetectionOptions,
+) []*ObjectDrift {
+	objectDrifts := make([]*ObjectDrift, 0)
+
+	documents, err := getDocuments(file)
+	if err != nil {
+		return objectDrifts // nothing was synced from file
+	}
+
+	for documentIndex, document := range documents {
+		objectHeader := getObjectHeader(document)
+		if objectHeader == nil || !options.documentFilter(document) {
+			continue // nothing was synced from document, or document is filtered out
+		}
+
+		handler, found := syncer.kindToHandlerMap[objectHeader.Kind]
+		if !found || handler.detectDriftFunc == nil {
+			continue // nothing was synced from document or kind does not support drift detection
+		}
+
+		resource := &gitResource{
+			base64UserID:       syncState.Base64UserIdentity,
+			base64UserGroup:    syncState.Base64UserGroup,
+			gitRepoFullPath:    gitRepoFullPath,
+			commitID:           syncState.CommitID,
+			filePath:           file.Name,
+			documentIndex:      documentIndex,
+			buf:                bytes.NewBuffer(document),
+			change:             &ObjectChange{FilePath: file.Name, DocumentIndex: documentIndex},
+			repoObjects:        objects,
+			membership:         make(membershipState),
+			assignedMembership: make(membershipState),
+			managedClusters:    managedClusters,
+		}
+
+		objectDrift := &ObjectDrift{
+			FilePath:      file.Name,
+			DocumentIndex: documentIndex,
+			Object:        objectHeader.GetIdentifier(),
+		}
+
+		labelDrifts, err := handler.detectDriftFunc(ctx, resource)
+		if err != nil {
+			syncer.log.Error(err, "failed to detect drift of git resource in local git repo", "filepath", file.Name,
+				"document-index", documentIndex)
+
+			objectDrift.Error = err.Error()
+			objectDrifts = append(objectDrifts, objectDrift)
+
+			continue
+		}
+
+		if options.labelDriftsFilter != nil {
+			labelDrifts = options.labelDriftsFilter(objectDrift.Object, resource, labelDrifts)
+		}
+
+		if len(labelDrifts) == 0 {
+			continue // no drift
+		}
+
+		objectDrift.LabelDrifts = labelDrifts
+
+		if options.correct {
+			correctDrift := handler.correctDriftFunc
+			if correctDrift == nil {
+				correctDrift = func(ctx context.Context, resource *gitResource, labelDrifts []*LabelDrift) error {
+					return correctLabelDrifts(ctx, syncer.specDB, resource, labelDrifts)
+				}
+			}
+
+			if err := correctDrift(ctx, resource, labelDrifts); err != nil {
+				syncer.log.Error(err, "failed to correct drift of git resource in local git repo",
+					"filepath", file.Name, "document-index", documentIndex)
+
+				objectDrift.Error = err.Error()
+			} else {
+				objectDrift.Corrected = true
+
+				syncer.log.Info("corrected drift of git resource", "filepath", file.Name,
+					"document-index", documentIndex, "object", objectDrift.Object)
+			}
+		}
+
+		objectDrifts = append(objectDrifts, objectDrift)
+	}
+
+	return objectDrifts
+}
+
+// getLabelDrifts returns the drift of a label's assignment, given the managed clusters that should be assigned with
+// the label, the managed clusters that are currently assigned with the label's value and the managed clusters that
+// are currently assigned with the label and are owned by the object (e.g. with any value if the object owns the key).
+// managed clusters that the subscribed user is not authorized to access are filtered out. the desired and the current
+// managed clusters are recorded in the resource's membership and assigned membership, if tracked. returns an empty
+// slice if the label did not drift.
+func getLabelDrifts(ctx context.Context, authorizer authorizer.Authorizer, resource *gitResource, labelKey string,
+	labelValue string, desiredHubToManagedClustersMap map[string]set.Set,
+	currentHubToManagedClustersMap map[string]set.Set, ownedHubToManagedClustersMap map[string]set.Set,
+) ([]*LabelDrift, error) {
+	if resource.membership != nil {
+		resource.membership[getMembershipLabel(labelKey, labelValue)] = getHubToManagedClustersUnion(
+			desiredHubToManagedClustersMap)
+	}
+
+	if resource.assignedMembership != nil {
+		resource.assignedMembership[getMembershipLabel(labelKey, labelValue)] = getHubToManagedClustersUnion(
+			currentHubToManagedClustersMap)
+	}
+
+	hubToMissingManagedClustersMap := getHubToManagedClustersDifference(desiredHubToManagedClustersMap,
+		currentHubToManagedClustersMap)
+	hubToExtraManagedClustersMap := getHubToManagedClustersDifference(ownedHubToManagedClustersMap,
+		desiredHubToManagedClustersMap)
+
+	for _, hubToManagedClustersMap := range []map[string]set.Set{
+		hubToMissingManagedClustersMap, hubToExtraManagedClustersMap,
+	} {
+		if _, err := filterUnauthorizedManagedClusters(ctx, authorizer, resource.base64UserID,
+			resource.base64UserGroup, hubToManagedClustersMap); err != nil {
+			return nil, fmt.Errorf("failed to filter drifted managed clusters - %w", err)
+		}
+	}
+
+	if len(hubToMissingManagedClustersMap) == 0 && len(hubToExtraManagedClustersMap) == 0 {
+		return []*LabelDrift{}, nil // no drift
+	}
+
+	return []*LabelDrift{{
+		Key:                    labelKey,
+		Value:                  labelValue,
+		MissingManagedClusters: getHubToManagedClustersSlicesMap(hubToMissingManagedClustersMap),
+		ExtraManagedClusters:   getHubToManagedClustersSlicesMap(hubToExtraManagedClustersMap),
+	}}, nil
+}
+
+// correctLabelDrifts assigns the drifted labels to the missing managed clusters and removes them from the extra
+// managed clusters.
+func correctLabelDrifts(ctx context.Context, specDB db.SpecDB, resource *gitResource,
+	labelDrifts []*LabelDrift,
+) error {
+	for _, labelDrift := range labelDrifts {
+		if err := specDB.UpdateLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, labelDrift.Key,
+			labelDrift.Value, getHubToManagedClustersSetsMap(labelDrift.MissingManagedClusters),
+			getLabelsAuditInfo(resource)); err != nil {
+			return fmt.Errorf("failed to assign label %s to missing managed clusters - %w", labelDrift.Key, err)
+		}
+
+		if err := specDB.RemoveLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, labelDrift.Key,
+			getHubToManagedClustersSetsMap(labelDrift.ExtraManagedClusters), getLabelsAuditInfo(resource)); err != nil {
+			return fmt.Errorf("failed to remove label %s from extra managed clusters - %w", labelDrift.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// getHubToManagedClustersSetsMap converts a map of hub -> slice of managed clusters to a map of hub -> set of managed
+// clusters.
+func getHubToManagedClustersSetsMap(hubToManagedClustersSlicesMap map[string][]string) map[string]set.Set {
+	hubToManagedClustersMap := make(map[string]set.Set, len(hubToManagedClustersSlicesMap))
+
+	for hubName, clusters := range hubToManagedClustersSlicesMap {
+		hubToManagedClustersMap[hubName] = createSetFromSlice(clusters)
+	}
+
+	return hubToManagedClustersMap
+}
@@ -0,0 +1,249 @@
+package dbsyncer
+
+import (
+	"context"
+	"sort"
+
+	set "github.com/deckarep/golang-set"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+)
+
+// fakeSpecDB is an in-memory db.SpecDB. table names are ignored, each method operates on a single table.
+type fakeSpecDB struct {
+	// labels maps hub -> managed cluster -> labels.
+	labels map[string]map[string]map[string]string
+	// owners maps label key -> owner -> hub -> managed clusters.
+	owners map[string]map[string]map[string]set.Set
+	// syncStates maps repo name -> syncer name -> sync state.
+	syncStates map[string]map[string]*db.GitRepoSyncState
+}
+
+func newFakeSpecDB(labels map[string]map[string]map[string]string) *fakeSpecDB {
+	if labels == nil {
+		labels = make(map[string]map[string]map[string]string)
+	}
+
+	return &fakeSpecDB{
+		labels:     labels,
+		owners:     make(map[string]map[string]map[string]set.Set),
+		syncStates: make(map[string]map[string]*db.GitRepoSyncState),
+	}
+}
+
+func (specDB *fakeSpecDB) UpdateLabelForManagedClusters(_ context.Context, _ string, labelKey string,
+	labelValue string, hubToManagedClustersMap map[string]set.Set, _ *db.LabelsAuditInfo,
+) error {
+	for hubName, managedClusters := range hubToManagedClustersMap {
+		for _, managedCluster := range managedClusters.ToSlice() {
+			managedClusterName, _ := managedCluster.(string)
+
+			if specDB.labels[hubName] == nil {
+				specDB.labels[hubName] = make(map[string]map[string]string)
+			}
+
+			if specDB.labels[hubName][managedClusterName] == nil {
+				specDB.labels[hubName][managedClusterName] = make(map[string]string)
+			}
+
+			specDB.labels[hubName][managedClusterName][labelKey] = labelValue
+		}
+
+		delete(hubToManagedClustersMap, hubName)
+	}
+
+	return nil
+}
+
+func (specDB *fakeSpecDB) RemoveLabelForManagedClusters(_ context.Context, _ string, labelKey string,
+	hubToManagedClustersMap map[string]set.Set, _ *db.LabelsAuditInfo,
+) error {
+	for hubName, managedClusters := range hubToManagedClustersMap {
+		for _, managedCluster := range managedClusters.ToSlice() {
+			managedClusterName, _ := managedCluster.(string)
+			delete(specDB.labels[hubName][managedClusterName], labelKey)
+		}
+
+		delete(hubToManagedClustersMap, hubName)
+	}
+
+	return nil
+}
+
+func (specDB *fakeSpecDB) GetManagedClustersByLabel(_ context.Context, _ string, labelKey string,
+	labelValue string,
+) (map[string]set.Set, error) {
+	hubToManagedClustersMap := make(map[string]set.Set)
+
+	for hubName, managedClusterToLabelsMap := range specDB.labels {
+		for managedClusterName, labels := range managedClusterToLabelsMap {
+			if value, found := labels[labelKey]; !found || (labelValue != "" && value != labelValue) {
+				continue
+			}
+
+			if hubToManagedClustersMap[hubName] == nil {
+				hubToManagedClustersMap[hubName] = set.NewSet()
+			}
+
+			hubToManagedClustersMap[hubName].Add(managedClusterName)
+		}
+	}
+
+	return hubToManagedClustersMap, nil
+}
+
+func (specDB *fakeSpecDB) GetManagedClustersLabelsStates(_ context.Context,
+	_ string,
+) (map[string]map[string]*db.ManagedClusterLabelsState, error) {
+	hubToManagedClusterLabelsStatesMap := make(map[string]map[string]*db.ManagedClusterLabelsState)
+
+	for hubName, managedClusterToLabelsMap := range specDB.labels {
+		hubToManagedClusterLabelsStatesMap[hubName] = make(map[string]*db.ManagedClusterLabelsState)
+
+		for managedClusterName, labels := range managedClusterToLabelsMap {
+			hubToManagedClusterLabelsStatesMap[hubName][managedClusterName] = &db.ManagedClusterLabelsState{
+				LabelsMap: labels,
+			}
+		}
+	}
+
+	return hubToManagedClusterLabelsStatesMap, nil
+}
+
+func (specDB *fakeSpecDB) GetManagedClusterLabelOwners(_ context.Context, _ string,
+	labelKey string,
+) (map[string]map[string]set.Set, error) {
+	ownerToManagedClustersMap := make(map[string]map[string]set.Set)
+
+	for owner, hubToManagedClustersMap := range specDB.owners[labelKey] {
+		ownerToManagedClustersMap[owner] = getHubToManagedClustersUnion(hubToManagedClustersMap)
+	}
+
+	return ownerToManagedClustersMap, nil
+}
+
+func (specDB *fakeSpecDB) GetOwnedLabelKeys(_ context.Context, _ string, owner string) ([]string, error) {
+	labelKeys := make([]string, 0)
+
+	for labelKey, ownerToManagedClustersMap := range specDB.owners {
+		if _, found := ownerToManagedClustersMap[owner]; found {
+			labelKeys = append(labelKeys, labelKey)
+		}
+	}
+
+	sort.Strings(labelKeys)
+
+	return labelKeys, nil
+}
+
+func (specDB *fakeSpecDB) UpdateManagedClusterLabelOwner(_ context.Context, _ string, owner string,
+	labelKey string, hubToManagedClustersMap map[string]set.Set,
+) error {
+	hubToOwnedManagedClustersMap := getHubToManagedClustersDifference(hubToManagedClustersMap, nil)
+	if len(hubToOwnedManagedClustersMap) == 0 {
+		delete(specDB.owners[labelKey], owner)
+		return nil
+	}
+
+	if specDB.owners[labelKey] == nil {
+		specDB.owners[labelKey] = make(map[string]map[string]set.Set)
+	}
+
+	specDB.owners[labelKey][owner] = hubToOwnedManagedClustersMap
+
+	return nil
+}
+
+func (specDB *fakeSpecDB) GetGitRepoSyncState(_ context.Context, _ string, repoName string,
+	syncerName string,
+) (*db.GitRepoSyncState, error) {
+	if syncState, found := specDB.syncStates[repoName][syncerName]; found {
+		return syncState, nil
+	}
+
+	return &db.GitRepoSyncState{}, nil
+}
+
+func (specDB *fakeSpecDB) UpdateGitRepoSyncState(_ context.Context, _ string, repoName string, syncerName string,
+	syncState *db.GitRepoSyncState,
+) error {
+	if specDB.syncStates[repoName] == nil {
+		specDB.syncStates[repoName] = make(map[string]*db.GitRepoSyncState)
+	}
+
+	specDB.syncStates[repoName][syncerName] = syncState
+
+	return nil
+}
+
+func (specDB *fakeSpecDB) DeleteGitRepoSyncState(_ context.Context, _ string, repoName string,
+	syncerName string,
+) error {
+	delete(specDB.syncStates[repoName], syncerName)
+
+	return nil
+}
+
+func (specDB *fakeSpecDB) Stop() {}
+
+// getLabelValues returns a map of hub/managed cluster -> value of the managed clusters that are assigned with the
+// given label key.
+func (specDB *fakeSpecDB) getLabelValues(labelKey string) map[string]string {
+	managedClusterToValueMap := make(map[string]string)
+
+	for hubName, managedClusterToLabelsMap := range specDB.labels {
+		for managedClusterName, labels := range managedClusterToLabelsMap {
+			if value, found := labels[labelKey]; found {
+				managedClusterToValueMap[hubName+"/"+managedClusterName] = value
+			}
+		}
+	}
+
+	return managedClusterToValueMap
+}
+
+// fakeStatusDB is an in-memory db.StatusDB.
+type fakeStatusDB struct {
+	// labels maps hub -> managed cluster -> labels.
+	labels map[string]map[string]map[string]string
+	// labelsReads counts the reads of the managed clusters labels.
+	labelsReads int
+}
+
+func (statusDB *fakeStatusDB) GetAccessibleManagedClusters(_ context.Context, _ string,
+	_ string,
+) (map[string]set.Set, error) {
+	hubToManagedClustersMap := make(map[string]set.Set)
+
+	for hubName, managedClusterToLabelsMap := range statusDB.labels {
+		hubToManagedClustersMap[hubName] = set.NewSet()
+
+		for managedClusterName := range managedClusterToLabelsMap {
+			hubToManagedClustersMap[hubName].Add(managedClusterName)
+		}
+	}
+
+	return hubToManagedClustersMap, nil
+}
+
+func (statusDB *fakeStatusDB) GetManagedClustersLabels(_ context.Context,
+	_ string,
+) (map[string]map[string]map[string]string, error) {
+	statusDB.labelsReads++
+
+	return statusDB.labels, nil
+}
+
+func (statusDB *fakeStatusDB) Stop() {}
+
+// fakeAuthorizer authorizes access to all managed clusters but the given ones.
+type fakeAuthorizer struct {
+	// unauthorized maps hub -> managed clusters that are not accessible.
+	unauthorized map[string][]string
+}
+
+func (authorizer *fakeAuthorizer) FilterManagedClustersForUser(_ context.Context, _ string, _ []string,
+	hubToManagedClustersMap map[string]set.Set,
+) (map[string]set.Set, error) {
+	return getHubToManagedClustersIntersection(hubToManagedClustersMap,
+		getHubToManagedClustersSetsMap(authorizer.unauthorized)), nil
+}
@@ -3,114 +3,916 @@ package dbsyncer
 import (
 	"bytes"
 	"context"
-	"io"
-	"io/fs"
-	"os"
-	"path/filepath"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
 
+	set "github.com/deckarep/golang-set"
 	"github.com/go-logr/logr"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/metrics"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/tracing"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
-type syncGitResourceFunc func(ctx context.Context, base64UserID string, base64UserGroup string,
-	buf *bytes.Buffer) error
+const (
+	gitReposSyncStateDBTableName = "gitops_repos_sync_state"
+	storageToDBSyncerName        = "git-storage-to-db-syncer"
+)
+
+var errKindNotSupported = errors.New("kind is not supported")
+
+// objectParseError wraps a failure to read / parse an object, to tell it apart from a failure to apply the object.
+type objectParseError struct {
+	err error
+}
+
+func (parseErr *objectParseError) Error() string {
+	return parseErr.err.Error()
+}
+
+func (parseErr *objectParseError) Unwrap() error {
+	return parseErr.err
+}
+
+type syncGitResourceFunc func(ctx context.Context, resource *gitResource) error
+
+type deleteGitResourceFunc func(ctx context.Context, resource *gitResource) error
+
+// getReferencesFunc returns the identifiers (kind/name) of the objects of the same repo that the object in the given
+// document references.
+type getReferencesFunc func(document []byte) []string
+
+// pruneGitResourcesFunc un-deploys the objects that were synced from a git repo at a commit other than the commit of
+// the repo sync's state, and records their changes in the repo sync's plan.
+type pruneGitResourcesFunc func(ctx context.Context, repoSync *gitRepoSync) error
+
+// gitResource wraps the information of a git resource (yaml document of a file) being synced.
+type gitResource struct {
+	base64UserID    string
+	base64UserGroup string
+	// gitRepoFullPath is the path of the local git repo that contains the resource.
+	gitRepoFullPath string
+	// commitID is the ID of the commit that the resource was read at.
+	commitID string
+	// filePath is the path of the resource's file, relative to the repo root.
+	filePath string
+	// documentIndex is the index of the resource's document within its file.
+	documentIndex int
+	buf           *bytes.Buffer
+	// dryRun is set if the changes should only be computed (recorded in change) but not applied.
+	dryRun bool
+	// change records the changes that handling the resource applies.
+	change *ObjectChange
+	// repoObjects are the objects of the resource's repo that the resource may reference, at the synced commit.
+	repoObjects *repoObjects
+	// membership records the managed clusters that the resource's labels should be assigned to, as resolved by the
+	// drift detection. nil if not tracked.
+	membership membershipState
+	// assignedMembership records the managed clusters that are assigned with the resource's labels in the DB, as read
+	// by the drift detection. nil if not tracked.
+	assignedMembership membershipState
+	// managedClusters is the snapshot of the managed clusters in the status DB that the resource's dynamic identifiers
+	// are resolved against, shared by the resources of the same repo operation.
+	managedClusters *managedClustersSnapshot
+}
+
+// gitRepoSync wraps the information of a single sync (or un-deploy) of a local git repo.
+type gitRepoSync struct {
+	gitRepoFullPath string
+	// syncState is the state that the repo is synced to.
+	syncState *db.GitRepoSyncState
+	dryRun    bool
+	plan      *SyncPlan
+	// repoObjects are the objects of the repo at the commit of the sync state. nil if the repo is un-deployed.
+	repoObjects *repoObjects
+	// managedClusters is the snapshot of the managed clusters in the status DB that the dynamic identifiers of the
+	// synced objects are resolved against.
+	managedClusters *managedClustersSnapshot
+}
+
+// newGitResource returns a git resource of the given document and records its change in the sync plan.
+func (repoSync *gitRepoSync) newGitResource(commitID string, filePath string, documentIndex int, document []byte,
+	operation string,
+) *gitResource {
+	resource := &gitResource{
+		base64UserID:    repoSync.syncState.Base64UserIdentity,
+		base64UserGroup: repoSync.syncState.Base64UserGroup,
+		gitRepoFullPath: repoSync.gitRepoFullPath,
+		commitID:        commitID,
+		filePath:        filePath,
+		documentIndex:   documentIndex,
+		buf:             bytes.NewBuffer(document),
+		dryRun:          repoSync.dryRun,
+		change: &ObjectChange{
+			FilePath:      filePath,
+			DocumentIndex: documentIndex,
+			Operation:     operation,
+		},
+		managedClusters: repoSync.managedClusters,
+	}
+
+	if objectHeader := getObjectHeader(document); objectHeader != nil {
+		resource.change.Object = objectHeader.GetIdentifier()
+	}
+
+	if operation == ObjectOperationSync {
+		resource.repoObjects = repoSync.repoObjects
+	}
+
+	repoSync.plan.Changes = append(repoSync.plan.Changes, resource.change)
+
+	return resource
+}
+
+// newPruneGitResource returns a git resource of a left-over object that is identified by the given object identifier
+// and records its change in the sync plan. the returned resource has no file.
+func (repoSync *gitRepoSync) newPruneGitResource(objectIdentifier string) *gitResource {
+	resource := &gitResource{
+		base64UserID:    repoSync.syncState.Base64UserIdentity,
+		base64UserGroup: repoSync.syncState.Base64UserGroup,
+		gitRepoFullPath: repoSync.gitRepoFullPath,
+		commitID:        repoSync.syncState.CommitID,
+		buf:             &bytes.Buffer{},
+		dryRun:          repoSync.dryRun,
+		change: &ObjectChange{
+			Object:    objectIdentifier,
+			Operation: ObjectOperationPrune,
+		},
+		managedClusters: repoSync.managedClusters,
+	}
+
+	repoSync.plan.Changes = append(repoSync.plan.Changes, resource.change)
+
+	return resource
+}
+
+// wasSynced returns whether the object with the given identifier was synced by the repo sync.
+func (repoSync *gitRepoSync) wasSynced(objectIdentifier string) bool {
+	for _, change := range repoSync.plan.Changes {
+		if change.Operation == ObjectOperationSync && change.Object == objectIdentifier {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewStorageToDBSyncer returns a new instance of StorageToDBSyncer that routes each git resource to the handler
+// registered for its kind.
+func NewStorageToDBSyncer(specDB db.SpecDB, kindToHandlerMap map[string]*GitResourceHandler,
+	gitOpsMetrics *metrics.Metrics,
+) StorageToDBSyncer {
+	return &genericStorageToDBSyncer{
+		log:              ctrl.Log.WithName(storageToDBSyncerName),
+		name:             storageToDBSyncerName,
+		specDB:           specDB,
+		kindToHandlerMap: kindToHandlerMap,
+		plannedStates:    make(map[string]*db.GitRepoSyncState),
+		membershipStates: make(map[string]map[string]membershipState),
+		repoLocks:        make(map[string]*sync.Mutex),
+		metrics:          gitOpsMetrics,
+	}
+}
 
 // genericStorageToDBSyncer generalizes the handling of git storage repos.
 type genericStorageToDBSyncer struct {
-	log                 logr.Logger
-	gitRepoToCommitMap  map[string]string
-	syncGitResourceFunc syncGitResourceFunc
+	log logr.Logger
+	// name identifies the syncer in the persisted git repos sync state.
+	name             string
+	specDB           db.SpecDB
+	kindToHandlerMap map[string]*GitResourceHandler
+	// plannedStates maps local git repos to the last state that was planned (dry-run) for them.
+	plannedStates map[string]*db.GitRepoSyncState
+	// membershipStates maps local git repos to the membership of their dynamic objects (by object identifiers), as
+	// last re-evaluated. re-evaluations run concurrently with syncs, hence the lock.
+	membershipStates     map[string]map[string]membershipState
+	membershipStatesLock sync.Mutex
+	// repoLocks serialize the operations (sync, un-deploy, drift detection, re-evaluation) on each local git repo.
+	repoLocks     map[string]*sync.Mutex
+	repoLocksLock sync.Mutex
+	metrics       *metrics.Metrics
 }
 
-// SyncGitRepo operates on a local git repo to sync contained objects of managed-cluster-groups.
+// lockRepo locks the given local git repo for a single operation. returns the function that unlocks it.
+func (syncer *genericStorageToDBSyncer) lockRepo(gitRepoFullPath string) func() {
+	syncer.repoLocksLock.Lock()
+
+	repoLock, found := syncer.repoLocks[gitRepoFullPath]
+	if !found {
+		repoLock = &sync.Mutex{}
+		syncer.repoLocks[gitRepoFullPath] = repoLock
+	}
+
+	syncer.repoLocksLock.Unlock()
+
+	repoLock.Lock()
+
+	return repoLock.Unlock
+}
+
+// SyncGitRepo operates on a local git repo to sync contained objects, each by the handler registered for its kind.
+// Only files that were changed since the last synced commit are synced, unless forceReconcile is set. If dryRun is
+// set, the changes are computed but not applied (and the synced commit is not updated).
 func (syncer *genericStorageToDBSyncer) SyncGitRepo(ctx context.Context, base64UserIdentity string,
-	base64UserGroup string, gitRepoFullPath string, workPath string, forceReconcile bool,
-) bool {
+	base64UserGroup string, gitRepoFullPath string, workPath *WorkPath, forceReconcile bool, dryRun bool,
+) *SyncPlan {
+	ctx, span := tracing.StartSpan(ctx, "SyncGitRepo", trace.WithAttributes(attribute.String("repo", gitRepoFullPath),
+		attribute.Bool("force-reconcile", forceReconcile), attribute.Bool("dry-run", dryRun)))
+	defer span.End()
+
+	defer syncer.lockRepo(gitRepoFullPath)()
+
+	startTime := time.Now()
+
+	plan := syncer.syncGitRepo(ctx, base64UserIdentity, base64UserGroup, gitRepoFullPath, workPath, forceReconcile,
+		dryRun)
+	if plan != nil {
+		plan.StartTime = startTime
+		plan.Duration = time.Since(startTime)
+
+		span.SetAttributes(attribute.String("commit", plan.CommitID), attribute.Bool("full-sync", plan.FullSync))
+
+		if !plan.Succeeded() {
+			span.SetStatus(codes.Error, "failed to sync repo")
+		}
+	}
+
+	return plan
+}
+
+func (syncer *genericStorageToDBSyncer) syncGitRepo(ctx context.Context, base64UserIdentity string,
+	base64UserGroup string, gitRepoFullPath string, workPath *WorkPath, forceReconcile bool, dryRun bool,
+) *SyncPlan {
+	plan := &SyncPlan{Syncer: syncer.name, DryRun: dryRun, Changes: make([]*ObjectChange, 0)}
+
+	failFunc := func(err error, msg string, keysAndValues ...interface{}) *SyncPlan {
+		syncer.log.Error(err, msg, append([]interface{}{"root", gitRepoFullPath}, keysAndValues...)...)
+		plan.Error = fmt.Sprintf("%s - %s", msg, err.Error())
+
+		return plan
+	}
+
 	repo, err := git.PlainOpen(gitRepoFullPath)
 	if err != nil {
-		syncer.log.Error(err, "failed to open local git repo", "root", gitRepoFullPath)
-		return false
+		return failFunc(err, "failed to open local git repo")
 	}
 
 	ref, err := repo.Head()
 	if err != nil {
-		syncer.log.Error(err, "failed to open head of local git repo", "root", gitRepoFullPath)
-		return false
+		return failFunc(err, "failed to open head of local git repo")
 	}
 
 	commit, err := repo.CommitObject(ref.Hash())
 	if err != nil {
-		syncer.log.Error(err, "failed to get commit of head", "root", gitRepoFullPath)
+		return failFunc(err, "failed to get commit of head")
+	}
+
+	plan.CommitID = commit.ID().String()
+
+	syncedState, err := syncer.specDB.GetGitRepoSyncState(ctx, gitReposSyncStateDBTableName,
+		getSubscriptionName(gitRepoFullPath), syncer.name)
+	if err != nil {
+		return failFunc(err, "failed to get synced commit of local git repo")
+	}
+
+	plan.FromCommitID = syncedState.CommitID
+
+	if !forceReconcile && syncedState.CommitID == commit.ID().String() {
+		return nil // no updates
+	}
+
+	syncState := &db.GitRepoSyncState{
+		CommitID:           commit.ID().String(),
+		WorkPath:           workPath.Path,
+		Recursive:          workPath.Recursive,
+		IncludePatterns:    append([]string{}, workPath.IncludePatterns...),
+		ExcludePatterns:    append([]string{}, workPath.ExcludePatterns...),
+		Base64UserIdentity: base64UserIdentity,
+		Base64UserGroup:    base64UserGroup,
+	}
+
+	if dryRun && !forceReconcile && syncer.wasPlanned(gitRepoFullPath, syncState) {
+		return nil // no updates since last plan
+	}
+
+	formerFiles, currentFiles, fullSync, err := syncer.getChangedFiles(repo, syncedState, commit, syncState,
+		forceReconcile)
+	if err != nil {
+		return failFunc(err, "failed to get changed files of local git repo")
+	}
+
+	plan.FullSync = fullSync
+	repoSync := &gitRepoSync{
+		gitRepoFullPath: gitRepoFullPath,
+		syncState:       syncState,
+		dryRun:          dryRun,
+		plan:            plan,
+		repoObjects:     newRepoObjects(repo, syncState.CommitID, workPath),
+		managedClusters: &managedClustersSnapshot{},
+	}
+
+	// un-deploy objects that are no longer present, then sync the current ones
+	succeeded := syncer.deleteRemovedObjects(ctx, repoSync, syncedState.CommitID, formerFiles, currentFiles)
+	succeeded = syncer.syncFiles(ctx, repoSync, currentFiles) && succeeded
+
+	// objects that reference changed objects are re-synced, a full sync already synced all objects
+	if !fullSync {
+		succeeded = syncer.syncDependants(ctx, repoSync, formerFiles, currentFiles) && succeeded
+	}
+
+	if !succeeded {
+		return plan // at least one failed
+	}
+
+	// all succeeded, un-deploy left-overs that are no longer present in the fully synced repo
+	if fullSync && !syncer.pruneGitResources(ctx, repoSync) {
+		return plan
+	}
+
+	if dryRun {
+		syncer.plannedStates[gitRepoFullPath] = syncState
+
+		syncer.log.Info("planned repo", "root", gitRepoFullPath, "commit", commit.ID().String(),
+			"planned-files", len(currentFiles), "full-sync", fullSync)
+
+		return plan
+	}
+
+	if err := syncer.specDB.UpdateGitRepoSyncState(ctx, gitReposSyncStateDBTableName,
+		getSubscriptionName(gitRepoFullPath), syncer.name, syncState); err != nil {
+		return failFunc(err, "failed to update synced commit of local git repo")
+	}
+
+	delete(syncer.plannedStates, gitRepoFullPath) // plan (if any) was applied
+
+	syncer.log.Info("synced repo", "root", gitRepoFullPath, "commit", commit.ID().String(),
+		"synced-files", len(currentFiles), "full-sync", fullSync)
+
+	return plan
+}
+
+// wasPlanned returns whether the given sync state was the last one that was planned for the local git repo.
+func (syncer *genericStorageToDBSyncer) wasPlanned(gitRepoFullPath string, syncState *db.GitRepoSyncState) bool {
+	plannedState, found := syncer.plannedStates[gitRepoFullPath]
+
+	return found && plannedState.CommitID == syncState.CommitID &&
+		plannedState.Base64UserIdentity == syncState.Base64UserIdentity &&
+		plannedState.Base64UserGroup == syncState.Base64UserGroup &&
+		getWorkPath(plannedState).equals(getWorkPath(syncState))
+}
+
+// DeleteGitRepo un-deploys all objects that were synced from a local git repo by the syncer. Returns true if all
+// objects were un-deployed or if the syncer did not sync the repo.
+func (syncer *genericStorageToDBSyncer) DeleteGitRepo(ctx context.Context, gitRepoFullPath string) bool {
+	defer syncer.lockRepo(gitRepoFullPath)()
+
+	delete(syncer.plannedStates, gitRepoFullPath)
+	syncer.setMembershipStates(gitRepoFullPath, nil)
+
+	syncState, err := syncer.specDB.GetGitRepoSyncState(ctx, gitReposSyncStateDBTableName,
+		getSubscriptionName(gitRepoFullPath), syncer.name)
+	if err != nil {
+		syncer.log.Error(err, "failed to get synced commit of local git repo", "root", gitRepoFullPath)
+		return false
+	}
+
+	if syncState.CommitID == "" {
+		return true // repo was not synced by this syncer
+	}
+
+	repo, err := git.PlainOpen(gitRepoFullPath)
+	if err != nil {
+		syncer.log.Error(err, "failed to open local git repo", "root", gitRepoFullPath)
+		return false
+	}
+
+	// un-deploy the objects as they were at the last synced commit
+	files, err := getFiles(repo, syncState.CommitID, getWorkPath(syncState))
+	if err != nil {
+		syncer.log.Error(err, "failed to get synced files of local git repo", "root", gitRepoFullPath,
+			"commit", syncState.CommitID)
+		return false
+	}
+
+	// no commit is synced anymore
+	repoSync := &gitRepoSync{
+		gitRepoFullPath: gitRepoFullPath,
+		syncState: &db.GitRepoSyncState{
+			Base64UserIdentity: syncState.Base64UserIdentity,
+			Base64UserGroup:    syncState.Base64UserGroup,
+		},
+		plan: &SyncPlan{FromCommitID: syncState.CommitID, FullSync: true, Changes: make([]*ObjectChange, 0)},
+	}
+
+	if !syncer.deleteRemovedObjects(ctx, repoSync, syncState.CommitID, files, nil) {
+		return false // at least one failed
+	}
+
+	// un-deploy left-overs
+	if !syncer.pruneGitResources(ctx, repoSync) {
+		return false
+	}
+
+	if !syncer.deleteGitRepoSyncState(ctx, gitRepoFullPath) {
+		return false
+	}
+
+	syncer.log.Info("deleted repo", "root", gitRepoFullPath, "commit", syncState.CommitID)
+
+	return true
+}
+
+// pruneGitResources un-deploys left-over objects of all kinds that support it. Returns true if all succeeded.
+func (syncer *genericStorageToDBSyncer) pruneGitResources(ctx context.Context, repoSync *gitRepoSync) bool {
+	succeeded := true
+
+	for kind, handler := range syncer.kindToHandlerMap {
+		if handler.pruneGitResourcesFunc == nil {
+			continue // kind does not support pruning
+		}
+
+		if err := handler.pruneGitResourcesFunc(ctx, repoSync); err != nil {
+			syncer.log.Error(err, "failed to prune git resources of local git repo", "root",
+				repoSync.gitRepoFullPath, "kind", kind)
+
+			succeeded = false
+		}
+	}
+
+	return succeeded
+}
+
+func (syncer *genericStorageToDBSyncer) deleteGitRepoSyncState(ctx context.Context, gitRepoFullPath string) bool {
+	if err := syncer.specDB.DeleteGitRepoSyncState(ctx, gitReposSyncStateDBTableName,
+		getSubscriptionName(gitRepoFullPath), syncer.name); err != nil {
+		syncer.log.Error(err, "failed to delete synced commit of local git repo", "root", gitRepoFullPath)
 		return false
 	}
 
-	if forceReconcile {
-		syncer.gitRepoToCommitMap[gitRepoFullPath] = ""
+	return true
+}
+
+// getChangedFiles returns the former versions (at the synced commit) and the current versions (at the head commit)
+// of the files that were changed between the synced commit and the head commit. If a full sync is needed (forced, no
+// synced commit, work path changed or synced commit is not available), all files are returned and fullSync is set.
+func (syncer *genericStorageToDBSyncer) getChangedFiles(repo *git.Repository, syncedState *db.GitRepoSyncState,
+	headCommit *object.Commit, syncState *db.GitRepoSyncState, forceReconcile bool,
+) ([]*object.File, []*object.File, bool, error) {
+	currentFilesFunc := func() ([]*object.File, error) {
+		return getFiles(repo, syncState.CommitID, getWorkPath(syncState))
 	}
 
-	if syncedCommit, found := syncer.gitRepoToCommitMap[gitRepoFullPath]; !found {
-		syncedCommit = ""
-		syncer.gitRepoToCommitMap[gitRepoFullPath] = syncedCommit
-	} else if syncedCommit == commit.ID().String() {
-		return false // no updates
+	if syncedState.CommitID == "" { // never synced
+		currentFiles, err := currentFilesFunc()
+		return nil, currentFiles, true, err
 	}
 
-	if workPath != "" {
-		workPath = filepath.Join(gitRepoFullPath, workPath)
+	if forceReconcile || !getWorkPath(syncedState).equals(getWorkPath(syncState)) {
+		formerFiles, err := getFiles(repo, syncedState.CommitID, getWorkPath(syncedState))
+		if err != nil && !errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil, nil, false, err
+		}
+
+		currentFiles, err := currentFilesFunc()
+
+		return formerFiles, currentFiles, true, err
 	}
 
-	if syncer.walkGitRepo(ctx, base64UserIdentity, base64UserGroup, workPath) { // all succeeded
-		syncer.gitRepoToCommitMap[gitRepoFullPath] = commit.ID().String()
-		syncer.log.Info("synced repo", "root", gitRepoFullPath, "commit", commit.ID().String())
+	formerFiles, currentFiles, err := getDiffFiles(repo, syncedState.CommitID, headCommit, getWorkPath(syncState))
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		// history is not available (e.g. repo was re-cloned), removed objects can not be detected
+		syncer.log.Error(err, "synced commit not found in local git repo, syncing all files",
+			"commit", syncedState.CommitID)
+
+		currentFiles, err := currentFilesFunc()
 
-		return true
+		return nil, currentFiles, true, err
 	}
 
-	return false // at least one failed
+	return formerFiles, currentFiles, false, err
 }
 
-func (syncer *genericStorageToDBSyncer) walkGitRepo(ctx context.Context, base64UserIdentity string,
-	base64UserGroup string, gitRepoFullPath string,
+// syncFiles syncs the resources of the given files, that were read at the commit of the sync state.
+func (syncer *genericStorageToDBSyncer) syncFiles(ctx context.Context, repoSync *gitRepoSync,
+	files []*object.File,
 ) bool {
+	failedFilesCount := 0
+
+	for _, file := range files {
+		if !syncer.syncFile(ctx, repoSync, file) {
+			failedFilesCount++
+		}
+	}
+
+	if !repoSync.dryRun {
+		syncer.metrics.FilesSynced.Add(float64(len(files) - failedFilesCount))
+		syncer.metrics.FilesFailed.Add(float64(failedFilesCount))
+	}
+
+	return failedFilesCount == 0 // all succeeded
+}
+
+// syncFile syncs the resources of the given file, each document independently. Returns true if all succeeded.
+func (syncer *genericStorageToDBSyncer) syncFile(ctx context.Context, repoSync *gitRepoSync,
+	file *object.File,
+) bool {
+	ctx, span := tracing.StartSpan(ctx, "syncFile", trace.WithAttributes(attribute.String("file", file.Name),
+		attribute.String("commit", repoSync.syncState.CommitID)))
+	defer span.End()
+
+	documents, err := getDocuments(file)
+	if err != nil {
+		syncer.log.Error(err, "failed to read file in local git repo", "filepath", file.Name)
+		tracing.SetError(span, err)
+
+		change := &ObjectChange{FilePath: file.Name, Operation: ObjectOperationSync}
+		change.setError(&objectParseError{err: err})
+		repoSync.plan.Changes = append(repoSync.plan.Changes, change)
+
+		return false
+	}
+
+	succeeded := true
+
+	for documentIndex, document := range documents {
+		resource := repoSync.newGitResource(repoSync.syncState.CommitID, file.Name, documentIndex, document,
+			ObjectOperationSync)
+
+		kind, handler, err := syncer.getHandler(document)
+		if err == nil {
+			err = syncer.runHandlerFunc(ctx, kind, handler.syncGitResourceFunc, resource)
+		}
+
+		if err != nil {
+			syncer.log.Error(err, "failed to sync git resource in local git repo", "filepath", file.Name,
+				"document-index", documentIndex)
+
+			resource.change.setError(err)
+			tracing.SetError(span, err)
+
+			succeeded = false
+		}
+	}
+
+	return succeeded
+}
+
+// runHandlerFunc runs the given handler function of the given kind on the resource, and records the metrics of the
+// resource's applied changes. the duration and denied managed clusters are recorded per attempt, so an object that
+// keeps failing is recorded again on every retry.
+func (syncer *genericStorageToDBSyncer) runHandlerFunc(ctx context.Context, kind string,
+	handlerFunc func(ctx context.Context, resource *gitResource) error, resource *gitResource,
+) error {
+	start := time.Now()
+	err := handlerFunc(ctx, resource)
+	resource.change.Duration = time.Since(start)
+
+	if resource.dryRun {
+		return err
+	}
+
+	syncer.metrics.SyncDuration.WithLabelValues(kind).Observe(resource.change.Duration.Seconds())
+
+	labeledCount, deniedCount := 0, 0
+
+	for _, labelChange := range resource.change.LabelChanges {
+		labeledCount += getManagedClustersCount(labelChange.AssignedManagedClusters)
+		deniedCount += getManagedClustersCount(labelChange.UnauthorizedManagedClusters)
+	}
+
+	if err == nil { // labels are assigned only if succeeded
+		syncer.metrics.ManagedClustersLabeled.WithLabelValues(kind).Add(float64(labeledCount))
+	}
+
+	syncer.metrics.ManagedClustersDenied.WithLabelValues(kind).Add(float64(deniedCount))
+
+	return err
+}
+
+// deleteRemovedObjects un-deploys the objects of the given former files (read at the commit with the given ID) that
+// are not present in the given current files.
+func (syncer *genericStorageToDBSyncer) deleteRemovedObjects(ctx context.Context, repoSync *gitRepoSync,
+	commitID string, formerFiles []*object.File, currentFiles []*object.File,
+) bool {
+	if len(formerFiles) == 0 {
+		return true // nothing to un-deploy
+	}
+
+	currentObjectIdentifiers := getObjectIdentifiers(currentFiles)
+
 	successRate := 0
 
-	_ = filepath.WalkDir(gitRepoFullPath, func(path string, dirEntry fs.DirEntry, err error) error {
+	for _, file := range formerFiles {
+		documents, err := getDocuments(file)
+		if err != nil {
+			continue // nothing was synced from file
+		}
+
+		for documentIndex, document := range documents {
+			objectHeader := getObjectHeader(document)
+			if objectHeader == nil || currentObjectIdentifiers.Contains(objectHeader.GetIdentifier()) {
+				continue // nothing was synced from document or object is still present
+			}
+
+			handler, found := syncer.kindToHandlerMap[objectHeader.Kind]
+			if !found || handler.deleteGitResourceFunc == nil {
+				continue // nothing was synced from document or kind does not support un-deploying resources
+			}
+
+			resource := repoSync.newGitResource(commitID, file.Name, documentIndex, document, ObjectOperationDelete)
+
+			if err := syncer.runHandlerFunc(ctx, objectHeader.Kind, handler.deleteGitResourceFunc,
+				resource); err != nil {
+				syncer.log.Error(err, "failed to delete git resource in local git repo", "filepath", file.Name,
+					"document-index", documentIndex)
+
+				resource.change.setError(err)
+				successRate--
+
+				continue
+			}
+
+			if !repoSync.dryRun {
+				syncer.log.Info("deleted git resource", "filepath", file.Name, "document-index", documentIndex,
+					"object", objectHeader.GetIdentifier())
+			}
+		}
+	}
+
+	return successRate == 0 // all succeeded
+}
+
+// syncDependants syncs the objects of unchanged files that reference objects of the given changed files (directly or
+// through other objects), e.g. groups that are composed of a changed group, so that their references are resolved
+// again. Returns true if all succeeded.
+func (syncer *genericStorageToDBSyncer) syncDependants(ctx context.Context, repoSync *gitRepoSync,
+	formerFiles []*object.File, currentFiles []*object.File,
+) bool {
+	changedObjectIdentifiers := getObjectIdentifiers(formerFiles).Union(getObjectIdentifiers(currentFiles))
+	if changedObjectIdentifiers.Cardinality() == 0 {
+		return true // nothing is referenced
+	}
+
+	identifierToObjectMap, err := repoSync.repoObjects.getAll()
+	if err != nil {
+		syncer.log.Error(err, "failed to get objects of local git repo", "root", repoSync.gitRepoFullPath)
+		repoSync.plan.Error = fmt.Sprintf("failed to get objects of local git repo - %s", err.Error())
+
+		return false
+	}
+
+	changedFilePaths := set.NewSet()
+	for _, file := range currentFiles {
+		changedFilePaths.Add(file.Name)
+	}
+
+	dependantObjectIdentifiers := syncer.getDependants(identifierToObjectMap, changedObjectIdentifiers,
+		changedFilePaths)
+
+	succeeded := true
+
+	for _, objectIdentifier := range dependantObjectIdentifiers {
+		object := identifierToObjectMap[objectIdentifier]
+		resource := repoSync.newGitResource(repoSync.syncState.CommitID, object.filePath, object.documentIndex,
+			object.document, ObjectOperationSync)
+
+		kind, handler, err := syncer.getHandler(object.document)
+		if err == nil {
+			err = syncer.runHandlerFunc(ctx, kind, handler.syncGitResourceFunc, resource)
+		}
+
+		if err != nil {
+			syncer.log.Error(err, "failed to sync dependant git resource in local git repo", "filepath",
+				object.filePath, "document-index", object.documentIndex)
+
+			resource.change.setError(err)
+			succeeded = false
+
+			continue
+		}
+
+		if !repoSync.dryRun {
+			syncer.log.Info("synced dependant git resource", "filepath", object.filePath,
+				"document-index", object.documentIndex, "object", objectIdentifier)
+		}
+	}
+
+	return succeeded
+}
+
+// getDependants returns the sorted identifiers of the objects that reference any of the given changed objects
+// (directly or through other objects). objects of the given changed files are not included, since they are synced
+// anyway.
+func (syncer *genericStorageToDBSyncer) getDependants(identifierToObjectMap map[string]*repoObject,
+	changedObjectIdentifiers set.Set, changedFilePaths set.Set,
+) []string {
+	dependantObjectIdentifiers := make([]string, 0)
+	referencedObjectIdentifiers := changedObjectIdentifiers.Clone()
+
+	// add dependants until no other object references the changed objects or their dependants
+	for found := true; found; {
+		found = false
+
+		for objectIdentifier, object := range identifierToObjectMap {
+			if changedFilePaths.Contains(object.filePath) || referencedObjectIdentifiers.Contains(objectIdentifier) {
+				continue // synced already
+			}
+
+			if syncer.referencesAny(object.document, referencedObjectIdentifiers) {
+				dependantObjectIdentifiers = append(dependantObjectIdentifiers, objectIdentifier)
+				referencedObjectIdentifiers.Add(objectIdentifier)
+
+				found = true
+			}
+		}
+	}
+
+	sort.Strings(dependantObjectIdentifiers)
+
+	return dependantObjectIdentifiers
+}
+
+// referencesAny returns whether the object in the given document references any of the objects with the given
+// identifiers.
+func (syncer *genericStorageToDBSyncer) referencesAny(document []byte, objectIdentifiers set.Set) bool {
+	for _, referencedObjectIdentifier := range syncer.getReferences(document) {
+		if objectIdentifiers.Contains(referencedObjectIdentifier) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getReferences returns the identifiers of the objects that the object in the given document references. empty if
+// the object's kind does not reference objects.
+func (syncer *genericStorageToDBSyncer) getReferences(document []byte) []string {
+	objectHeader := getObjectHeader(document)
+	if objectHeader == nil {
+		return []string{}
+	}
+
+	handler, found := syncer.kindToHandlerMap[objectHeader.Kind]
+	if !found || handler.getReferencesFunc == nil {
+		return []string{}
+	}
+
+	return handler.getReferencesFunc(document)
+}
+
+// getHandler returns the kind of the object in the given document and the handler registered for it.
+func (syncer *genericStorageToDBSyncer) getHandler(document []byte) (string, *GitResourceHandler, error) {
+	objectHeader, err := yamltypes.NewObjectHeaderFromBytes(document)
+	if err != nil {
+		return "", nil, &objectParseError{err: fmt.Errorf("failed to get object header - %w", err)}
+	}
+
+	handler, found := syncer.kindToHandlerMap[objectHeader.Kind]
+	if !found {
+		return "", nil, &objectParseError{err: fmt.Errorf("failed to get handler of kind %s - %w",
+			objectHeader.Kind, errKindNotSupported)}
+	}
+
+	return objectHeader.Kind, handler, nil
+}
+
+// getDocuments returns the yaml documents in the given file.
+func getDocuments(file *object.File) ([][]byte, error) {
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s - %w", file.Name, err)
+	}
+
+	return yamltypes.SplitDocuments([]byte(contents)), nil
+}
+
+// getObjectIdentifiers returns a set of the identifiers of the objects in the given files.
+func getObjectIdentifiers(files []*object.File) set.Set {
+	objectIdentifiers := set.NewSet()
+
+	for _, file := range files {
+		documents, err := getDocuments(file)
 		if err != nil {
-			syncer.log.Error(err, "walkdir failed", "filepath", path)
-			return nil
+			continue // file has no objects
 		}
 
-		if dirEntry.IsDir() || filepath.Dir(path) != gitRepoFullPath {
-			return nil // for now supporting first depth only
+		for _, document := range documents {
+			if objectHeader := getObjectHeader(document); objectHeader != nil {
+				objectIdentifiers.Add(objectHeader.GetIdentifier())
+			}
 		}
+	}
+
+	return objectIdentifiers
+}
+
+// getObjectHeader returns the header of the object in the given document, or nil if the document can not be parsed.
+func getObjectHeader(document []byte) *yamltypes.ObjectHeader {
+	objectHeader, err := yamltypes.NewObjectHeaderFromBytes(document)
+	if err != nil {
+		return nil
+	}
+
+	return objectHeader
+}
+
+// getDiffFiles returns the former versions (at the commit with the given ID) and the current versions (at the given
+// head commit) of the files within workPath that were changed between the commits. Deleted files only have a former
+// version and added files only have a current version.
+func getDiffFiles(repo *git.Repository, fromCommitID string, headCommit *object.Commit,
+	workPath *WorkPath,
+) ([]*object.File, []*object.File, error) {
+	fromCommit, err := repo.CommitObject(plumbing.NewHash(fromCommitID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get commit %s - %w", fromCommitID, err)
+	}
+
+	fromTree, err := fromCommit.Tree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get tree of commit %s - %w", fromCommitID, err)
+	}
+
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get tree of head - %w", err)
+	}
+
+	changes, err := object.DiffTree(fromTree, headTree)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to diff commit %s with head - %w", fromCommitID, err)
+	}
 
-		successRate-- // all function's failure exit paths will not undo this
+	formerFiles := make([]*object.File, 0)
+	currentFiles := make([]*object.File, 0)
 
-		// open file for read
-		file, err := os.Open(path)
+	for _, change := range changes {
+		action, err := change.Action()
 		if err != nil {
-			syncer.log.Error(err, "failed to open file in local git repo", "filepath", path)
-			return nil
+			return nil, nil, fmt.Errorf("failed to get change action - %w", err)
 		}
 
-		// buffer for file
-		buf := bytes.NewBuffer(nil)
-		// copy bytes into buffer
-		if _, err := io.Copy(buf, file); err != nil {
-			syncer.log.Error(err, "failed to copy file bytes in local git repo", "filepath", path)
-			return nil
+		formerFile, currentFile, err := change.Files()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get changed files - %w", err)
+		}
+
+		if action != merkletrie.Insert && formerFile != nil && workPath.ContainsFile(change.From.Name) {
+			formerFiles = append(formerFiles, formerFile)
 		}
 
-		if err := syncer.syncGitResourceFunc(ctx, base64UserIdentity, base64UserGroup,
-			buf); err != nil {
-			syncer.log.Error(err, "failed to sync git resource in local git repo", "filepath", path)
-			return nil
+		if action != merkletrie.Delete && currentFile != nil && workPath.ContainsFile(change.To.Name) {
+			currentFiles = append(currentFiles, currentFile)
 		}
+	}
+
+	return formerFiles, currentFiles, nil
+}
 
-		successRate++ // succeeded
+// getFiles returns the files within workPath that are present in the commit with the given ID. The returned files
+// are named by their path relative to the repo root.
+func getFiles(repo *git.Repository, commitID string, workPath *WorkPath) ([]*object.File, error) {
+	commit, err := repo.CommitObject(plumbing.NewHash(commitID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s - %w", commitID, err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of commit %s - %w", commitID, err)
+	}
+
+	files := make([]*object.File, 0)
+
+	if err := tree.Files().ForEach(func(file *object.File) error {
+		if workPath.ContainsFile(file.Name) {
+			files = append(files, file)
+		}
 
 		return nil
-	})
+	}); err != nil {
+		return nil, fmt.Errorf("failed to iterate files of commit %s - %w", commitID, err)
+	}
 
-	return successRate == 0 // all succeeded
+	return files, nil
+}
+
+// getWorkPath returns the work path that the given sync state was synced from.
+func getWorkPath(syncState *db.GitRepoSyncState) *WorkPath {
+	return &WorkPath{
+		Path:            syncState.WorkPath,
+		Recursive:       syncState.Recursive,
+		IncludePatterns: syncState.IncludePatterns,
+		ExcludePatterns: syncState.ExcludePatterns,
+	}
 }
@@ -0,0 +1,234 @@
+package dbsyncer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/metrics"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testAWSLabelKey = "hub-of-hubs.open-cluster-management.io/aws"
+
+// newTestGroupDocument returns the document of a ManagedClustersGroup that identifies the given managed
+// clusters of hub1.
+func newTestGroupDocument(name string, managedClusters ...string) string {
+	return fmt.Sprintf("kind: ManagedClustersGroup\nmetadata:\n  name: %s\nspec:\n  tagValue: 'true'\n"+
+		"  identifiers:\n  - hubIdentifier:\n      name: hub1\n      managedClusterIdentifiers: [%s]\n", name,
+		strings.Join(managedClusters, ", "))
+}
+
+// newTestSetDocument returns the document of a HubOfHubsManagedClusterSet that identifies the given managed
+// clusters of hub1.
+func newTestSetDocument(name string, managedClusters ...string) string {
+	return fmt.Sprintf("kind: HubOfHubsManagedClusterSet\nmetadata:\n  name: %s\nspec:\n"+
+		"  identifiers:\n  - hubIdentifier:\n      name: hub1\n      managedClusterIdentifiers: [%s]\n", name,
+		strings.Join(managedClusters, ", "))
+}
+
+// commitTestFiles writes (or deletes, if the contents are empty) the given files in the worktree of a local git repo
+// and commits them.
+func commitTestFiles(t *testing.T, repo *git.Repository, gitRepoFullPath string, files map[string]string) {
+	t.Helper()
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree - %v", err)
+	}
+
+	for filePath, contents := range files {
+		if contents == "" {
+			if _, err := worktree.Remove(filePath); err != nil {
+				t.Fatalf("failed to remove file %s - %v", filePath, err)
+			}
+
+			continue
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(gitRepoFullPath, filePath), []byte(contents), 0o600); err != nil {
+			t.Fatalf("failed to write file %s - %v", filePath, err)
+		}
+
+		if _, err := worktree.Add(filePath); err != nil {
+			t.Fatalf("failed to add file %s - %v", filePath, err)
+		}
+	}
+
+	if _, err := worktree.Commit("update", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	}); err != nil {
+		t.Fatalf("failed to commit - %v", err)
+	}
+}
+
+func TestSyncGitRepo(t *testing.T) {
+	t.Parallel()
+
+	labelKeys := []string{testAWSLabelKey, testTierLabelKey, db.ManagedClusterSetLabelKey}
+	goldLabels := string(newTestManagedClusterLabels("gold", map[string]string{testTierLabelKey: "gold"},
+		"cluster1", "cluster2"))
+
+	tests := []struct {
+		name string
+		// commits are synced in order, each maps a file path to its contents (empty to delete the file).
+		commits        []map[string]string
+		deleteRepo     bool
+		expectedLabels map[string]map[string]string
+		// expectedManagedClusterSets are the names of the ManagedClusterSet CRs that are expected to be deployed.
+		expectedManagedClusterSets []string
+	}{
+		{
+			name: "objects of multi-document file routed by kind",
+			commits: []map[string]string{{
+				"objects.yaml": newTestGroupDocument("aws", "cluster1") + "---\n" + goldLabels + "---\n" +
+					newTestSetDocument("east", "cluster2"),
+			}},
+			expectedLabels: map[string]map[string]string{
+				testAWSLabelKey:              {"hub1/cluster1": "true"},
+				testTierLabelKey:             {"hub1/cluster1": "gold", "hub1/cluster2": "gold"},
+				db.ManagedClusterSetLabelKey: {"hub1/cluster2": "east"},
+			},
+			expectedManagedClusterSets: []string{"east"},
+		},
+		{
+			name: "labels removed when file is deleted",
+			commits: []map[string]string{
+				{"groups.yaml": newTestGroupDocument("aws", "cluster1"), "labels.yaml": goldLabels},
+				{"labels.yaml": ""},
+			},
+			expectedLabels: map[string]map[string]string{
+				testAWSLabelKey:              {"hub1/cluster1": "true"},
+				testTierLabelKey:             {},
+				db.ManagedClusterSetLabelKey: {},
+			},
+		},
+		{
+			name: "labels removed when identifiers shrink",
+			commits: []map[string]string{
+				{"objects.yaml": newTestGroupDocument("aws", "cluster1", "cluster2") + "---\n" + goldLabels},
+				{
+					"objects.yaml": newTestGroupDocument("aws", "cluster2") + "---\n" +
+						string(newTestManagedClusterLabels("gold", map[string]string{testTierLabelKey: "gold"},
+							"cluster1")),
+				},
+			},
+			expectedLabels: map[string]map[string]string{
+				testAWSLabelKey:              {"hub1/cluster2": "true"},
+				testTierLabelKey:             {"hub1/cluster1": "gold"},
+				db.ManagedClusterSetLabelKey: {},
+			},
+		},
+		{
+			name: "objects un-deployed when subscription is deleted",
+			commits: []map[string]string{{
+				"groups.yaml": newTestGroupDocument("aws", "cluster1"),
+				"labels.yaml": goldLabels,
+				"sets.yaml":   newTestSetDocument("east", "cluster2"),
+			}},
+			deleteRepo: true,
+			expectedLabels: map[string]map[string]string{
+				testAWSLabelKey:              {},
+				testTierLabelKey:             {},
+				db.ManagedClusterSetLabelKey: {},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			gitRepoFullPath := filepath.Join(t.TempDir(), "subscription")
+			if err := os.Mkdir(gitRepoFullPath, 0o700); err != nil {
+				t.Fatalf("failed to create repo directory - %v", err)
+			}
+
+			repo, err := git.PlainInit(gitRepoFullPath, false)
+			if err != nil {
+				t.Fatalf("failed to init repo - %v", err)
+			}
+
+			scheme := runtime.NewScheme()
+			if err := clusterv1beta1.AddToScheme(scheme); err != nil {
+				t.Fatalf("failed to create scheme - %v", err)
+			}
+
+			gitOpsMetrics, err := metrics.NewMetrics(prometheus.NewRegistry())
+			if err != nil {
+				t.Fatalf("failed to create metrics - %v", err)
+			}
+
+			specDB := newFakeSpecDB(nil)
+			statusDB := &fakeStatusDB{}
+			k8sClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+			syncer := NewStorageToDBSyncer(specDB, map[string]*GitResourceHandler{
+				yamltypes.ManagedClustersGroupKind: NewManagedClustersGroupHandler(specDB, statusDB, &fakeAuthorizer{}),
+				yamltypes.ManagedClusterSetKind: NewManagedClusterSetHandler(specDB, statusDB, k8sClient,
+					&fakeAuthorizer{}),
+				yamltypes.ManagedClusterLabelsKind: NewManagedClusterLabelsHandler(specDB, statusDB,
+					&fakeAuthorizer{}),
+			}, gitOpsMetrics)
+
+			for i, files := range test.commits {
+				commitTestFiles(t, repo, gitRepoFullPath, files)
+
+				plan := syncer.SyncGitRepo(ctx, "", "", gitRepoFullPath, &WorkPath{}, false, false)
+				if plan == nil || !plan.Succeeded() {
+					t.Fatalf("failed to sync commit %d - %+v", i, plan)
+				}
+			}
+
+			if test.deleteRepo {
+				if !syncer.DeleteGitRepo(ctx, gitRepoFullPath) {
+					t.Fatalf("failed to delete repo")
+				}
+
+				if syncState := specDB.syncStates["subscription"][storageToDBSyncerName]; syncState != nil {
+					t.Fatalf("expected sync state to be deleted, got %+v", syncState)
+				}
+			}
+
+			for _, labelKey := range labelKeys {
+				if actual := specDB.getLabelValues(labelKey); !reflect.DeepEqual(actual,
+					test.expectedLabels[labelKey]) {
+					t.Fatalf("expected %s labels %v, got %v", labelKey, test.expectedLabels[labelKey], actual)
+				}
+			}
+
+			managedClusterSetCRs := &clusterv1beta1.ManagedClusterSetList{}
+			if err := k8sClient.List(ctx, managedClusterSetCRs); err != nil {
+				t.Fatalf("failed to list ManagedClusterSets - %v", err)
+			}
+
+			managedClusterSets := make([]string, 0, len(managedClusterSetCRs.Items))
+			for _, managedClusterSetCR := range managedClusterSetCRs.Items {
+				managedClusterSets = append(managedClusterSets, managedClusterSetCR.Name)
+			}
+
+			if len(managedClusterSets) != len(test.expectedManagedClusterSets) ||
+				(len(managedClusterSets) != 0 && !reflect.DeepEqual(managedClusterSets,
+					test.expectedManagedClusterSets)) {
+				t.Fatalf("expected ManagedClusterSets %v, got %v", test.expectedManagedClusterSets,
+					managedClusterSets)
+			}
+		})
+	}
+}
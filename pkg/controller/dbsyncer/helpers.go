@@ -1,7 +1,15 @@
 package dbsyncer
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+
 	set "github.com/deckarep/golang-set"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/authorizer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
 )
 
 // createSetFromSlice returns a set contains all items in the given slice. if slice is nil, returns empty set.
@@ -18,3 +26,197 @@ func createSetFromSlice(slice []string) set.Set {
 
 	return result
 }
+
+// getSubscriptionName returns the name of the subscription that a local git repo belongs to. repos are stored in
+// directories named by their subscriptions.
+func getSubscriptionName(gitRepoFullPath string) string {
+	return filepath.Base(gitRepoFullPath)
+}
+
+// getLabelsAuditInfo returns the audit info of label changes made by syncing (or deleting) the given git resource.
+func getLabelsAuditInfo(resource *gitResource) *db.LabelsAuditInfo {
+	// get decoded identity - assuming correctness because annotated by operator
+	userID, _ := base64.StdEncoding.DecodeString(resource.base64UserID)
+	userGroup, _ := base64.StdEncoding.DecodeString(resource.base64UserGroup)
+
+	return &db.LabelsAuditInfo{
+		UserIdentity: string(userID),
+		UserGroup:    string(userGroup),
+		RepoPath:     resource.gitRepoFullPath,
+		CommitID:     resource.commitID,
+		FilePath:     resource.filePath,
+	}
+}
+
+// managedClustersSnapshot holds the managed clusters in the status DB, read once per repo operation (sync, drift
+// detection or re-evaluation), so that the dynamic identifiers of all the objects are resolved against the same
+// managed clusters and the status DB is not scanned per object.
+type managedClustersSnapshot struct {
+	// hubToManagedClusterLabelsMap maps hub -> managed cluster -> labels, nil until read.
+	hubToManagedClusterLabelsMap map[string]map[string]map[string]string
+}
+
+// getManagedClustersLabels returns a map of hub -> managed cluster -> labels of the managed clusters in the status DB,
+// read on the first call. a nil snapshot reads the status DB on every call.
+func (snapshot *managedClustersSnapshot) getManagedClustersLabels(ctx context.Context,
+	statusDB db.StatusDB,
+) (map[string]map[string]map[string]string, error) {
+	if snapshot != nil && snapshot.hubToManagedClusterLabelsMap != nil {
+		return snapshot.hubToManagedClusterLabelsMap, nil
+	}
+
+	hubToManagedClusterLabelsMap, err := statusDB.GetManagedClustersLabels(ctx, managedClustersStatusDBTableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed clusters from status DB - %w", err)
+	}
+
+	if snapshot != nil {
+		snapshot.hubToManagedClusterLabelsMap = hubToManagedClusterLabelsMap
+	}
+
+	return hubToManagedClusterLabelsMap, nil
+}
+
+// getHubToManagedClustersMap returns a map of hub -> set of managed clusters identified by the given identifiers.
+// identifiers of the same hub are merged. identifiers with a hub name pattern or a managed cluster selector are
+// resolved against the given snapshot of the managed clusters in the status DB.
+func getHubToManagedClustersMap(ctx context.Context, statusDB db.StatusDB, managedClusters *managedClustersSnapshot,
+	identifiers []map[string]yamltypes.HubIdentifier,
+) (map[string]set.Set, error) {
+	var hubToManagedClusterLabelsMap map[string]map[string]map[string]string
+
+	if yamltypes.IdentifiersAreDynamic(identifiers) {
+		statusHubToManagedClusterLabelsMap, err := managedClusters.getManagedClustersLabels(ctx, statusDB)
+		if err != nil {
+			return nil, err
+		}
+
+		hubToManagedClusterLabelsMap = statusHubToManagedClusterLabelsMap
+	}
+
+	hubToManagedClustersSliceMap, err := yamltypes.GetHubToManagedClustersMap(identifiers,
+		hubToManagedClusterLabelsMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve identifiers - %w", err)
+	}
+
+	hubToManagedClustersMap := make(map[string]set.Set, len(hubToManagedClustersSliceMap))
+	for hubName, managedClusters := range hubToManagedClustersSliceMap {
+		hubToManagedClustersMap[hubName] = createSetFromSlice(managedClusters)
+	}
+
+	return hubToManagedClustersMap, nil
+}
+
+// getHubToManagedClustersDifference returns a map of hub -> set of managed clusters that are present in the base map
+// but are not present in the subtrahend map. hubs with no remaining managed clusters are omitted.
+func getHubToManagedClustersDifference(base map[string]set.Set,
+	subtrahend map[string]set.Set,
+) map[string]set.Set {
+	difference := make(map[string]set.Set, len(base))
+
+	for hubName, clustersSet := range base {
+		remainingClustersSet := clustersSet.Clone()
+
+		if subtrahendClustersSet, found := subtrahend[hubName]; found {
+			remainingClustersSet = remainingClustersSet.Difference(subtrahendClustersSet)
+		}
+
+		if remainingClustersSet.Cardinality() == 0 {
+			continue
+		}
+
+		difference[hubName] = remainingClustersSet
+	}
+
+	return difference
+}
+
+// getHubToManagedClustersUnion returns a map of hub -> set of managed clusters that are present in any of the given
+// maps.
+func getHubToManagedClustersUnion(hubToManagedClustersMaps ...map[string]set.Set) map[string]set.Set {
+	union := make(map[string]set.Set)
+
+	for _, hubToManagedClustersMap := range hubToManagedClustersMaps {
+		for hubName, clustersSet := range hubToManagedClustersMap {
+			if unionClustersSet, found := union[hubName]; found {
+				union[hubName] = unionClustersSet.Union(clustersSet)
+				continue
+			}
+
+			union[hubName] = clustersSet.Clone()
+		}
+	}
+
+	return union
+}
+
+// getHubToManagedClustersIntersection returns a map of hub -> set of managed clusters that are present in all of the
+// given maps. hubs with no common managed clusters are omitted.
+func getHubToManagedClustersIntersection(hubToManagedClustersMaps ...map[string]set.Set) map[string]set.Set {
+	intersection := make(map[string]set.Set)
+
+	if len(hubToManagedClustersMaps) == 0 {
+		return intersection
+	}
+
+	for hubName, clustersSet := range hubToManagedClustersMaps[0] {
+		intersectionClustersSet := clustersSet.Clone()
+
+		for _, hubToManagedClustersMap := range hubToManagedClustersMaps[1:] {
+			otherClustersSet, found := hubToManagedClustersMap[hubName]
+			if !found {
+				intersectionClustersSet = set.NewSet()
+				break
+			}
+
+			intersectionClustersSet = intersectionClustersSet.Intersect(otherClustersSet)
+		}
+
+		if intersectionClustersSet.Cardinality() == 0 {
+			continue
+		}
+
+		intersection[hubName] = intersectionClustersSet
+	}
+
+	return intersection
+}
+
+// filterUnauthorizedManagedClusters removes the managed clusters that the subscribed user is not authorized to access
+// from the given hub -> set of managed clusters map. returns a map of hub -> set of the removed managed clusters.
+func filterUnauthorizedManagedClusters(ctx context.Context, authorizer authorizer.Authorizer, base64UserID string,
+	base64UserGroup string, hubToManagedClustersMap map[string]set.Set,
+) (map[string]set.Set, error) {
+	hubToUnauthorizedManagedClustersMap := make(map[string]set.Set)
+
+	if len(hubToManagedClustersMap) == 0 {
+		return hubToUnauthorizedManagedClustersMap, nil // nothing to filter
+	}
+
+	// get decoded identity - assuming correctness because annotated by operator
+	userID, _ := base64.StdEncoding.DecodeString(base64UserID)
+	userGroup, _ := base64.StdEncoding.DecodeString(base64UserGroup)
+
+	// get unauthorized managed clusters for subscribed user
+	unauthorizedHubToManagedClustersMap, err := authorizer.FilterManagedClustersForUser(ctx, string(userID),
+		[]string{string(userGroup)}, hubToManagedClustersMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter by authorization - %w", err)
+	}
+
+	for hubName, clustersSet := range unauthorizedHubToManagedClustersMap {
+		if len(clustersSet.ToSlice()) == 0 {
+			continue // means all good
+		}
+
+		hubToUnauthorizedManagedClustersMap[hubName] = clustersSet
+
+		hubToManagedClustersMap[hubName] = hubToManagedClustersMap[hubName].Difference(clustersSet) // remove them
+		if len(hubToManagedClustersMap[hubName].ToSlice()) == 0 {
+			delete(hubToManagedClustersMap, hubName)
+		}
+	}
+
+	return hubToUnauthorizedManagedClustersMap, nil
+}
@@ -0,0 +1,78 @@
+package dbsyncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
+)
+
+func TestGetHubToManagedClustersMapSnapshot(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	statusDB := &fakeStatusDB{labels: map[string]map[string]map[string]string{
+		"hub1": {"cluster1": {"cloud": "aws"}, "cluster2": {"cloud": "gcp"}},
+	}}
+
+	staticIdentifiers := []map[string]yamltypes.HubIdentifier{
+		{"hub": {Name: "hub1", ManagedClusterIDs: []string{"cluster3"}}},
+	}
+	dynamicIdentifiers := []map[string]yamltypes.HubIdentifier{
+		{"hub": {NamePattern: "hub*", ManagedClusterSelector: &yamltypes.ManagedClusterSelector{
+			MatchLabels: map[string]string{"cloud": "aws"},
+		}}},
+	}
+
+	tests := []struct {
+		name                string
+		managedClusters     *managedClustersSnapshot
+		identifiers         [][]map[string]yamltypes.HubIdentifier
+		expected            map[string][]string
+		expectedLabelsReads int
+	}{
+		{
+			name:                "static identifiers are not resolved",
+			managedClusters:     &managedClustersSnapshot{},
+			identifiers:         [][]map[string]yamltypes.HubIdentifier{staticIdentifiers},
+			expected:            map[string][]string{"hub1": {"cluster3"}},
+			expectedLabelsReads: 0,
+		},
+		{
+			name:                "snapshot is read once",
+			managedClusters:     &managedClustersSnapshot{},
+			identifiers:         [][]map[string]yamltypes.HubIdentifier{dynamicIdentifiers, dynamicIdentifiers},
+			expected:            map[string][]string{"hub1": {"cluster1"}},
+			expectedLabelsReads: 1,
+		},
+		{
+			name:                "no snapshot",
+			identifiers:         [][]map[string]yamltypes.HubIdentifier{dynamicIdentifiers, dynamicIdentifiers},
+			expected:            map[string][]string{"hub1": {"cluster1"}},
+			expectedLabelsReads: 2,
+		},
+	}
+
+	// tests share the status DB reads counter
+	for _, test := range tests {
+		statusDB.labelsReads = 0
+
+		for _, identifiers := range test.identifiers {
+			actual, err := getHubToManagedClustersMap(ctx, statusDB, test.managedClusters, identifiers)
+			if err != nil {
+				t.Fatalf("%s: failed to get managed clusters - %v", test.name, err)
+			}
+
+			if actualSlicesMap := getHubToManagedClustersSlicesMap(actual); !reflect.DeepEqual(actualSlicesMap,
+				test.expected) {
+				t.Fatalf("%s: expected %v, got %v", test.name, test.expected, actualSlicesMap)
+			}
+		}
+
+		if statusDB.labelsReads != test.expectedLabelsReads {
+			t.Fatalf("%s: expected %d status DB reads, got %d", test.name, test.expectedLabelsReads,
+				statusDB.labelsReads)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package dbsyncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	set "github.com/deckarep/golang-set"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/authorizer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
+)
+
+// managedClusterLabelOwnersDBTableName is the table of the managed clusters that each ManagedClusterLabels object
+// assigned with each of its label keys.
+const managedClusterLabelOwnersDBTableName = "gitops_managed_clusters_label_owners"
+
+var errLabelKeyCollision = errors.New("label key collides with the label key of a managed clusters group")
+
+// NewManagedClusterLabelsHandler returns a new instance of GitResourceHandler for ManagedClusterLabels resources.
+// the managed clusters that the object assigned with each label are recorded as owned by the object, i.e. owned
+// managed clusters that are no longer identified by the object have the label removed, unless another object owns
+// the label key on them too.
+func NewManagedClusterLabelsHandler(specDB db.SpecDB, statusDB db.StatusDB,
+	rbacAuthorizer authorizer.Authorizer,
+) *GitResourceHandler {
+	return &GitResourceHandler{
+		syncGitResourceFunc: func(ctx context.Context, resource *gitResource) error {
+			return syncManagedClusterLabels(ctx, specDB, statusDB, rbacAuthorizer, resource)
+		},
+		deleteGitResourceFunc: func(ctx context.Context, resource *gitResource) error {
+			return deleteManagedClusterLabels(ctx, specDB, rbacAuthorizer, resource)
+		},
+		detectDriftFunc: func(ctx context.Context, resource *gitResource) ([]*LabelDrift, error) {
+			return detectManagedClusterLabelsDrift(ctx, specDB, statusDB, rbacAuthorizer, resource)
+		},
+		correctDriftFunc: func(ctx context.Context, resource *gitResource, labelDrifts []*LabelDrift) error {
+			return correctManagedClusterLabelsDrift(ctx, specDB, resource, labelDrifts)
+		},
+	}
+}
+
+// getManagedClusterLabelsOwner returns the owner (subscription/kind/name) of the labels that a ManagedClusterLabels
+// object of the given resource's repo assigns.
+func getManagedClusterLabelsOwner(resource *gitResource, managedClusterLabels *yamltypes.ManagedClusterLabels) string {
+	return fmt.Sprintf("%s/%s/%s", getSubscriptionName(resource.gitRepoFullPath), yamltypes.ManagedClusterLabelsKind,
+		managedClusterLabels.Metadata.Name)
+}
+
+// validateManagedClusterLabelKeys fails if any of the given label keys is the label key of a ManagedClustersGroup of
+// the resource's repo, since the group would remove the label from the managed clusters that it does not identify.
+func validateManagedClusterLabelKeys(resource *gitResource, labelKeys []string) error {
+	for _, labelKey := range labelKeys {
+		groupIdentifier := fmt.Sprintf("%s/%s", yamltypes.ManagedClustersGroupKind,
+			strings.TrimPrefix(labelKey, fmt.Sprintf("%s/", db.HubOfHubsGroup)))
+
+		if _, err := resource.repoObjects.get(groupIdentifier); err == nil {
+			return fmt.Errorf("%w: %s, the key is assigned by %s", errLabelKeyCollision, labelKey, groupIdentifier)
+		}
+	}
+
+	return nil
+}
+
+// getHubToOwnedManagedClustersMaps returns the managed clusters that the given owner assigned with a label key and
+// the managed clusters that other owners assigned with it.
+func getHubToOwnedManagedClustersMaps(ctx context.Context, specDB db.SpecDB, owner string,
+	labelKey string,
+) (map[string]set.Set, map[string]set.Set, error) {
+	ownerToManagedClustersMap, err := specDB.GetManagedClusterLabelOwners(ctx, managedClusterLabelOwnersDBTableName,
+		labelKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get owners of label %s - %w", labelKey, err)
+	}
+
+	hubToOthersManagedClustersMap := make(map[string]set.Set)
+
+	for labelOwner, hubToManagedClustersMap := range ownerToManagedClustersMap {
+		if labelOwner != owner {
+			hubToOthersManagedClustersMap = getHubToManagedClustersUnion(hubToOthersManagedClustersMap,
+				hubToManagedClustersMap)
+		}
+	}
+
+	return getHubToManagedClustersUnion(ownerToManagedClustersMap[owner]), hubToOthersManagedClustersMap, nil
+}
+
+func syncManagedClusterLabels(ctx context.Context, specDB db.SpecDB, statusDB db.StatusDB,
+	authorizer authorizer.Authorizer, resource *gitResource,
+) error {
+	managedClusterLabels, err := yamltypes.NewManagedClusterLabelsFromBytes(resource.buf.Bytes())
+	if err != nil {
+		return &objectParseError{err: fmt.Errorf("failed to create managed cluster labels - %w", err)}
+	}
+
+	if err := validateManagedClusterLabelKeys(resource, managedClusterLabels.GetLabelKeys()); err != nil {
+		return &objectParseError{err: fmt.Errorf("failed to create managed cluster labels - %w", err)}
+	}
+
+	hubToIdentifiedManagedClustersMap, err := getHubToManagedClustersMap(ctx, statusDB, resource.managedClusters,
+		managedClusterLabels.Spec.Identifiers)
+	if err != nil {
+		return fmt.Errorf("failed to update managed cluster labels - %w", err)
+	}
+
+	// filter out unauthorized managed clusters for subscribed user
+	hubToManagedClustersMap := getHubToManagedClustersUnion(hubToIdentifiedManagedClustersMap)
+
+	hubToUnauthorizedManagedClustersMap, err := filterUnauthorizedManagedClusters(ctx, authorizer,
+		resource.base64UserID, resource.base64UserGroup, hubToManagedClustersMap)
+	if err != nil {
+		return fmt.Errorf("failed to update managed cluster labels - %w", err)
+	}
+
+	owner := getManagedClusterLabelsOwner(resource, managedClusterLabels)
+	labels := managedClusterLabels.GetLabels()
+
+	for _, labelKey := range managedClusterLabels.GetLabelKeys() {
+		if err := syncManagedClusterLabel(ctx, specDB, authorizer, resource, owner, labelKey, labels[labelKey],
+			hubToIdentifiedManagedClustersMap, getHubToManagedClustersUnion(hubToManagedClustersMap),
+			hubToUnauthorizedManagedClustersMap); err != nil {
+			return fmt.Errorf("failed to update managed cluster labels - %w", err)
+		}
+	}
+
+	// remove the labels whose keys were removed from the object
+	ownedLabelKeys, err := specDB.GetOwnedLabelKeys(ctx, managedClusterLabelOwnersDBTableName, owner)
+	if err != nil {
+		return fmt.Errorf("failed to update managed cluster labels - %w", err)
+	}
+
+	for _, labelKey := range ownedLabelKeys {
+		if _, found := labels[labelKey]; found {
+			continue
+		}
+
+		if err := removeManagedClusterLabel(ctx, specDB, authorizer, resource, owner, labelKey); err != nil {
+			return fmt.Errorf("failed to update managed cluster labels - %w", err)
+		}
+	}
+
+	return nil
+}
+
+// syncManagedClusterLabel assigns a label to the given (authorized) managed clusters and removes it from the managed
+// clusters that the owner assigned with it but are no longer identified by the object, unless other owners assigned
+// it to them too. hubToManagedClustersMap is consumed.
+func syncManagedClusterLabel(ctx context.Context, specDB db.SpecDB, authorizer authorizer.Authorizer,
+	resource *gitResource, owner string, labelKey string, labelValue string,
+	hubToIdentifiedManagedClustersMap map[string]set.Set, hubToManagedClustersMap map[string]set.Set,
+	hubToUnauthorizedManagedClustersMap map[string]set.Set,
+) error {
+	hubToOwnedManagedClustersMap, hubToOthersManagedClustersMap, err := getHubToOwnedManagedClustersMaps(ctx, specDB,
+		owner, labelKey)
+	if err != nil {
+		return err
+	}
+
+	hubToRemovedManagedClustersMap := getHubToManagedClustersDifference(getHubToManagedClustersDifference(
+		hubToOwnedManagedClustersMap, hubToIdentifiedManagedClustersMap), hubToOthersManagedClustersMap)
+
+	hubToUnauthorizedRemovedManagedClustersMap, err := filterUnauthorizedManagedClusters(ctx, authorizer,
+		resource.base64UserID, resource.base64UserGroup, hubToRemovedManagedClustersMap)
+	if err != nil {
+		return fmt.Errorf("failed to filter managed clusters of label %s - %w", labelKey, err)
+	}
+
+	resource.change.addLabelChange(labelKey, labelValue, hubToManagedClustersMap, hubToRemovedManagedClustersMap,
+		getHubToManagedClustersUnion(hubToUnauthorizedManagedClustersMap, hubToUnauthorizedRemovedManagedClustersMap))
+
+	if resource.dryRun {
+		return nil
+	}
+
+	// the owner keeps the assigned managed clusters and the ones it was not authorized to remove the label from
+	hubToNewOwnedManagedClustersMap := getHubToManagedClustersUnion(hubToManagedClustersMap,
+		getHubToManagedClustersIntersection(hubToOwnedManagedClustersMap, hubToIdentifiedManagedClustersMap),
+		hubToUnauthorizedRemovedManagedClustersMap)
+
+	if err := specDB.UpdateLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, labelKey, labelValue,
+		hubToManagedClustersMap, getLabelsAuditInfo(resource)); err != nil {
+		return fmt.Errorf("failed to assign label %s - %w", labelKey, err)
+	}
+
+	if err := specDB.RemoveLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, labelKey,
+		hubToRemovedManagedClustersMap, getLabelsAuditInfo(resource)); err != nil {
+		return fmt.Errorf("failed to remove label %s - %w", labelKey, err)
+	}
+
+	if err := specDB.UpdateManagedClusterLabelOwner(ctx, managedClusterLabelOwnersDBTableName, owner, labelKey,
+		hubToNewOwnedManagedClustersMap); err != nil {
+		return fmt.Errorf("failed to update owner of label %s - %w", labelKey, err)
+	}
+
+	return nil
+}
+
+// removeManagedClusterLabel removes a label key from the managed clusters that the owner assigned with it, unless
+// other owners assigned it to them too.
+func removeManagedClusterLabel(ctx context.Context, specDB db.SpecDB, authorizer authorizer.Authorizer,
+	resource *gitResource, owner string, labelKey string,
+) error {
+	hubToOwnedManagedClustersMap, hubToOthersManagedClustersMap, err := getHubToOwnedManagedClustersMaps(ctx, specDB,
+		owner, labelKey)
+	if err != nil {
+		return err
+	}
+
+	hubToRemovedManagedClustersMap := getHubToManagedClustersDifference(hubToOwnedManagedClustersMap,
+		hubToOthersManagedClustersMap)
+
+	// filter out unauthorized managed clusters for subscribed user
+	hubToUnauthorizedManagedClustersMap, err := filterUnauthorizedManagedClusters(ctx, authorizer,
+		resource.base64UserID, resource.base64UserGroup, hubToRemovedManagedClustersMap)
+	if err != nil {
+		return fmt.Errorf("failed to filter managed clusters of label %s - %w", labelKey, err)
+	}
+
+	resource.change.addLabelChange(labelKey, "", nil, hubToRemovedManagedClustersMap,
+		hubToUnauthorizedManagedClustersMap)
+
+	if resource.dryRun {
+		return nil
+	}
+
+	if err := specDB.RemoveLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, labelKey,
+		hubToRemovedManagedClustersMap, getLabelsAuditInfo(resource)); err != nil {
+		return fmt.Errorf("failed to remove label %s - %w", labelKey, err)
+	}
+
+	// the owner keeps the managed clusters that it was not authorized to remove the label from
+	if err := specDB.UpdateManagedClusterLabelOwner(ctx, managedClusterLabelOwnersDBTableName, owner, labelKey,
+		hubToUnauthorizedManagedClustersMap); err != nil {
+		return fmt.Errorf("failed to update owner of label %s - %w", labelKey, err)
+	}
+
+	return nil
+}
+
+// deleteManagedClusterLabels removes the labels of the object from the managed clusters that the object assigned them
+// to, unless other objects assigned them too.
+func deleteManagedClusterLabels(ctx context.Context, specDB db.SpecDB, authorizer authorizer.Authorizer,
+	resource *gitResource,
+) error {
+	managedClusterLabels, err := yamltypes.NewManagedClusterLabelsFromBytes(resource.buf.Bytes())
+	if err != nil {
+		return &objectParseError{err: fmt.Errorf("failed to create managed cluster labels - %w", err)}
+	}
+
+	owner := getManagedClusterLabelsOwner(resource, managedClusterLabels)
+
+	ownedLabelKeys, err := specDB.GetOwnedLabelKeys(ctx, managedClusterLabelOwnersDBTableName, owner)
+	if err != nil {
+		return fmt.Errorf("failed to delete managed cluster labels - %w", err)
+	}
+
+	for _, labelKey := range ownedLabelKeys {
+		if err := removeManagedClusterLabel(ctx, specDB, authorizer, resource, owner, labelKey); err != nil {
+			return fmt.Errorf("failed to delete managed cluster labels - %w", err)
+		}
+	}
+
+	return nil
+}
+
+// detectManagedClusterLabelsDrift returns the drifts of the object's labels. only the managed clusters that the object
+// assigned with a label (and no other object did) are owned.
+func detectManagedClusterLabelsDrift(ctx context.Context, specDB db.SpecDB, statusDB db.StatusDB,
+	authorizer authorizer.Authorizer, resource *gitResource,
+) ([]*LabelDrift, error) {
+	managedClusterLabels, err := yamltypes.NewManagedClusterLabelsFromBytes(resource.buf.Bytes())
+	if err != nil {
+		return nil, &objectParseError{err: fmt.Errorf("failed to create managed cluster labels - %w", err)}
+	}
+
+	hubToDesiredManagedClustersMap, err := getHubToManagedClustersMap(ctx, statusDB, resource.managedClusters,
+		managedClusterLabels.Spec.Identifiers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect drift of managed cluster labels - %w", err)
+	}
+
+	owner := getManagedClusterLabelsOwner(resource, managedClusterLabels)
+	labels := managedClusterLabels.GetLabels()
+	labelDrifts := make([]*LabelDrift, 0)
+
+	for _, labelKey := range managedClusterLabels.GetLabelKeys() {
+		hubToCurrentManagedClustersMap, err := specDB.GetManagedClustersByLabel(ctx,
+			managedClusterLabelsDBTableName, labelKey, labels[labelKey])
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect drift of managed cluster labels - %w", err)
+		}
+
+		hubToOwnedManagedClustersMap, hubToOthersManagedClustersMap, err := getHubToOwnedManagedClustersMaps(ctx,
+			specDB, owner, labelKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect drift of managed cluster labels - %w", err)
+		}
+
+		drifts, err := getLabelDrifts(ctx, authorizer, resource, labelKey, labels[labelKey],
+			hubToDesiredManagedClustersMap, hubToCurrentManagedClustersMap,
+			getHubToManagedClustersDifference(hubToOwnedManagedClustersMap, hubToOthersManagedClustersMap))
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect drift of managed cluster labels - %w", err)
+		}
+
+		labelDrifts = append(labelDrifts, drifts...)
+	}
+
+	return labelDrifts, nil
+}
+
+// correctManagedClusterLabelsDrift corrects the drifts of the object's labels and records the managed clusters that
+// the labels were assigned to / removed from as owned / not owned by the object.
+func correctManagedClusterLabelsDrift(ctx context.Context, specDB db.SpecDB, resource *gitResource,
+	labelDrifts []*LabelDrift,
+) error {
+	managedClusterLabels, err := yamltypes.NewManagedClusterLabelsFromBytes(resource.buf.Bytes())
+	if err != nil {
+		return &objectParseError{err: fmt.Errorf("failed to create managed cluster labels - %w", err)}
+	}
+
+	if err := correctLabelDrifts(ctx, specDB, resource, labelDrifts); err != nil {
+		return err
+	}
+
+	owner := getManagedClusterLabelsOwner(resource, managedClusterLabels)
+
+	for _, labelDrift := range labelDrifts {
+		hubToOwnedManagedClustersMap, _, err := getHubToOwnedManagedClustersMaps(ctx, specDB, owner, labelDrift.Key)
+		if err != nil {
+			return err
+		}
+
+		if err := specDB.UpdateManagedClusterLabelOwner(ctx, managedClusterLabelOwnersDBTableName, owner,
+			labelDrift.Key, getHubToManagedClustersDifference(getHubToManagedClustersUnion(
+				hubToOwnedManagedClustersMap, getHubToManagedClustersSetsMap(labelDrift.MissingManagedClusters)),
+				getHubToManagedClustersSetsMap(labelDrift.ExtraManagedClusters))); err != nil {
+			return fmt.Errorf("failed to update owner of label %s - %w", labelDrift.Key, err)
+		}
+	}
+
+	return nil
+}
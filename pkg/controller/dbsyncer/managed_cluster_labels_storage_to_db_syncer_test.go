@@ -0,0 +1,195 @@
+package dbsyncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testTierLabelKey   = "hub-of-hubs.open-cluster-management.io/tier"
+	testRegionLabelKey = "hub-of-hubs.open-cluster-management.io/region"
+)
+
+// newTestManagedClusterLabels returns the document of a ManagedClusterLabels that assigns the given labels to the
+// given managed clusters of hub1.
+func newTestManagedClusterLabels(name string, labels map[string]string, managedClusters ...string) []byte {
+	var document strings.Builder
+
+	fmt.Fprintf(&document, "kind: ManagedClusterLabels\nmetadata:\n  name: %s\nspec:\n  labels:\n", name)
+
+	for labelKey, labelValue := range labels {
+		fmt.Fprintf(&document, "    %s: %s\n", labelKey, labelValue)
+	}
+
+	fmt.Fprintf(&document, "  identifiers:\n  - hubIdentifier:\n      name: hub1\n      managedClusterIdentifiers:\n")
+
+	for _, managedCluster := range managedClusters {
+		fmt.Fprintf(&document, "      - %s\n", managedCluster)
+	}
+
+	return []byte(document.String())
+}
+
+func newTestGitResource(document []byte) *gitResource {
+	return &gitResource{
+		gitRepoFullPath: "/repos/subscription",
+		filePath:        "labels.yaml",
+		buf:             bytes.NewBuffer(document),
+		change:          &ObjectChange{},
+	}
+}
+
+func TestSyncManagedClusterLabels(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// cluster9 was labeled manually, not by an object
+	specDB := newFakeSpecDB(map[string]map[string]map[string]string{
+		"hub1": {"cluster9": {testTierLabelKey: "gold"}},
+	})
+	handler := NewManagedClusterLabelsHandler(specDB, &fakeStatusDB{}, &fakeAuthorizer{})
+
+	gold := map[string]string{testTierLabelKey: "gold"}
+
+	steps := []struct {
+		name           string
+		document       []byte
+		delete         bool
+		expectedTier   map[string]string
+		expectedRegion map[string]string
+	}{
+		{
+			name:     "first object assigns label",
+			document: newTestManagedClusterLabels("labels-a", gold, "cluster1", "cluster2"),
+			expectedTier: map[string]string{
+				"hub1/cluster1": "gold", "hub1/cluster2": "gold", "hub1/cluster9": "gold",
+			},
+		},
+		{
+			name:     "second object assigns same label",
+			document: newTestManagedClusterLabels("labels-b", gold, "cluster2", "cluster3"),
+			expectedTier: map[string]string{
+				"hub1/cluster1": "gold", "hub1/cluster2": "gold", "hub1/cluster3": "gold", "hub1/cluster9": "gold",
+			},
+		},
+		{
+			name:     "identifiers shrink",
+			document: newTestManagedClusterLabels("labels-a", gold, "cluster1"),
+			expectedTier: map[string]string{
+				"hub1/cluster1": "gold", "hub1/cluster2": "gold", "hub1/cluster3": "gold", "hub1/cluster9": "gold",
+			},
+		},
+		{
+			name:     "identifiers shrink to managed clusters of other objects only",
+			document: newTestManagedClusterLabels("labels-b", gold, "cluster3"),
+			expectedTier: map[string]string{
+				"hub1/cluster1": "gold", "hub1/cluster3": "gold", "hub1/cluster9": "gold",
+			},
+		},
+		{
+			name:     "object deleted",
+			document: newTestManagedClusterLabels("labels-a", gold, "cluster1"),
+			delete:   true,
+			expectedTier: map[string]string{
+				"hub1/cluster3": "gold", "hub1/cluster9": "gold",
+			},
+		},
+		{
+			name:           "label removed from object",
+			document:       newTestManagedClusterLabels("labels-b", map[string]string{testRegionLabelKey: "east"}, "cluster3"),
+			expectedTier:   map[string]string{"hub1/cluster9": "gold"},
+			expectedRegion: map[string]string{"hub1/cluster3": "east"},
+		},
+	}
+
+	// steps depend on the labels assigned by the previous steps
+	for _, step := range steps {
+		resource := newTestGitResource(step.document)
+
+		operation := func(ctx context.Context, resource *gitResource) error {
+			return handler.syncGitResourceFunc(ctx, resource)
+		}
+		if step.delete {
+			operation = handler.deleteGitResourceFunc
+		}
+
+		if err := operation(ctx, resource); err != nil {
+			t.Fatalf("%s: failed to handle managed cluster labels - %v", step.name, err)
+		}
+
+		if actual := specDB.getLabelValues(testTierLabelKey); !reflect.DeepEqual(actual, step.expectedTier) {
+			t.Fatalf("%s: expected tier labels %v, got %v", step.name, step.expectedTier, actual)
+		}
+
+		expectedRegion := step.expectedRegion
+		if expectedRegion == nil {
+			expectedRegion = map[string]string{}
+		}
+
+		if actual := specDB.getLabelValues(testRegionLabelKey); !reflect.DeepEqual(actual, expectedRegion) {
+			t.Fatalf("%s: expected region labels %v, got %v", step.name, expectedRegion, actual)
+		}
+	}
+}
+
+func TestSyncManagedClusterLabelsUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	specDB := newFakeSpecDB(nil)
+	authorizer := &fakeAuthorizer{}
+	handler := NewManagedClusterLabelsHandler(specDB, &fakeStatusDB{}, authorizer)
+	gold := map[string]string{testTierLabelKey: "gold"}
+
+	if err := handler.syncGitResourceFunc(ctx, newTestGitResource(newTestManagedClusterLabels("labels", gold,
+		"cluster1", "cluster2"))); err != nil {
+		t.Fatalf("failed to sync managed cluster labels - %v", err)
+	}
+
+	// the user loses access to cluster2, so the label can not be removed from it and the object keeps owning it
+	authorizer.unauthorized = map[string][]string{"hub1": {"cluster2"}}
+
+	if err := handler.deleteGitResourceFunc(ctx, newTestGitResource(newTestManagedClusterLabels("labels", gold,
+		"cluster1", "cluster2"))); err != nil {
+		t.Fatalf("failed to delete managed cluster labels - %v", err)
+	}
+
+	expected := map[string]string{"hub1/cluster2": "gold"}
+	if actual := specDB.getLabelValues(testTierLabelKey); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected tier labels %v, got %v", expected, actual)
+	}
+
+	authorizer.unauthorized = nil
+
+	if err := handler.deleteGitResourceFunc(ctx, newTestGitResource(newTestManagedClusterLabels("labels", gold,
+		"cluster1", "cluster2"))); err != nil {
+		t.Fatalf("failed to delete managed cluster labels - %v", err)
+	}
+
+	if actual := specDB.getLabelValues(testTierLabelKey); len(actual) != 0 {
+		t.Fatalf("expected no tier labels, got %v", actual)
+	}
+}
+
+func TestSyncManagedClusterLabelsKeyCollision(t *testing.T) {
+	t.Parallel()
+
+	resource := newTestGitResource(newTestManagedClusterLabels("labels", map[string]string{testTierLabelKey: "gold"},
+		"cluster1"))
+	resource.repoObjects = &repoObjects{objects: map[string]*repoObject{
+		"ManagedClustersGroup/tier": {filePath: "groups.yaml"},
+	}}
+
+	handler := NewManagedClusterLabelsHandler(newFakeSpecDB(nil), &fakeStatusDB{}, &fakeAuthorizer{})
+
+	err := handler.syncGitResourceFunc(context.Background(), resource)
+	if !errors.Is(err, errLabelKeyCollision) {
+		t.Fatalf("expected error %v, got %v", errLabelKeyCollision, err)
+	}
+}
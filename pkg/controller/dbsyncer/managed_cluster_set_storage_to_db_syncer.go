@@ -1,9 +1,7 @@
 package dbsyncer
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
 	"fmt"
 
 	set "github.com/deckarep/golang-set"
@@ -11,85 +9,364 @@ import (
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
 	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	ctrl "sigs.k8s.io/controller-runtime"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-const managedClusterSetLabelKey = "cluster.open-cluster-management.io/clusterset"
+const (
+	// GitOpsSubscriptionLabelKey marks objects that were created by gitops (e.g. CRs of sets) with the name of their
+	// source subscription.
+	GitOpsSubscriptionLabelKey = db.HubOfHubsGroup + "/gitops-subscription"
+	// gitOpsPathAnnotationKey holds the path of the file that defines a CR, relative to its repo root.
+	gitOpsPathAnnotationKey = db.HubOfHubsGroup + "/gitops-path"
+	// gitOpsCommitAnnotationKey holds the ID of the commit that a CR was last synced at.
+	gitOpsCommitAnnotationKey = db.HubOfHubsGroup + "/gitops-commit"
+)
 
-// NewManagedClusterSetStorageToDBSyncer returns a new instance of ManagedClusterSetStorageToDBSyncer.
-func NewManagedClusterSetStorageToDBSyncer(specDB db.SpecDB, k8sClient client.Client,
+// NewManagedClusterSetHandler returns a new instance of GitResourceHandler for HubOfHubsManagedClusterSet resources.
+func NewManagedClusterSetHandler(specDB db.SpecDB, statusDB db.StatusDB, k8sClient client.Client,
 	rbacAuthorizer authorizer.Authorizer,
-) StorageToDBSyncer {
-	return &genericStorageToDBSyncer{
-		log:                ctrl.Log.WithName("managed-cluster-set-storage-to-db-syncer"),
-		gitRepoToCommitMap: make(map[string]string),
-		syncGitResourceFunc: func(ctx context.Context, base64UserID string, base64UserGroup string,
-			buf *bytes.Buffer) error {
-			return syncManagedClusterSet(ctx, k8sClient, specDB, rbacAuthorizer, base64UserID, base64UserGroup, buf)
+) *GitResourceHandler {
+	return &GitResourceHandler{
+		syncGitResourceFunc: func(ctx context.Context, resource *gitResource) error {
+			return syncManagedClusterSet(ctx, k8sClient, specDB, statusDB, rbacAuthorizer, resource)
+		},
+		deleteGitResourceFunc: func(ctx context.Context, resource *gitResource) error {
+			return deleteManagedClusterSet(ctx, k8sClient, specDB, rbacAuthorizer, resource)
+		},
+		pruneGitResourcesFunc: func(ctx context.Context, repoSync *gitRepoSync) error {
+			return pruneManagedClusterSets(ctx, k8sClient, specDB, rbacAuthorizer, repoSync)
+		},
+		detectDriftFunc: func(ctx context.Context, resource *gitResource) ([]*LabelDrift, error) {
+			return detectManagedClusterSetDrift(ctx, specDB, statusDB, rbacAuthorizer, resource)
 		},
 	}
 }
 
-func syncManagedClusterSet(ctx context.Context, k8sClient client.Client, specDB db.SpecDB,
-	authorizer authorizer.Authorizer, base64UserID string, base64UserGroup string, buf *bytes.Buffer,
+// detectManagedClusterSetDrift returns the drift of the set label. the label key is shared by all sets, so only
+// managed clusters that are assigned with the set's name are owned by the set.
+func detectManagedClusterSetDrift(ctx context.Context, specDB db.SpecDB, statusDB db.StatusDB,
+	authorizer authorizer.Authorizer, resource *gitResource,
+) ([]*LabelDrift, error) {
+	managedClusterSet, err := yamltypes.NewManagedClusterSetFromBytes(resource.buf.Bytes())
+	if err != nil {
+		return nil, &objectParseError{err: fmt.Errorf("failed to create managed cluster set - %w", err)}
+	}
+
+	hubToCurrentManagedClustersMap, err := specDB.GetManagedClustersByLabel(ctx, managedClusterLabelsDBTableName,
+		db.ManagedClusterSetLabelKey, managedClusterSet.Metadata.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect drift of managed cluster set - %w", err)
+	}
+
+	hubToDesiredManagedClustersMap, err := getHubToManagedClustersMap(ctx, statusDB, resource.managedClusters,
+		managedClusterSet.Spec.Identifiers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect drift of managed cluster set - %w", err)
+	}
+
+	return getLabelDrifts(ctx, authorizer, resource, db.ManagedClusterSetLabelKey, managedClusterSet.Metadata.Name,
+		hubToDesiredManagedClustersMap, hubToCurrentManagedClustersMap, hubToCurrentManagedClustersMap)
+}
+
+func syncManagedClusterSet(ctx context.Context, k8sClient client.Client, specDB db.SpecDB, statusDB db.StatusDB,
+	authorizer authorizer.Authorizer, resource *gitResource,
 ) error {
-	managedClusterSet, err := yamltypes.NewManagedClusterSetFromBytes(buf.Bytes())
+	managedClusterSet, err := yamltypes.NewManagedClusterSetFromBytes(resource.buf.Bytes())
+	if err != nil {
+		return &objectParseError{err: fmt.Errorf("failed to create managed cluster set - %w", err)}
+	}
+
+	hubToManagedClustersMap, err := getHubToManagedClustersMap(ctx, statusDB, resource.managedClusters,
+		managedClusterSet.Spec.Identifiers)
 	if err != nil {
 		return fmt.Errorf("failed to create managed cluster set - %w", err)
 	}
 
-	// get decoded identity - assuming correctness because annotated by operator
-	userID, _ := base64.StdEncoding.DecodeString(base64UserID)
-	userGroup, _ := base64.StdEncoding.DecodeString(base64UserGroup)
+	// get managed clusters that are assigned with the set label but are no longer identified (e.g. excluded) by the set
+	hubToAssignedManagedClustersMap, err := specDB.GetManagedClustersByLabel(ctx, managedClusterLabelsDBTableName,
+		db.ManagedClusterSetLabelKey, managedClusterSet.Metadata.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create managed cluster set - %w", err)
+	}
 
-	hubToManagedClustersMap := make(map[string]set.Set)
+	hubToRemovedManagedClustersMap := getHubToManagedClustersDifference(hubToAssignedManagedClustersMap,
+		hubToManagedClustersMap)
 
-	for _, identifier := range managedClusterSet.Spec.Identifiers {
-		for _, hubIdentifier := range identifier {
-			hubToManagedClustersMap[hubIdentifier.Name] = createSetFromSlice(hubIdentifier.ManagedClusterIDs)
-		}
+	// filter out unauthorized managed clusters for subscribed user
+	hubToUnauthorizedManagedClustersMap, err := filterUnauthorizedManagedClusters(ctx, authorizer,
+		resource.base64UserID, resource.base64UserGroup, hubToManagedClustersMap)
+	if err != nil {
+		return fmt.Errorf("failed to create managed cluster set - %w", err)
 	}
 
-	// get unauthorized managed clusters for subscribed user
-	unauthorizedHubToManagedClustersMap, err := authorizer.FilterManagedClustersForUser(ctx, string(userID),
-		[]string{string(userGroup)}, hubToManagedClustersMap)
+	hubToUnauthorizedRemovedManagedClustersMap, err := filterUnauthorizedManagedClusters(ctx, authorizer,
+		resource.base64UserID, resource.base64UserGroup, hubToRemovedManagedClustersMap)
 	if err != nil {
-		return fmt.Errorf("failed to filter by authorization - %w", err)
+		return fmt.Errorf("failed to create managed cluster set - %w", err)
+	}
+
+	owned, err := createOrUpdateCR(ctx, k8sClient, resource, managedClusterSet.GetCR())
+	if err != nil {
+		return fmt.Errorf("failed to create ManagedClusterSet resource in cluster - %w", err)
+	}
+
+	if !owned {
+		return nil // the set of another subscription / tool, leave its labels untouched
 	}
 
-	if len(unauthorizedHubToManagedClustersMap) != 0 { // found unauthorized managed clusters in user request
-		for hubName, clustersSet := range unauthorizedHubToManagedClustersMap {
-			if len(clustersSet.ToSlice()) == 0 {
-				continue // means all good
-			}
+	resource.change.addLabelChange(db.ManagedClusterSetLabelKey, managedClusterSet.Metadata.Name, hubToManagedClustersMap,
+		hubToRemovedManagedClustersMap, getHubToManagedClustersUnion(hubToUnauthorizedManagedClustersMap,
+			hubToUnauthorizedRemovedManagedClustersMap))
 
-			hubToManagedClustersMap[hubName] = hubToManagedClustersMap[hubName].Difference(clustersSet) // remove them
-			if len(hubToManagedClustersMap[hubName].ToSlice()) == 0 {
-				delete(hubToManagedClustersMap, hubName)
-			}
-		}
+	if resource.dryRun {
+		return nil
 	}
 
-	if err := createCRAndAssignLabels(ctx, k8sClient, specDB, managedClusterSet, hubToManagedClustersMap); err != nil {
+	if err := assignManagedClusterSetLabels(ctx, specDB, resource, managedClusterSet, hubToManagedClustersMap,
+		hubToRemovedManagedClustersMap); err != nil {
 		return fmt.Errorf("failed to create managed cluster set - %w", err)
 	}
 
 	return nil
 }
 
-func createCRAndAssignLabels(ctx context.Context, k8sClient client.Client, specDB db.SpecDB,
+// assignManagedClusterSetLabels assigns the set label to the given managed clusters and removes it from the given
+// removed managed clusters.
+func assignManagedClusterSetLabels(ctx context.Context, specDB db.SpecDB, resource *gitResource,
 	managedClusterSet *yamltypes.ManagedClusterSet, hubToManagedClustersMap map[string]set.Set,
+	hubToRemovedManagedClustersMap map[string]set.Set,
 ) error {
-	// update CR in cluster - if already exists then it's ok
-	if err := k8sClient.Create(ctx, managedClusterSet.GetCR()); err != nil && !apierrors.IsAlreadyExists(err) {
-		return fmt.Errorf("failed to create ManagedClusterSet resource in cluster - %w", err)
+	if err := specDB.UpdateLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, db.ManagedClusterSetLabelKey,
+		managedClusterSet.Metadata.Name, hubToManagedClustersMap, getLabelsAuditInfo(resource)); err != nil {
+		return fmt.Errorf("failed to update managed clusters group - %w", err)
 	}
 
-	if err := specDB.UpdateLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, managedClusterSetLabelKey,
-		managedClusterSet.Metadata.Name, hubToManagedClustersMap); err != nil {
-		return fmt.Errorf("failed to update managed clusters group - %w", err)
+	if err := specDB.RemoveLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, db.ManagedClusterSetLabelKey,
+		hubToRemovedManagedClustersMap, getLabelsAuditInfo(resource)); err != nil {
+		return fmt.Errorf("failed to remove set label of managed clusters that are no longer identified - %w", err)
+	}
+
+	return nil
+}
+
+// createOrUpdateCR creates the CR stamped with gitops ownership. if the CR already exists, its spec is updated only if
+// it is owned by the resource's subscription (see isOwnedCR), CRs created by other subscriptions / tools are left
+// untouched. returns whether the CR is owned by the resource's subscription.
+func createOrUpdateCR(ctx context.Context, k8sClient client.Client, resource *gitResource,
+	managedClusterSetCR *clusterv1beta1.ManagedClusterSet,
+) (bool, error) {
+	if resource.dryRun {
+		return planCreateOrUpdateCR(ctx, k8sClient, resource, managedClusterSetCR.Name)
+	}
+
+	setGitOpsOwnership(managedClusterSetCR, resource)
+
+	err := k8sClient.Create(ctx, managedClusterSetCR)
+	if err == nil {
+		resource.change.setResourceAction(getManagedClusterSetCRIdentifier(managedClusterSetCR.Name),
+			ResourceActionCreate)
+
+		return true, nil
+	}
+
+	if !apierrors.IsAlreadyExists(err) {
+		return false, fmt.Errorf("failed to create resource - %w", err)
+	}
+
+	// update CR in cluster - if already exists and owned by subscription
+	existingCR := &clusterv1beta1.ManagedClusterSet{}
+	if err := k8sClient.Get(ctx, client.ObjectKey{Name: managedClusterSetCR.Name}, existingCR); err != nil {
+		return false, fmt.Errorf("failed to get existing resource - %w", err)
+	}
+
+	if !isOwnedCR(existingCR, resource) {
+		resource.change.setResourceAction(getManagedClusterSetCRIdentifier(managedClusterSetCR.Name),
+			ResourceActionSkip)
+
+		return false, nil // not owned by subscription
+	}
+
+	existingCR.Spec = managedClusterSetCR.Spec
+	setGitOpsOwnership(existingCR, resource)
+
+	if err := k8sClient.Update(ctx, existingCR); err != nil {
+		return false, fmt.Errorf("failed to update existing resource - %w", err)
+	}
+
+	resource.change.setResourceAction(getManagedClusterSetCRIdentifier(managedClusterSetCR.Name),
+		ResourceActionUpdate)
+
+	return true, nil
+}
+
+// planCreateOrUpdateCR records the action that createOrUpdateCR would apply on the CR with the given name. returns
+// whether the CR would be owned by the resource's subscription.
+func planCreateOrUpdateCR(ctx context.Context, k8sClient client.Client, resource *gitResource,
+	managedClusterSetName string,
+) (bool, error) {
+	action := ResourceActionUpdate
+
+	existingCR := &clusterv1beta1.ManagedClusterSet{}
+	if err := k8sClient.Get(ctx, client.ObjectKey{Name: managedClusterSetName}, existingCR); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to get existing resource - %w", err)
+		}
+
+		action = ResourceActionCreate
+	} else if !isOwnedCR(existingCR, resource) {
+		action = ResourceActionSkip
+	}
+
+	resource.change.setResourceAction(getManagedClusterSetCRIdentifier(managedClusterSetName), action)
+
+	return action != ResourceActionSkip, nil
+}
+
+// isOwnedCR returns whether the CR is owned by the resource's subscription, i.e. is labeled with the subscription or,
+// if it has no subscription label, is annotated with the resource's path. CRs that are not stamped with gitops
+// ownership (e.g. created by other tools) are not owned.
+func isOwnedCR(managedClusterSetCR *clusterv1beta1.ManagedClusterSet, resource *gitResource) bool {
+	if subscriptionName, found := managedClusterSetCR.Labels[GitOpsSubscriptionLabelKey]; found {
+		return subscriptionName == getSubscriptionName(resource.gitRepoFullPath)
+	}
+
+	filePath, found := managedClusterSetCR.Annotations[gitOpsPathAnnotationKey]
+
+	return found && filePath == resource.filePath
+}
+
+// setGitOpsOwnership stamps the CR with the labels / annotations that mark it as created by the resource's
+// subscription.
+func setGitOpsOwnership(managedClusterSetCR *clusterv1beta1.ManagedClusterSet, resource *gitResource) {
+	if managedClusterSetCR.Labels == nil {
+		managedClusterSetCR.Labels = map[string]string{}
+	}
+
+	if managedClusterSetCR.Annotations == nil {
+		managedClusterSetCR.Annotations = map[string]string{}
+	}
+
+	managedClusterSetCR.Labels[GitOpsSubscriptionLabelKey] = getSubscriptionName(resource.gitRepoFullPath)
+	managedClusterSetCR.Annotations[gitOpsPathAnnotationKey] = resource.filePath
+	managedClusterSetCR.Annotations[gitOpsCommitAnnotationKey] = resource.commitID
+}
+
+// deleteManagedClusterSet removes the cluster set label from all managed clusters that are assigned with the set, and
+// deletes the ManagedClusterSet CR, if the CR is owned by the resource's subscription.
+func deleteManagedClusterSet(ctx context.Context, k8sClient client.Client, specDB db.SpecDB,
+	authorizer authorizer.Authorizer, resource *gitResource,
+) error {
+	managedClusterSet, err := yamltypes.NewManagedClusterSetFromBytes(resource.buf.Bytes())
+	if err != nil {
+		return &objectParseError{err: fmt.Errorf("failed to create managed cluster set - %w", err)}
+	}
+
+	if err := removeManagedClusterSet(ctx, k8sClient, specDB, authorizer, resource,
+		managedClusterSet.Metadata.Name); err != nil {
+		return fmt.Errorf("failed to delete managed cluster set - %w", err)
 	}
 
 	return nil
 }
+
+// pruneManagedClusterSets removes the ManagedClusterSet CRs that are owned by the repo's subscription but were not
+// synced at the commit of the repo sync's state (their defining file is gone), along with their labels.
+func pruneManagedClusterSets(ctx context.Context, k8sClient client.Client, specDB db.SpecDB,
+	authorizer authorizer.Authorizer, repoSync *gitRepoSync,
+) error {
+	subscriptionName := getSubscriptionName(repoSync.gitRepoFullPath)
+	managedClusterSetList := &clusterv1beta1.ManagedClusterSetList{}
+
+	if err := k8sClient.List(ctx, managedClusterSetList,
+		client.MatchingLabels{GitOpsSubscriptionLabelKey: subscriptionName}); err != nil {
+		return fmt.Errorf("failed to list ManagedClusterSet resources of subscription %s - %w", subscriptionName, err)
+	}
+
+	for _, managedClusterSetCR := range managedClusterSetList.Items {
+		objectIdentifier := fmt.Sprintf("%s/%s", yamltypes.ManagedClusterSetKind, managedClusterSetCR.Name)
+
+		if managedClusterSetCR.Annotations[gitOpsCommitAnnotationKey] == repoSync.syncState.CommitID ||
+			(repoSync.dryRun && repoSync.wasSynced(objectIdentifier)) {
+			continue // still defined in repo (CRs are not stamped with the commit in dry-run)
+		}
+
+		resource := repoSync.newPruneGitResource(objectIdentifier)
+
+		if err := removeManagedClusterSet(ctx, k8sClient, specDB, authorizer, resource,
+			managedClusterSetCR.Name); err != nil {
+			resource.change.setError(err)
+			return fmt.Errorf("failed to prune managed cluster set %s - %w", managedClusterSetCR.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// removeManagedClusterSet removes the cluster set label from all managed clusters that are assigned with the set, and
+// deletes the ManagedClusterSet CR. sets whose CR is not owned by the resource's subscription are left untouched.
+func removeManagedClusterSet(ctx context.Context, k8sClient client.Client, specDB db.SpecDB,
+	authorizer authorizer.Authorizer, resource *gitResource, managedClusterSetName string,
+) error {
+	managedClusterSetCR := &clusterv1beta1.ManagedClusterSet{}
+	if err := k8sClient.Get(ctx, client.ObjectKey{Name: managedClusterSetName}, managedClusterSetCR); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get ManagedClusterSet resource - %w", err)
+		}
+
+		managedClusterSetCR = nil // already deleted, the set's labels are still removed
+	}
+
+	if managedClusterSetCR != nil && !isOwnedCR(managedClusterSetCR, resource) {
+		resource.change.setResourceAction(getManagedClusterSetCRIdentifier(managedClusterSetName),
+			ResourceActionSkip)
+
+		return nil // not owned by subscription, leave the CR and the set's labels untouched
+	}
+
+	// get all managed clusters that are currently assigned with the set
+	hubToManagedClustersMap, err := specDB.GetManagedClustersByLabel(ctx, managedClusterLabelsDBTableName,
+		db.ManagedClusterSetLabelKey, managedClusterSetName)
+	if err != nil {
+		return fmt.Errorf("failed to get managed clusters of set - %w", err)
+	}
+
+	// filter out unauthorized managed clusters for subscribed user
+	hubToUnauthorizedManagedClustersMap, err := filterUnauthorizedManagedClusters(ctx, authorizer,
+		resource.base64UserID, resource.base64UserGroup, hubToManagedClustersMap)
+	if err != nil {
+		return fmt.Errorf("failed to filter managed clusters of set - %w", err)
+	}
+
+	resource.change.addLabelChange(db.ManagedClusterSetLabelKey, "", nil, hubToManagedClustersMap,
+		hubToUnauthorizedManagedClustersMap)
+
+	if !resource.dryRun {
+		if err := specDB.RemoveLabelForManagedClusters(ctx, managedClusterLabelsDBTableName,
+			db.ManagedClusterSetLabelKey, hubToManagedClustersMap, getLabelsAuditInfo(resource)); err != nil {
+			return fmt.Errorf("failed to remove label from managed clusters of set - %w", err)
+		}
+	}
+
+	if managedClusterSetCR == nil {
+		return nil // already deleted
+	}
+
+	resource.change.setResourceAction(getManagedClusterSetCRIdentifier(managedClusterSetName), ResourceActionDelete)
+
+	if resource.dryRun {
+		return nil
+	}
+
+	// delete CR from cluster - if already deleted then it's ok
+	if err := k8sClient.Delete(ctx, managedClusterSetCR); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete ManagedClusterSet resource from cluster - %w", err)
+	}
+
+	return nil
+}
+
+// getManagedClusterSetCRIdentifier returns the identifier (kind/name) of the ManagedClusterSet CR with the given name.
+func getManagedClusterSetCRIdentifier(managedClusterSetName string) string {
+	return fmt.Sprintf("ManagedClusterSet/%s", managedClusterSetName)
+}
@@ -0,0 +1,164 @@
+package dbsyncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestIsOwnedCR(t *testing.T) {
+	t.Parallel()
+
+	resource := &gitResource{
+		gitRepoFullPath: "/repos/default/subscription",
+		filePath:        "sets/aws.yaml",
+	}
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		expected    bool
+	}{
+		{
+			name:     "owned by subscription",
+			labels:   map[string]string{GitOpsSubscriptionLabelKey: "subscription"},
+			expected: true,
+		},
+		{
+			name:     "owned by another subscription",
+			labels:   map[string]string{GitOpsSubscriptionLabelKey: "another-subscription"},
+			expected: false,
+		},
+		{
+			name:     "unstamped",
+			expected: false,
+		},
+		{
+			name:        "unlabeled with same path",
+			annotations: map[string]string{gitOpsPathAnnotationKey: "sets/aws.yaml"},
+			expected:    true,
+		},
+		{
+			name:        "unlabeled with another path",
+			annotations: map[string]string{gitOpsPathAnnotationKey: "sets/gcp.yaml"},
+			expected:    false,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			managedClusterSetCR := &clusterv1beta1.ManagedClusterSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "aws",
+					Labels:      test.labels,
+					Annotations: test.annotations,
+				},
+			}
+
+			if actual := isOwnedCR(managedClusterSetCR, resource); actual != test.expected {
+				t.Fatalf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSyncManagedClusterSet(t *testing.T) {
+	t.Parallel()
+
+	document := []byte(`kind: HubOfHubsManagedClusterSet
+metadata:
+  name: aws
+spec:
+  identifiers:
+  - hubIdentifier:
+      name: hub1
+      managedClusterIdentifiers:
+      - cluster1
+`)
+
+	tests := []struct {
+		name           string
+		existingCR     *clusterv1beta1.ManagedClusterSet
+		expectedAction string
+		expectedLabels map[string]string
+	}{
+		{
+			name:           "no existing CR",
+			expectedAction: ResourceActionCreate,
+			expectedLabels: map[string]string{"hub1/cluster1": "aws"},
+		},
+		{
+			name: "existing CR owned by subscription",
+			existingCR: &clusterv1beta1.ManagedClusterSet{ObjectMeta: metav1.ObjectMeta{
+				Name:   "aws",
+				Labels: map[string]string{GitOpsSubscriptionLabelKey: "subscription"},
+			}},
+			expectedAction: ResourceActionUpdate,
+			expectedLabels: map[string]string{"hub1/cluster1": "aws"},
+		},
+		{
+			name:           "existing unstamped CR",
+			existingCR:     &clusterv1beta1.ManagedClusterSet{ObjectMeta: metav1.ObjectMeta{Name: "aws"}},
+			expectedAction: ResourceActionSkip,
+			expectedLabels: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			scheme := runtime.NewScheme()
+			if err := clusterv1beta1.AddToScheme(scheme); err != nil {
+				t.Fatalf("failed to create scheme - %v", err)
+			}
+
+			clientBuilder := fake.NewClientBuilder().WithScheme(scheme)
+			if test.existingCR != nil {
+				clientBuilder = clientBuilder.WithObjects(test.existingCR)
+			}
+
+			k8sClient := clientBuilder.Build()
+			specDB := newFakeSpecDB(nil)
+			handler := NewManagedClusterSetHandler(specDB, &fakeStatusDB{}, k8sClient, &fakeAuthorizer{})
+			resource := newTestGitResource(document)
+
+			if err := handler.syncGitResourceFunc(context.Background(), resource); err != nil {
+				t.Fatalf("failed to sync managed cluster set - %v", err)
+			}
+
+			if action := resource.change.ResourceActions["ManagedClusterSet/aws"]; action != test.expectedAction {
+				t.Fatalf("expected action %s, got %s", test.expectedAction, action)
+			}
+
+			actual := specDB.getLabelValues(db.ManagedClusterSetLabelKey)
+			if !reflect.DeepEqual(actual, test.expectedLabels) {
+				t.Fatalf("expected set labels %v, got %v", test.expectedLabels, actual)
+			}
+
+			managedClusterSetCR := &clusterv1beta1.ManagedClusterSet{}
+			if err := k8sClient.Get(context.Background(), client.ObjectKey{Name: "aws"},
+				managedClusterSetCR); err != nil {
+				t.Fatalf("failed to get ManagedClusterSet - %v", err)
+			}
+
+			if owned := isOwnedCR(managedClusterSetCR, resource); owned != (test.expectedAction != ResourceActionSkip) {
+				t.Fatalf("expected CR owned: %t, got %t", test.expectedAction != ResourceActionSkip, owned)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package dbsyncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	set "github.com/deckarep/golang-set"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
+)
+
+var (
+	errGroupReferenceCycle             = errors.New("managed clusters groups reference each other in a cycle")
+	errCompositionOperatorNotSupported = errors.New("composition operator is not supported")
+)
+
+// GetManagedClustersGroupFunc returns the managed clusters group with the given name.
+type GetManagedClustersGroupFunc func(name string) (*yamltypes.ManagedClustersGroup, error)
+
+// GetIdentifiedManagedClustersFunc returns a map of hub -> set of managed clusters identified by the given identifiers.
+type GetIdentifiedManagedClustersFunc func(identifiers []map[string]yamltypes.HubIdentifier) (map[string]set.Set,
+	error)
+
+// ManagedClustersGroupResolver resolves the managed clusters of groups, following the references of composed groups
+// to other groups. groups are resolved once, the resolver is meant to be used for a single snapshot of the groups.
+type ManagedClustersGroupResolver struct {
+	getManagedClustersGroupFunc      GetManagedClustersGroupFunc
+	getIdentifiedManagedClustersFunc GetIdentifiedManagedClustersFunc
+	// groupToManagedClustersMap maps the names of resolved groups to their hub -> set of managed clusters maps.
+	groupToManagedClustersMap map[string]map[string]set.Set
+}
+
+// NewManagedClustersGroupResolver returns a new instance of ManagedClustersGroupResolver that looks up referenced
+// groups by name and resolves identifiers using the given functions.
+func NewManagedClustersGroupResolver(getManagedClustersGroupFunc GetManagedClustersGroupFunc,
+	getIdentifiedManagedClustersFunc GetIdentifiedManagedClustersFunc,
+) *ManagedClustersGroupResolver {
+	return &ManagedClustersGroupResolver{
+		getManagedClustersGroupFunc:      getManagedClustersGroupFunc,
+		getIdentifiedManagedClustersFunc: getIdentifiedManagedClustersFunc,
+		groupToManagedClustersMap:        make(map[string]map[string]set.Set),
+	}
+}
+
+// Resolve returns a map of hub -> set of managed clusters of the given group: the managed clusters identified by its
+// identifiers, together with the managed clusters composed from the groups it references. fails if a referenced group
+// can not be found or if groups reference each other in a cycle. the returned map may be modified by the caller.
+func (resolver *ManagedClustersGroupResolver) Resolve(managedClustersGroup *yamltypes.ManagedClustersGroup,
+) (map[string]set.Set, error) {
+	hubToManagedClustersMap, err := resolver.resolve(managedClustersGroup, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	return getHubToManagedClustersUnion(hubToManagedClustersMap), nil // copy, resolved maps are shared
+}
+
+// resolve returns the managed clusters of the given group. path holds the names of the groups that reference the
+// group (transitively), to detect cycles.
+func (resolver *ManagedClustersGroupResolver) resolve(managedClustersGroup *yamltypes.ManagedClustersGroup,
+	path []string,
+) (map[string]set.Set, error) {
+	groupName := managedClustersGroup.Metadata.Name
+
+	if hubToManagedClustersMap, found := resolver.groupToManagedClustersMap[groupName]; found {
+		return hubToManagedClustersMap, nil
+	}
+
+	path = append(append(make([]string, 0, len(path)+1), path...), groupName)
+
+	for _, referencingGroupName := range path[:len(path)-1] {
+		if referencingGroupName == groupName {
+			return nil, fmt.Errorf("%w: %s", errGroupReferenceCycle, strings.Join(path, " -> "))
+		}
+	}
+
+	hubToIdentifiedManagedClustersMap, err := resolver.getIdentifiedManagedClustersFunc(
+		managedClustersGroup.Spec.Identifiers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve identifiers of group %s - %w", groupName, err)
+	}
+
+	hubToComposedManagedClustersMap, err := resolver.compose(managedClustersGroup.Spec.Composition, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve composition of group %s - %w", groupName, err)
+	}
+
+	hubToManagedClustersMap := getHubToManagedClustersUnion(hubToIdentifiedManagedClustersMap,
+		hubToComposedManagedClustersMap)
+	resolver.groupToManagedClustersMap[groupName] = hubToManagedClustersMap
+
+	return hubToManagedClustersMap, nil
+}
+
+// compose returns the managed clusters that the given composition composes from the groups it references. returns an
+// empty map if composition is nil.
+func (resolver *ManagedClustersGroupResolver) compose(composition *yamltypes.ManagedClustersGroupComposition,
+	path []string,
+) (map[string]set.Set, error) {
+	if composition == nil {
+		return make(map[string]set.Set), nil
+	}
+
+	hubToManagedClustersMaps := make([]map[string]set.Set, 0, len(composition.Groups))
+
+	for _, groupName := range composition.Groups {
+		managedClustersGroup, err := resolver.getManagedClustersGroupFunc(groupName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get referenced group %s - %w", groupName, err)
+		}
+
+		hubToManagedClustersMap, err := resolver.resolve(managedClustersGroup, path)
+		if err != nil {
+			return nil, err
+		}
+
+		hubToManagedClustersMaps = append(hubToManagedClustersMaps, hubToManagedClustersMap)
+	}
+
+	switch composition.Operator {
+	case yamltypes.CompositionOperatorUnion:
+		return getHubToManagedClustersUnion(hubToManagedClustersMaps...), nil
+	case yamltypes.CompositionOperatorIntersection:
+		return getHubToManagedClustersIntersection(hubToManagedClustersMaps...), nil
+	case yamltypes.CompositionOperatorDifference:
+		if len(hubToManagedClustersMaps) == 0 {
+			return make(map[string]set.Set), nil
+		}
+
+		return getHubToManagedClustersDifference(hubToManagedClustersMaps[0],
+			getHubToManagedClustersUnion(hubToManagedClustersMaps[1:]...)), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errCompositionOperatorNotSupported, composition.Operator)
+	}
+}
+
+// getManagedClustersGroupMembers returns a map of hub -> set of managed clusters of the given group, that is read
+// from the given git resource. referenced groups are looked up in the resource's repo, at the resource's commit.
+// dynamic identifiers are resolved against the managed clusters in the status DB.
+func getManagedClustersGroupMembers(ctx context.Context, statusDB db.StatusDB, resource *gitResource,
+	managedClustersGroup *yamltypes.ManagedClustersGroup,
+) (map[string]set.Set, error) {
+	resolver := NewManagedClustersGroupResolver(func(name string) (*yamltypes.ManagedClustersGroup, error) {
+		object, err := resource.repoObjects.get(fmt.Sprintf("%s/%s", yamltypes.ManagedClustersGroupKind, name))
+		if err != nil {
+			return nil, err
+		}
+
+		referencedGroup, err := yamltypes.NewManagedClustersGroupFromBytes(object.document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create managed clusters group - %w", err)
+		}
+
+		return referencedGroup, nil
+	}, func(identifiers []map[string]yamltypes.HubIdentifier) (map[string]set.Set, error) {
+		return getHubToManagedClustersMap(ctx, statusDB, resource.managedClusters, identifiers)
+	})
+
+	hubToManagedClustersMap, err := resolver.Resolve(managedClustersGroup)
+	if errors.Is(err, errObjectNotFound) || errors.Is(err, errGroupReferenceCycle) {
+		return nil, &objectParseError{err: err} // the group's references are invalid
+	}
+
+	return hubToManagedClustersMap, err
+}
@@ -0,0 +1,376 @@
+package dbsyncer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	set "github.com/deckarep/golang-set"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
+)
+
+const (
+	eastGroupDocument = `kind: ManagedClustersGroup
+metadata:
+  name: east
+spec:
+  identifiers:
+    - hubIdentifier:
+        name: hub3
+        managedClusterIdentifiers: [cluster5, cluster6, cluster7]
+    - hubIdentifier:
+        name: hub4
+        managedClusterIdentifiers: [cluster9]
+`
+	prodGroupDocument = `kind: ManagedClustersGroup
+metadata:
+  name: prod
+spec:
+  identifiers:
+    - hubIdentifier:
+        name: hub3
+        managedClusterIdentifiers: [cluster7, cluster8]
+    - hubIdentifier:
+        name: hub4
+        managedClusterIdentifiers: [cluster9]
+`
+	eastProdGroupDocument = `kind: ManagedClustersGroup
+metadata:
+  name: east-prod
+spec:
+  composition:
+    operator: intersection
+    groups: [east, prod]
+`
+)
+
+// newTestManagedClustersGroup returns a group with the given name, identified managed clusters of hub3 and
+// composition.
+func newTestManagedClustersGroup(name string, hub3ManagedClusters []string,
+	composition *yamltypes.ManagedClustersGroupComposition,
+) *yamltypes.ManagedClustersGroup {
+	managedClustersGroup := &yamltypes.ManagedClustersGroup{
+		Kind:     yamltypes.ManagedClustersGroupKind,
+		Metadata: yamltypes.ManagedClustersGroupMetadata{Name: name},
+	}
+
+	managedClustersGroup.Spec.Composition = composition
+
+	if len(hub3ManagedClusters) > 0 {
+		managedClustersGroup.Spec.Identifiers = []map[string]yamltypes.HubIdentifier{{
+			"hubIdentifier": {Name: "hub3", ManagedClusterIDs: hub3ManagedClusters},
+		}}
+	}
+
+	return managedClustersGroup
+}
+
+// newTestManagedClustersGroupResolver returns a resolver of the given groups, that resolves identifiers by name only.
+func newTestManagedClustersGroupResolver(managedClustersGroups ...*yamltypes.ManagedClustersGroup,
+) *ManagedClustersGroupResolver {
+	nameToManagedClustersGroupMap := make(map[string]*yamltypes.ManagedClustersGroup)
+	for _, managedClustersGroup := range managedClustersGroups {
+		nameToManagedClustersGroupMap[managedClustersGroup.Metadata.Name] = managedClustersGroup
+	}
+
+	return NewManagedClustersGroupResolver(func(name string) (*yamltypes.ManagedClustersGroup, error) {
+		managedClustersGroup, found := nameToManagedClustersGroupMap[name]
+		if !found {
+			return nil, fmt.Errorf("%w: %s", errObjectNotFound, name)
+		}
+
+		return managedClustersGroup, nil
+	}, func(identifiers []map[string]yamltypes.HubIdentifier) (map[string]set.Set, error) {
+		hubToManagedClustersMap, err := yamltypes.GetHubToManagedClustersMap(identifiers, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve identifiers - %w", err)
+		}
+
+		return getHubToManagedClustersSetsMap(hubToManagedClustersMap), nil
+	})
+}
+
+func TestManagedClustersGroupResolverResolve(t *testing.T) {
+	t.Parallel()
+
+	east := newTestManagedClustersGroup("east", []string{"cluster5", "cluster6", "cluster7"}, nil)
+	prod := newTestManagedClustersGroup("prod", []string{"cluster7", "cluster8"}, nil)
+	dev := newTestManagedClustersGroup("dev", []string{"cluster5"}, nil)
+
+	tests := []struct {
+		name     string
+		group    *yamltypes.ManagedClustersGroup
+		expected map[string][]string
+		err      error
+	}{
+		{
+			name: "union",
+			group: newTestManagedClustersGroup("all", nil, &yamltypes.ManagedClustersGroupComposition{
+				Operator: yamltypes.CompositionOperatorUnion,
+				Groups:   []string{"east", "prod"},
+			}),
+			expected: map[string][]string{"hub3": {"cluster5", "cluster6", "cluster7", "cluster8"}},
+		},
+		{
+			name: "intersection",
+			group: newTestManagedClustersGroup("east-prod", nil, &yamltypes.ManagedClustersGroupComposition{
+				Operator: yamltypes.CompositionOperatorIntersection,
+				Groups:   []string{"east", "prod"},
+			}),
+			expected: map[string][]string{"hub3": {"cluster7"}},
+		},
+		{
+			name: "empty intersection omits hub",
+			group: newTestManagedClustersGroup("prod-dev", nil, &yamltypes.ManagedClustersGroupComposition{
+				Operator: yamltypes.CompositionOperatorIntersection,
+				Groups:   []string{"prod", "dev"},
+			}),
+			expected: map[string][]string{},
+		},
+		{
+			name: "difference of first group and the others",
+			group: newTestManagedClustersGroup("east-non-prod", nil, &yamltypes.ManagedClustersGroupComposition{
+				Operator: yamltypes.CompositionOperatorDifference,
+				Groups:   []string{"east", "prod", "dev"},
+			}),
+			expected: map[string][]string{"hub3": {"cluster6"}},
+		},
+		{
+			name: "composition is added to identifiers",
+			group: newTestManagedClustersGroup("east-prod-and-1", []string{"cluster1"},
+				&yamltypes.ManagedClustersGroupComposition{
+					Operator: yamltypes.CompositionOperatorIntersection,
+					Groups:   []string{"east", "prod"},
+				}),
+			expected: map[string][]string{"hub3": {"cluster1", "cluster7"}},
+		},
+		{
+			name: "nested composition",
+			group: newTestManagedClustersGroup("nested", nil, &yamltypes.ManagedClustersGroupComposition{
+				Operator: yamltypes.CompositionOperatorUnion,
+				Groups:   []string{"composed"},
+			}),
+			expected: map[string][]string{"hub3": {"cluster6", "cluster7"}},
+		},
+		{
+			name: "unknown reference",
+			group: newTestManagedClustersGroup("unknown", nil, &yamltypes.ManagedClustersGroupComposition{
+				Operator: yamltypes.CompositionOperatorUnion,
+				Groups:   []string{"east", "missing"},
+			}),
+			err: errObjectNotFound,
+		},
+		{
+			name: "cycle",
+			group: newTestManagedClustersGroup("cycle-a", nil, &yamltypes.ManagedClustersGroupComposition{
+				Operator: yamltypes.CompositionOperatorUnion,
+				Groups:   []string{"cycle-b"},
+			}),
+			err: errGroupReferenceCycle,
+		},
+		{
+			name: "unsupported operator",
+			group: newTestManagedClustersGroup("xor", nil, &yamltypes.ManagedClustersGroupComposition{
+				Operator: "xor",
+				Groups:   []string{"east", "prod"},
+			}),
+			err: errCompositionOperatorNotSupported,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			resolver := newTestManagedClustersGroupResolver(east, prod, dev, test.group,
+				newTestManagedClustersGroup("composed", nil, &yamltypes.ManagedClustersGroupComposition{
+					Operator: yamltypes.CompositionOperatorDifference,
+					Groups:   []string{"east", "dev"},
+				}),
+				newTestManagedClustersGroup("cycle-b", nil, &yamltypes.ManagedClustersGroupComposition{
+					Operator: yamltypes.CompositionOperatorUnion,
+					Groups:   []string{"prod", "cycle-a"},
+				}))
+
+			hubToManagedClustersMap, err := resolver.Resolve(test.group)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected error %v, got %v", test.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			actual := getHubToManagedClustersSlicesMap(hubToManagedClustersMap)
+			if actual == nil {
+				actual = map[string][]string{}
+			}
+
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestManagedClustersGroupResolverResolveReturnsCopy(t *testing.T) {
+	t.Parallel()
+
+	east := newTestManagedClustersGroup("east", []string{"cluster5"}, nil)
+	resolver := newTestManagedClustersGroupResolver(east)
+
+	hubToManagedClustersMap, err := resolver.Resolve(east)
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+
+	delete(hubToManagedClustersMap, "hub3") // consumed by the caller
+
+	hubToManagedClustersMap, err = resolver.Resolve(east)
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+
+	if !reflect.DeepEqual(getHubToManagedClustersSlicesMap(hubToManagedClustersMap),
+		map[string][]string{"hub3": {"cluster5"}}) {
+		t.Fatalf("resolved group was modified by the caller, got %v", hubToManagedClustersMap)
+	}
+}
+
+func TestGetDependants(t *testing.T) {
+	t.Parallel()
+
+	syncer := &genericStorageToDBSyncer{
+		kindToHandlerMap: map[string]*GitResourceHandler{
+			yamltypes.ManagedClustersGroupKind: NewManagedClustersGroupHandler(nil, nil, nil),
+		},
+	}
+
+	eastProdProdDocument := `kind: ManagedClustersGroup
+metadata:
+  name: east-prod-or-prod
+spec:
+  composition:
+    operator: union
+    groups: [east-prod, prod]
+`
+
+	identifierToObjectMap := map[string]*repoObject{
+		"ManagedClustersGroup/east":              {filePath: "east.yaml", document: []byte(eastGroupDocument)},
+		"ManagedClustersGroup/prod":              {filePath: "prod.yaml", document: []byte(prodGroupDocument)},
+		"ManagedClustersGroup/east-prod":         {filePath: "ep.yaml", document: []byte(eastProdGroupDocument)},
+		"ManagedClustersGroup/east-prod-or-prod": {filePath: "epp.yaml", document: []byte(eastProdProdDocument)},
+	}
+
+	tests := []struct {
+		name             string
+		changedObjects   []string
+		changedFilePaths []string
+		expected         []string
+	}{
+		{
+			name:             "dependants of changed group, transitively",
+			changedObjects:   []string{"ManagedClustersGroup/east"},
+			changedFilePaths: []string{"east.yaml"},
+			expected:         []string{"ManagedClustersGroup/east-prod", "ManagedClustersGroup/east-prod-or-prod"},
+		},
+		{
+			name:             "dependants of deleted group",
+			changedObjects:   []string{"ManagedClustersGroup/west"},
+			changedFilePaths: []string{},
+			expected:         []string{},
+		},
+		{
+			name:             "dependants in changed files are not included",
+			changedObjects:   []string{"ManagedClustersGroup/prod", "ManagedClustersGroup/east-prod"},
+			changedFilePaths: []string{"prod.yaml", "ep.yaml"},
+			expected:         []string{"ManagedClustersGroup/east-prod-or-prod"},
+		},
+		{
+			name:             "no dependants",
+			changedObjects:   []string{"ManagedClustersGroup/east-prod-or-prod"},
+			changedFilePaths: []string{"epp.yaml"},
+			expected:         []string{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			changedObjectIdentifiers := set.NewSet()
+			for _, objectIdentifier := range test.changedObjects {
+				changedObjectIdentifiers.Add(objectIdentifier)
+			}
+
+			actual := syncer.getDependants(identifierToObjectMap, changedObjectIdentifiers,
+				createSetFromSlice(test.changedFilePaths))
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIsDynamic(t *testing.T) {
+	t.Parallel()
+
+	syncer := &genericStorageToDBSyncer{
+		kindToHandlerMap: map[string]*GitResourceHandler{
+			yamltypes.ManagedClustersGroupKind: NewManagedClustersGroupHandler(nil, nil, nil),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		document string
+		expected bool
+	}{
+		{
+			name:     "static group",
+			document: eastGroupDocument,
+			expected: false,
+		},
+		{
+			name: "group with selector",
+			document: `kind: ManagedClustersGroup
+metadata:
+  name: aws
+spec:
+  identifiers:
+    - hubIdentifier:
+        name: hub3
+        managedClusterSelector:
+          matchLabels:
+            cloud: aws
+`,
+			expected: true,
+		},
+		{
+			name:     "composed group",
+			document: eastProdGroupDocument,
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := syncer.isDynamic([]byte(test.document)); actual != test.expected {
+				t.Fatalf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
@@ -1,83 +1,196 @@
 package dbsyncer
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
 	"fmt"
 
 	set "github.com/deckarep/golang-set"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/authorizer"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
 	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
-	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 const (
 	managedClusterLabelsDBTableName = "managed_clusters_labels"
+	// managedClustersStatusDBTableName is the status table of managed clusters, dynamic identifiers are resolved
+	// against it.
+	managedClustersStatusDBTableName = "managed_clusters"
 )
 
-// NewManagedClustersGroupStorageToDBSyncer returns a new instance of ManagedClustersGroupStorageToDBSyncer.
-func NewManagedClustersGroupStorageToDBSyncer(specDB db.SpecDB,
+// NewManagedClustersGroupHandler returns a new instance of GitResourceHandler for ManagedClustersGroup resources.
+func NewManagedClustersGroupHandler(specDB db.SpecDB, statusDB db.StatusDB,
 	rbacAuthorizer authorizer.Authorizer,
-) StorageToDBSyncer {
-	return &genericStorageToDBSyncer{
-		log:                ctrl.Log.WithName("managed-clusters-group-storage-to-db-syncer"),
-		gitRepoToCommitMap: make(map[string]string),
-		syncGitResourceFunc: func(ctx context.Context, base64UserID string, base64UserGroup string,
-			buf *bytes.Buffer) error {
-			return syncManagedClustersGroup(ctx, specDB, rbacAuthorizer, base64UserID, base64UserGroup, buf)
+) *GitResourceHandler {
+	return &GitResourceHandler{
+		syncGitResourceFunc: func(ctx context.Context, resource *gitResource) error {
+			return syncManagedClustersGroup(ctx, specDB, statusDB, rbacAuthorizer, resource)
 		},
+		deleteGitResourceFunc: func(ctx context.Context, resource *gitResource) error {
+			return deleteManagedClustersGroup(ctx, specDB, rbacAuthorizer, resource)
+		},
+		detectDriftFunc: func(ctx context.Context, resource *gitResource) ([]*LabelDrift, error) {
+			return detectManagedClustersGroupDrift(ctx, specDB, statusDB, rbacAuthorizer, resource)
+		},
+		getReferencesFunc: getManagedClustersGroupReferences,
 	}
 }
 
-func syncManagedClustersGroup(ctx context.Context, specDB db.SpecDB, authorizer authorizer.Authorizer,
-	base64UserID string, base64UserGroup string, buf *bytes.Buffer,
+func syncManagedClustersGroup(ctx context.Context, specDB db.SpecDB, statusDB db.StatusDB,
+	authorizer authorizer.Authorizer, resource *gitResource,
 ) error {
-	managedClustersGroup, err := yamltypes.NewManagedClustersGroupFromBytes(buf.Bytes())
+	managedClustersGroup, err := yamltypes.NewManagedClustersGroupFromBytes(resource.buf.Bytes())
 	if err != nil {
-		return fmt.Errorf("failed to create managed clusters group - %w", err)
+		return &objectParseError{err: fmt.Errorf("failed to create managed clusters group - %w", err)}
 	}
 
-	// get decoded identity - assuming correctness because annotated by operator
-	userID, _ := base64.StdEncoding.DecodeString(base64UserID)
-	userGroup, _ := base64.StdEncoding.DecodeString(base64UserGroup)
-
 	// get group label key
-	labelKey := fmt.Sprintf("%s/%s", db.HubOfHubsGroup, managedClustersGroup.Metadata.Name)
+	labelKey := managedClustersGroup.GetLabelKey()
+
+	hubToManagedClustersMap, err := getManagedClustersGroupMembers(ctx, statusDB, resource, managedClustersGroup)
+	if err != nil {
+		return fmt.Errorf("failed to update managed clusters group - %w", err)
+	}
 
-	hubToManagedClustersMap := make(map[string]set.Set)
+	// get managed clusters that are assigned with the group label but are no longer identified by the group
+	hubToRemovedManagedClustersMap, err := getRemovedManagedClusters(ctx, specDB, labelKey, hubToManagedClustersMap)
+	if err != nil {
+		return fmt.Errorf("failed to update managed clusters group - %w", err)
+	}
 
-	for _, identifier := range managedClustersGroup.Spec.Identifiers {
-		for _, hubIdentifier := range identifier {
-			hubToManagedClustersMap[hubIdentifier.Name] = createSetFromSlice(hubIdentifier.ManagedClusterIDs)
-		}
+	// filter out unauthorized managed clusters for subscribed user
+	hubToUnauthorizedManagedClustersMap, err := filterUnauthorizedManagedClusters(ctx, authorizer,
+		resource.base64UserID, resource.base64UserGroup, hubToManagedClustersMap)
+	if err != nil {
+		return fmt.Errorf("failed to update managed clusters group - %w", err)
 	}
 
-	// get unauthorized managed clusters for subscribed user
-	unauthorizedHubToManagedClustersMap, err := authorizer.FilterManagedClustersForUser(ctx, string(userID),
-		[]string{string(userGroup)}, hubToManagedClustersMap)
+	hubToUnauthorizedRemovedManagedClustersMap, err := filterUnauthorizedManagedClusters(ctx, authorizer,
+		resource.base64UserID, resource.base64UserGroup, hubToRemovedManagedClustersMap)
 	if err != nil {
-		return fmt.Errorf("failed to filter by authorization - %w", err)
+		return fmt.Errorf("failed to update managed clusters group - %w", err)
 	}
 
-	if len(unauthorizedHubToManagedClustersMap) != 0 { // found unauthorized managed clusters in user request
-		for hubName, clustersSet := range unauthorizedHubToManagedClustersMap {
-			if len(clustersSet.ToSlice()) == 0 {
-				continue // means all good
-			}
+	resource.change.addLabelChange(labelKey, managedClustersGroup.Spec.TagValue, hubToManagedClustersMap,
+		hubToRemovedManagedClustersMap, getHubToManagedClustersUnion(hubToUnauthorizedManagedClustersMap,
+			hubToUnauthorizedRemovedManagedClustersMap))
 
-			hubToManagedClustersMap[hubName] = hubToManagedClustersMap[hubName].Difference(clustersSet) // remove them
-			if len(hubToManagedClustersMap[hubName].ToSlice()) == 0 {
-				delete(hubToManagedClustersMap, hubName)
-			}
-		}
+	if resource.dryRun {
+		return nil
 	}
 
 	if err := specDB.UpdateLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, labelKey,
-		managedClustersGroup.Spec.TagValue, hubToManagedClustersMap); err != nil {
+		managedClustersGroup.Spec.TagValue, hubToManagedClustersMap, getLabelsAuditInfo(resource)); err != nil {
+		return fmt.Errorf("failed to update managed clusters group - %w", err)
+	}
+
+	if err := specDB.RemoveLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, labelKey,
+		hubToRemovedManagedClustersMap, getLabelsAuditInfo(resource)); err != nil {
 		return fmt.Errorf("failed to update managed clusters group - %w", err)
 	}
 
 	return nil
 }
+
+// getRemovedManagedClusters returns a map of hub -> set of managed clusters that are currently assigned with the
+// given label key but are not present in the given desired hub -> set of managed clusters map.
+func getRemovedManagedClusters(ctx context.Context, specDB db.SpecDB, labelKey string,
+	desiredHubToManagedClustersMap map[string]set.Set,
+) (map[string]set.Set, error) {
+	currentHubToManagedClustersMap, err := specDB.GetManagedClustersByLabel(ctx, managedClusterLabelsDBTableName,
+		labelKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed clusters assigned with label %s - %w", labelKey, err)
+	}
+
+	return getHubToManagedClustersDifference(currentHubToManagedClustersMap, desiredHubToManagedClustersMap), nil
+}
+
+// deleteManagedClustersGroup removes the group label from all managed clusters that are assigned with it.
+func deleteManagedClustersGroup(ctx context.Context, specDB db.SpecDB, authorizer authorizer.Authorizer,
+	resource *gitResource,
+) error {
+	managedClustersGroup, err := yamltypes.NewManagedClustersGroupFromBytes(resource.buf.Bytes())
+	if err != nil {
+		return &objectParseError{err: fmt.Errorf("failed to create managed clusters group - %w", err)}
+	}
+
+	// get group label key
+	labelKey := managedClustersGroup.GetLabelKey()
+
+	// get all managed clusters that are currently assigned with the group label
+	hubToManagedClustersMap, err := specDB.GetManagedClustersByLabel(ctx, managedClusterLabelsDBTableName, labelKey,
+		"")
+	if err != nil {
+		return fmt.Errorf("failed to delete managed clusters group - %w", err)
+	}
+
+	// filter out unauthorized managed clusters for subscribed user
+	hubToUnauthorizedManagedClustersMap, err := filterUnauthorizedManagedClusters(ctx, authorizer,
+		resource.base64UserID, resource.base64UserGroup, hubToManagedClustersMap)
+	if err != nil {
+		return fmt.Errorf("failed to delete managed clusters group - %w", err)
+	}
+
+	resource.change.addLabelChange(labelKey, "", nil, hubToManagedClustersMap, hubToUnauthorizedManagedClustersMap)
+
+	if resource.dryRun {
+		return nil
+	}
+
+	if err := specDB.RemoveLabelForManagedClusters(ctx, managedClusterLabelsDBTableName, labelKey,
+		hubToManagedClustersMap, getLabelsAuditInfo(resource)); err != nil {
+		return fmt.Errorf("failed to delete managed clusters group - %w", err)
+	}
+
+	return nil
+}
+
+// detectManagedClustersGroupDrift returns the drift of the group label. the group owns its label key, so managed
+// clusters that are assigned with the key (with any value) but are not identified by the group are drifted too.
+func detectManagedClustersGroupDrift(ctx context.Context, specDB db.SpecDB, statusDB db.StatusDB,
+	authorizer authorizer.Authorizer, resource *gitResource,
+) ([]*LabelDrift, error) {
+	managedClustersGroup, err := yamltypes.NewManagedClustersGroupFromBytes(resource.buf.Bytes())
+	if err != nil {
+		return nil, &objectParseError{err: fmt.Errorf("failed to create managed clusters group - %w", err)}
+	}
+
+	labelKey := managedClustersGroup.GetLabelKey()
+
+	labelValue := managedClustersGroup.Spec.TagValue
+	if labelValue == "" {
+		labelValue = db.ManagedClusterSetDefaultTagValue
+	}
+
+	hubToCurrentManagedClustersMap, err := specDB.GetManagedClustersByLabel(ctx, managedClusterLabelsDBTableName,
+		labelKey, labelValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect drift of managed clusters group - %w", err)
+	}
+
+	hubToOwnedManagedClustersMap, err := specDB.GetManagedClustersByLabel(ctx, managedClusterLabelsDBTableName,
+		labelKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect drift of managed clusters group - %w", err)
+	}
+
+	hubToDesiredManagedClustersMap, err := getManagedClustersGroupMembers(ctx, statusDB, resource,
+		managedClustersGroup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect drift of managed clusters group - %w", err)
+	}
+
+	return getLabelDrifts(ctx, authorizer, resource, labelKey, labelValue, hubToDesiredManagedClustersMap,
+		hubToCurrentManagedClustersMap, hubToOwnedManagedClustersMap)
+}
+
+// getManagedClustersGroupReferences returns the identifiers of the groups that the group in the given document is
+// composed of.
+func getManagedClustersGroupReferences(document []byte) []string {
+	managedClustersGroup, err := yamltypes.NewManagedClustersGroupFromBytes(document)
+	if err != nil {
+		return []string{} // nothing is synced from document
+	}
+
+	return managedClustersGroup.GetReferences()
+}
@@ -0,0 +1,101 @@
+package dbsyncer
+
+import (
+	"fmt"
+
+	set "github.com/deckarep/golang-set"
+)
+
+// membershipState maps the labels (key=value) that an object assigns to the hub -> set of managed clusters that the
+// object identifies for them.
+type membershipState map[string]map[string]set.Set
+
+// getMembershipLabel returns the key of a label in a membership state.
+func getMembershipLabel(labelKey string, labelValue string) string {
+	return fmt.Sprintf("%s=%s", labelKey, labelValue)
+}
+
+// getMembershipStates returns the membership states of the dynamic objects of a local git repo, as last re-evaluated.
+// returns nil if the repo was not re-evaluated yet.
+func (syncer *genericStorageToDBSyncer) getMembershipStates(gitRepoFullPath string) map[string]membershipState {
+	syncer.membershipStatesLock.Lock()
+	defer syncer.membershipStatesLock.Unlock()
+
+	return syncer.membershipStates[gitRepoFullPath]
+}
+
+// setMembershipStates sets the membership states of the dynamic objects of a local git repo. nil states forget the
+// repo.
+func (syncer *genericStorageToDBSyncer) setMembershipStates(gitRepoFullPath string,
+	membershipStates map[string]membershipState,
+) {
+	syncer.membershipStatesLock.Lock()
+	defer syncer.membershipStatesLock.Unlock()
+
+	if membershipStates == nil {
+		delete(syncer.membershipStates, gitRepoFullPath)
+		return
+	}
+
+	syncer.membershipStates[gitRepoFullPath] = membershipStates
+}
+
+// getMembershipBaseline returns the membership state that the current membership of an object is compared with: its
+// previous membership state, and the managed clusters that are assigned with its labels in the DB for labels that are
+// not in the previous state (e.g. the object was not re-evaluated since a restart).
+func getMembershipBaseline(previousMembershipState membershipState,
+	assignedMembershipState membershipState,
+) membershipState {
+	baselineMembershipState := make(membershipState, len(assignedMembershipState))
+
+	for label, hubToManagedClustersMap := range assignedMembershipState {
+		baselineMembershipState[label] = hubToManagedClustersMap
+	}
+
+	for label, hubToManagedClustersMap := range previousMembershipState {
+		baselineMembershipState[label] = hubToManagedClustersMap
+	}
+
+	return baselineMembershipState
+}
+
+// getMembershipChanges narrows the given label drifts of an object to its membership changes: missing managed
+// clusters that joined the object's identified managed clusters and extra managed clusters that left them, since the
+// previous membership state. drifts of managed clusters whose membership did not change (e.g. manual label edits) and
+// of labels that are not in the previous state are dropped.
+func getMembershipChanges(labelDrifts []*LabelDrift, previousMembershipState membershipState,
+	currentMembershipState membershipState,
+) []*LabelDrift {
+	membershipChanges := make([]*LabelDrift, 0)
+
+	for _, labelDrift := range labelDrifts {
+		label := getMembershipLabel(labelDrift.Key, labelDrift.Value)
+
+		previousHubToManagedClustersMap, found := previousMembershipState[label]
+		if !found {
+			continue // no baseline to compare with
+		}
+
+		currentHubToManagedClustersMap := currentMembershipState[label]
+
+		hubToJoinedManagedClustersMap := getHubToManagedClustersIntersection(
+			getHubToManagedClustersSetsMap(labelDrift.MissingManagedClusters),
+			getHubToManagedClustersDifference(currentHubToManagedClustersMap, previousHubToManagedClustersMap))
+		hubToLeftManagedClustersMap := getHubToManagedClustersIntersection(
+			getHubToManagedClustersSetsMap(labelDrift.ExtraManagedClusters),
+			getHubToManagedClustersDifference(previousHubToManagedClustersMap, currentHubToManagedClustersMap))
+
+		if len(hubToJoinedManagedClustersMap) == 0 && len(hubToLeftManagedClustersMap) == 0 {
+			continue
+		}
+
+		membershipChanges = append(membershipChanges, &LabelDrift{
+			Key:                    labelDrift.Key,
+			Value:                  labelDrift.Value,
+			MissingManagedClusters: getHubToManagedClustersSlicesMap(hubToJoinedManagedClustersMap),
+			ExtraManagedClusters:   getHubToManagedClustersSlicesMap(hubToLeftManagedClustersMap),
+		})
+	}
+
+	return membershipChanges
+}
@@ -0,0 +1,122 @@
+package dbsyncer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetMembershipChanges(t *testing.T) {
+	t.Parallel()
+
+	label := getMembershipLabel("hub-of-hubs.open-cluster-management.io/aws", "true")
+	previousMembershipState := membershipState{
+		label: getHubToManagedClustersSetsMap(map[string][]string{"hub3": {"cluster1", "cluster2", "cluster3"}}),
+	}
+	currentMembershipState := membershipState{
+		label: getHubToManagedClustersSetsMap(map[string][]string{"hub3": {"cluster2", "cluster3", "cluster4"}}),
+	}
+
+	tests := []struct {
+		name       string
+		labelDrift *LabelDrift
+		previous   membershipState
+		expected   []*LabelDrift
+	}{
+		{
+			name: "joined and left managed clusters",
+			labelDrift: &LabelDrift{
+				Key:                    "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                  "true",
+				MissingManagedClusters: map[string][]string{"hub3": {"cluster4"}},
+				ExtraManagedClusters:   map[string][]string{"hub3": {"cluster1"}},
+			},
+			previous: previousMembershipState,
+			expected: []*LabelDrift{{
+				Key:                    "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                  "true",
+				MissingManagedClusters: map[string][]string{"hub3": {"cluster4"}},
+				ExtraManagedClusters:   map[string][]string{"hub3": {"cluster1"}},
+			}},
+		},
+		{
+			name: "manual edits of members are not changed",
+			labelDrift: &LabelDrift{
+				Key:                    "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                  "true",
+				MissingManagedClusters: map[string][]string{"hub3": {"cluster2", "cluster4"}},
+				ExtraManagedClusters:   map[string][]string{"hub4": {"cluster9"}},
+			},
+			previous: previousMembershipState,
+			expected: []*LabelDrift{{
+				Key:                    "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                  "true",
+				MissingManagedClusters: map[string][]string{"hub3": {"cluster4"}},
+			}},
+		},
+		{
+			name: "only manual edits",
+			labelDrift: &LabelDrift{
+				Key:                    "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                  "true",
+				MissingManagedClusters: map[string][]string{"hub3": {"cluster3"}},
+			},
+			previous: previousMembershipState,
+			expected: []*LabelDrift{},
+		},
+		{
+			name: "no previous membership of label",
+			labelDrift: &LabelDrift{
+				Key:                    "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                  "true",
+				MissingManagedClusters: map[string][]string{"hub3": {"cluster4"}},
+			},
+			previous: membershipState{},
+			expected: []*LabelDrift{},
+		},
+		{
+			name: "no previous membership of label, baseline from DB",
+			labelDrift: &LabelDrift{
+				Key:                    "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                  "true",
+				MissingManagedClusters: map[string][]string{"hub3": {"cluster4"}},
+				ExtraManagedClusters:   map[string][]string{"hub3": {"cluster1"}},
+			},
+			previous: getMembershipBaseline(membershipState{}, membershipState{
+				label: getHubToManagedClustersSetsMap(map[string][]string{"hub3": {"cluster1", "cluster2"}}),
+			}),
+			expected: []*LabelDrift{{
+				Key:                    "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                  "true",
+				MissingManagedClusters: map[string][]string{"hub3": {"cluster4"}},
+				ExtraManagedClusters:   map[string][]string{"hub3": {"cluster1"}},
+			}},
+		},
+		{
+			name: "previous membership of label takes precedence over DB",
+			labelDrift: &LabelDrift{
+				Key:                    "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                  "true",
+				MissingManagedClusters: map[string][]string{"hub3": {"cluster4"}},
+			},
+			previous: getMembershipBaseline(membershipState{
+				label: getHubToManagedClustersSetsMap(map[string][]string{"hub3": {"cluster2", "cluster3", "cluster4"}}),
+			}, membershipState{
+				label: getHubToManagedClustersSetsMap(map[string][]string{"hub3": {"cluster2"}}),
+			}),
+			expected: []*LabelDrift{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual := getMembershipChanges([]*LabelDrift{test.labelDrift}, test.previous, currentMembershipState)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
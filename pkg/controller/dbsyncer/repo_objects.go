@@ -0,0 +1,99 @@
+package dbsyncer
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+var errObjectNotFound = errors.New("object not found")
+
+// repoObject is an object (yaml document) of a local git repo at a commit.
+type repoObject struct {
+	// filePath is the path of the object's file, relative to the repo root.
+	filePath string
+	// documentIndex is the index of the object's document within its file.
+	documentIndex int
+	document      []byte
+}
+
+// repoObjects indexes the objects of a local git repo at a commit by their identifiers (kind/name), so that objects
+// can reference other objects of the same repo. the files are read lazily, once.
+type repoObjects struct {
+	repo     *git.Repository
+	commitID string
+	workPath *WorkPath
+	// objects maps object identifiers to objects, nil until the files are read.
+	objects map[string]*repoObject
+}
+
+func newRepoObjects(repo *git.Repository, commitID string, workPath *WorkPath) *repoObjects {
+	return &repoObjects{
+		repo:     repo,
+		commitID: commitID,
+		workPath: workPath,
+	}
+}
+
+// get returns the object with the given identifier. fails with errObjectNotFound if the repo has no such object.
+func (objects *repoObjects) get(objectIdentifier string) (*repoObject, error) {
+	if objects == nil {
+		return nil, fmt.Errorf("%w: %s", errObjectNotFound, objectIdentifier) // no repo to reference objects of
+	}
+
+	identifierToObjectMap, err := objects.getAll()
+	if err != nil {
+		return nil, err
+	}
+
+	object, found := identifierToObjectMap[objectIdentifier]
+	if !found {
+		return nil, fmt.Errorf("%w: %s", errObjectNotFound, objectIdentifier)
+	}
+
+	return object, nil
+}
+
+// getAll returns a map of object identifier -> object of all the objects of the repo. if several documents have the
+// same identifier, the first one is kept.
+func (objects *repoObjects) getAll() (map[string]*repoObject, error) {
+	if objects.objects != nil {
+		return objects.objects, nil
+	}
+
+	files, err := getFiles(objects.repo, objects.commitID, objects.workPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get objects of commit %s - %w", objects.commitID, err)
+	}
+
+	identifierToObjectMap := make(map[string]*repoObject)
+
+	for _, file := range files {
+		documents, err := getDocuments(file)
+		if err != nil {
+			continue // file has no objects to reference
+		}
+
+		for documentIndex, document := range documents {
+			objectHeader := getObjectHeader(document)
+			if objectHeader == nil {
+				continue
+			}
+
+			if _, found := identifierToObjectMap[objectHeader.GetIdentifier()]; found {
+				continue
+			}
+
+			identifierToObjectMap[objectHeader.GetIdentifier()] = &repoObject{
+				filePath:      file.Name,
+				documentIndex: documentIndex,
+				document:      document,
+			}
+		}
+	}
+
+	objects.objects = identifierToObjectMap
+
+	return identifierToObjectMap, nil
+}
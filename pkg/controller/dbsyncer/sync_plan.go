@@ -0,0 +1,224 @@
+package dbsyncer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	set "github.com/deckarep/golang-set"
+)
+
+const (
+	// ObjectOperationSync is the operation of syncing an object that is present in the repo.
+	ObjectOperationSync = "sync"
+	// ObjectOperationDelete is the operation of un-deploying an object that was removed from the repo.
+	ObjectOperationDelete = "delete"
+	// ObjectOperationPrune is the operation of un-deploying a left-over object after a full sync of the repo.
+	ObjectOperationPrune = "prune"
+
+	// ResourceActionCreate is the action of creating a k8s resource.
+	ResourceActionCreate = "create"
+	// ResourceActionUpdate is the action of updating a k8s resource that is owned by the subscription.
+	ResourceActionUpdate = "update"
+	// ResourceActionDelete is the action of deleting a k8s resource that is owned by the subscription.
+	ResourceActionDelete = "delete"
+	// ResourceActionSkip is the action of leaving a k8s resource that is not owned by the subscription untouched.
+	ResourceActionSkip = "skip-not-owned"
+
+	// ErrorReasonParse is the reason of a failure to read / parse an object (or its file).
+	ErrorReasonParse = "ParseError"
+	// ErrorReasonDB is the reason of a failure to apply a parsed object to the DB (or its k8s resources).
+	ErrorReasonDB = "DBError"
+)
+
+// SyncPlan holds the changes that syncing a local git repo at a commit applies (or would apply in plan mode).
+type SyncPlan struct {
+	// CommitID is the ID of the commit that the plan was computed for.
+	CommitID string `yaml:"commit"`
+	// Syncer is the name of the syncer that computed the plan.
+	Syncer string `yaml:"syncer"`
+	// FromCommitID is the ID of the last synced commit that the plan is relative to. empty if never synced.
+	FromCommitID string `yaml:"fromCommit,omitempty"`
+	// FullSync is set if all files were synced rather than the files changed since FromCommitID.
+	FullSync bool `yaml:"fullSync"`
+	// DryRun is set if the changes were computed but not applied.
+	DryRun bool `yaml:"dryRun"`
+	// Changes of the objects that were synced / un-deployed.
+	Changes []*ObjectChange `yaml:"changes"`
+	// Error of the repo sync, if failed before / after the objects were synced.
+	Error string `yaml:"error,omitempty"`
+	// StartTime is the time that the repo sync started.
+	StartTime time.Time `yaml:"-"`
+	// Duration of the repo sync.
+	Duration time.Duration `yaml:"-"`
+}
+
+// Succeeded returns whether the repo and all of its objects were synced successfully.
+func (plan *SyncPlan) Succeeded() bool {
+	return len(plan.GetErrors()) == 0
+}
+
+// ObjectChange holds the changes that syncing / un-deploying a single object applies.
+type ObjectChange struct {
+	// FilePath is the path of the object's file, relative to the repo root. empty for pruned objects.
+	FilePath string `yaml:"file,omitempty"`
+	// DocumentIndex is the index of the object's document within its file.
+	DocumentIndex int `yaml:"documentIndex"`
+	// Object identifies the object (kind/name).
+	Object string `yaml:"object"`
+	// Operation is one of ObjectOperationSync, ObjectOperationDelete and ObjectOperationPrune.
+	Operation string `yaml:"operation"`
+	// LabelChanges are the changes of labels assignment in the DB.
+	LabelChanges []*LabelChange `yaml:"labelChanges,omitempty"`
+	// ResourceActions maps k8s resources (kind/name) to the action applied on them.
+	ResourceActions map[string]string `yaml:"resourceActions,omitempty"`
+	// Error of the change, if failed.
+	Error string `yaml:"error,omitempty"`
+	// ErrorReason is one of ErrorReasonParse and ErrorReasonDB, if failed.
+	ErrorReason string `yaml:"errorReason,omitempty"`
+	// Duration of handling the object.
+	Duration time.Duration `yaml:"-"`
+}
+
+// LabelChange holds the changes of a label's assignment to managed clusters, as a map of hub -> managed clusters.
+type LabelChange struct {
+	// Key of the label.
+	Key string `yaml:"key"`
+	// Value of the label. empty if only removed.
+	Value string `yaml:"value,omitempty"`
+	// AssignedManagedClusters are the managed clusters that are assigned with the label.
+	AssignedManagedClusters map[string][]string `yaml:"assignedManagedClusters,omitempty"`
+	// RemovedManagedClusters are the managed clusters that the label is removed from.
+	RemovedManagedClusters map[string][]string `yaml:"removedManagedClusters,omitempty"`
+	// UnauthorizedManagedClusters are the managed clusters that were filtered out since the subscribed user is not
+	// authorized to access them.
+	UnauthorizedManagedClusters map[string][]string `yaml:"unauthorizedManagedClusters,omitempty"`
+}
+
+// SyncError describes a failure of a repo sync.
+type SyncError struct {
+	// FilePath is the path of the failed file, relative to the repo root. empty for repo-level failures.
+	FilePath string `json:"file,omitempty"`
+	// DocumentIndex is the index of the failed document within its file.
+	DocumentIndex int `json:"documentIndex,omitempty"`
+	// Object identifies the failed object (kind/name), if known.
+	Object string `json:"object,omitempty"`
+	// Error message.
+	Error string `json:"error"`
+}
+
+// GetErrors returns the failures of the repo sync.
+func (plan *SyncPlan) GetErrors() []*SyncError {
+	syncErrors := make([]*SyncError, 0)
+
+	if plan.Error != "" {
+		syncErrors = append(syncErrors, &SyncError{Error: plan.Error})
+	}
+
+	for _, change := range plan.Changes {
+		if change.Error != "" {
+			syncErrors = append(syncErrors, &SyncError{
+				FilePath:      change.FilePath,
+				DocumentIndex: change.DocumentIndex,
+				Object:        change.Object,
+				Error:         change.Error,
+			})
+		}
+	}
+
+	return syncErrors
+}
+
+// GetUnauthorizedManagedClustersCount returns the number of (distinct) managed clusters that were filtered out since
+// the subscribed user is not authorized to access them.
+func (plan *SyncPlan) GetUnauthorizedManagedClustersCount() int {
+	unauthorizedManagedClusters := set.NewSet()
+
+	for _, change := range plan.Changes {
+		for _, labelChange := range change.LabelChanges {
+			for hubName, clusters := range labelChange.UnauthorizedManagedClusters {
+				for _, cluster := range clusters {
+					unauthorizedManagedClusters.Add(fmt.Sprintf("%s/%s", hubName, cluster))
+				}
+			}
+		}
+	}
+
+	return unauthorizedManagedClusters.Cardinality()
+}
+
+// addLabelChange records a change of a label's assignment to managed clusters.
+func (change *ObjectChange) addLabelChange(key string, value string,
+	hubToAssignedManagedClustersMap map[string]set.Set, hubToRemovedManagedClustersMap map[string]set.Set,
+	hubToUnauthorizedManagedClustersMap map[string]set.Set,
+) {
+	change.LabelChanges = append(change.LabelChanges, &LabelChange{
+		Key:                         key,
+		Value:                       value,
+		AssignedManagedClusters:     getHubToManagedClustersSlicesMap(hubToAssignedManagedClustersMap),
+		RemovedManagedClusters:      getHubToManagedClustersSlicesMap(hubToRemovedManagedClustersMap),
+		UnauthorizedManagedClusters: getHubToManagedClustersSlicesMap(hubToUnauthorizedManagedClustersMap),
+	})
+}
+
+// setError records the failure of the change, along with its reason.
+func (change *ObjectChange) setError(err error) {
+	var parseErr *objectParseError
+
+	change.Error = err.Error()
+	change.ErrorReason = ErrorReasonDB
+
+	if errors.As(err, &parseErr) {
+		change.ErrorReason = ErrorReasonParse
+	}
+}
+
+// setResourceAction records the action applied on a k8s resource.
+func (change *ObjectChange) setResourceAction(resourceIdentifier string, action string) {
+	if change.ResourceActions == nil {
+		change.ResourceActions = map[string]string{}
+	}
+
+	change.ResourceActions[resourceIdentifier] = action
+}
+
+// getHubToManagedClustersSlicesMap converts a map of hub -> set of managed clusters to a map of hub -> sorted slice
+// of managed clusters. hubs with no managed clusters are omitted.
+func getHubToManagedClustersSlicesMap(hubToManagedClustersMap map[string]set.Set) map[string][]string {
+	if len(hubToManagedClustersMap) == 0 {
+		return nil
+	}
+
+	hubToManagedClustersSlicesMap := make(map[string][]string, len(hubToManagedClustersMap))
+
+	for hubName, clustersSet := range hubToManagedClustersMap {
+		if clustersSet.Cardinality() == 0 {
+			continue
+		}
+
+		clusters := make([]string, 0, clustersSet.Cardinality())
+
+		for _, cluster := range clustersSet.ToSlice() {
+			if clusterName, ok := cluster.(string); ok {
+				clusters = append(clusters, clusterName)
+			}
+		}
+
+		sort.Strings(clusters)
+		hubToManagedClustersSlicesMap[hubName] = clusters
+	}
+
+	return hubToManagedClustersSlicesMap
+}
+
+// getManagedClustersCount returns the number of managed clusters in a map of hub -> managed clusters.
+func getManagedClustersCount(hubToManagedClustersMap map[string][]string) int {
+	count := 0
+
+	for _, clusters := range hubToManagedClustersMap {
+		count += len(clusters)
+	}
+
+	return count
+}
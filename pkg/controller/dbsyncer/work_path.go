@@ -0,0 +1,171 @@
+package dbsyncer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	doubleStar = "**"
+	gitDirName = ".git"
+)
+
+// WorkPath defines the files of a git repo that are synced.
+type WorkPath struct {
+	// Path is the relative path to sync objects from (sets workdir = gitRepoPath/Path). If left empty, the workdir is
+	// gitRepoPath.
+	Path string
+	// Recursive sets whether files in nested directories of the workdir are synced (otherwise depth 1 only).
+	Recursive bool
+	// IncludePatterns are glob patterns of files to sync. If empty, all files are synced.
+	IncludePatterns []string
+	// ExcludePatterns are glob patterns of files not to sync. Exclusion takes precedence over inclusion.
+	ExcludePatterns []string
+}
+
+// ValidatePatterns returns an error if any of the include / exclude patterns is malformed.
+func (workPath *WorkPath) ValidatePatterns() error {
+	for _, pattern := range append(append([]string{}, workPath.IncludePatterns...), workPath.ExcludePatterns...) {
+		if _, err := filepath.Match(strings.ReplaceAll(pattern, doubleStar, "*"), ""); err != nil {
+			return fmt.Errorf("malformed pattern %s - %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// ContainsFile returns whether the file with the given path (relative to the repo root) should be synced.
+func (workPath *WorkPath) ContainsFile(filePath string) bool {
+	// tree paths are relative to repo root, empty path becomes "."
+	relativeFilePath, err := filepath.Rel(filepath.Clean(workPath.Path), filePath)
+	if err != nil || relativeFilePath == ".." || strings.HasPrefix(relativeFilePath, "../") {
+		return false // not in workdir
+	}
+
+	if !workPath.Recursive && filepath.Dir(relativeFilePath) != "." {
+		return false // nested file
+	}
+
+	if len(workPath.IncludePatterns) != 0 && !matchAnyPattern(workPath.IncludePatterns, relativeFilePath) {
+		return false
+	}
+
+	return !matchAnyPattern(workPath.ExcludePatterns, relativeFilePath)
+}
+
+// WalkDir calls walkFunc with the path and the contents of each file of a local directory (e.g. a git repo clone) that
+// the work path contains. the path is relative to dirPath, in the form of a git tree path. the .git dir is skipped.
+func (workPath *WorkPath) WalkDir(dirPath string, walkFunc func(filePath string, contents []byte) error) error {
+	if err := filepath.Walk(dirPath, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fileInfo.IsDir() {
+			if fileInfo.Name() == gitDirName {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		relativeFilePath, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path of %s - %w", path, err)
+		}
+
+		relativeFilePath = filepath.ToSlash(relativeFilePath)
+		if !workPath.ContainsFile(relativeFilePath) {
+			return nil
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s - %w", path, err)
+		}
+
+		return walkFunc(relativeFilePath, contents)
+	}); err != nil {
+		return fmt.Errorf("failed to walk directory %s - %w", dirPath, err)
+	}
+
+	return nil
+}
+
+// equals returns whether the given work path selects the same files.
+func (workPath *WorkPath) equals(other *WorkPath) bool {
+	return filepath.Clean(workPath.Path) == filepath.Clean(other.Path) && workPath.Recursive == other.Recursive &&
+		stringSlicesEqual(workPath.IncludePatterns, other.IncludePatterns) &&
+		stringSlicesEqual(workPath.ExcludePatterns, other.ExcludePatterns)
+}
+
+// matchAnyPattern returns whether the given path (relative to the workdir) matches any of the given patterns.
+// patterns that do not contain a separator are matched against the file name, others are matched against the whole
+// path where "**" matches any number of directories.
+func matchAnyPattern(patterns []string, relativeFilePath string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if matched, _ := filepath.Match(pattern, filepath.Base(relativeFilePath)); matched {
+				return true
+			}
+
+			continue
+		}
+
+		if matchPathSegments(strings.Split(pattern, "/"), strings.Split(relativeFilePath, "/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPathSegments returns whether the given path segments match the given pattern segments, where a "**" segment
+// matches any number of segments.
+func matchPathSegments(patternSegments []string, pathSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(pathSegments) == 0
+	}
+
+	if patternSegments[0] == doubleStar {
+		if len(patternSegments) == 1 {
+			return len(pathSegments) != 0 // trailing "**" matches everything inside a directory, not the directory
+		}
+
+		// "**" matches zero or more directories
+		for i := 0; i <= len(pathSegments); i++ {
+			if matchPathSegments(patternSegments[1:], pathSegments[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(pathSegments) == 0 {
+		return false
+	}
+
+	if matched, _ := filepath.Match(patternSegments[0], pathSegments[0]); !matched {
+		return false
+	}
+
+	return matchPathSegments(patternSegments[1:], pathSegments[1:])
+}
+
+func stringSlicesEqual(slice []string, other []string) bool {
+	if len(slice) != len(other) {
+		return false
+	}
+
+	for i := range slice {
+		if slice[i] != other[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,94 @@
+package dbsyncer
+
+import "testing"
+
+func TestMatchPathSegments(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{name: "leading ** with no directories", pattern: "**/*.yaml", path: "group.yaml", expected: true},
+		{name: "leading ** with nested directories", pattern: "**/*.yaml", path: "a/b/group.yaml", expected: true},
+		{name: "leading ** with other extension", pattern: "**/*.yaml", path: "a/b/group.json", expected: false},
+		{name: "middle ** with no directories", pattern: "groups/**/*.yaml", path: "groups/aws.yaml", expected: true},
+		{name: "middle ** with nested directories", pattern: "groups/**/*.yaml", path: "groups/a/b/aws.yaml",
+			expected: true},
+		{name: "middle ** with other root", pattern: "groups/**/*.yaml", path: "sets/a/aws.yaml", expected: false},
+		{name: "middle ** with segments after", pattern: "groups/**/prod/*.yaml", path: "groups/a/prod/aws.yaml",
+			expected: true},
+		{name: "middle ** with missing segment", pattern: "groups/**/prod/*.yaml", path: "groups/a/aws.yaml",
+			expected: false},
+		{name: "trailing ** with file", pattern: "groups/**", path: "groups/aws.yaml", expected: true},
+		{name: "trailing ** with nested file", pattern: "groups/**", path: "groups/a/b/aws.yaml", expected: true},
+		{name: "trailing ** with directory itself", pattern: "groups/**", path: "groups", expected: false},
+		{name: "no ** with exact depth", pattern: "groups/*.yaml", path: "groups/aws.yaml", expected: true},
+		{name: "no ** with nested file", pattern: "groups/*.yaml", path: "groups/a/aws.yaml", expected: false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := matchAnyPattern([]string{test.pattern}, test.path); actual != test.expected {
+				t.Fatalf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWorkPathContainsFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		workPath *WorkPath
+		filePath string
+		expected bool
+	}{
+		{name: "non-recursive file in workdir", workPath: &WorkPath{Path: "objects"},
+			filePath: "objects/group.yaml", expected: true},
+		{name: "non-recursive nested file", workPath: &WorkPath{Path: "objects"},
+			filePath: "objects/groups/group.yaml", expected: false},
+		{name: "non-recursive file out of workdir", workPath: &WorkPath{Path: "objects"},
+			filePath: "other/group.yaml", expected: false},
+		{name: "non-recursive with empty path", workPath: &WorkPath{}, filePath: "group.yaml", expected: true},
+		{name: "non-recursive with ** pattern", workPath: &WorkPath{IncludePatterns: []string{"**/*.yaml"}},
+			filePath: "groups/group.yaml", expected: false},
+		{name: "recursive nested file", workPath: &WorkPath{Path: "objects", Recursive: true},
+			filePath: "objects/groups/group.yaml", expected: true},
+		{name: "recursive file out of workdir", workPath: &WorkPath{Path: "objects", Recursive: true},
+			filePath: "objects-old/group.yaml", expected: false},
+		{name: "include matches", workPath: &WorkPath{Recursive: true, IncludePatterns: []string{"groups/**/*.yaml"}},
+			filePath: "groups/prod/group.yaml", expected: true},
+		{name: "include does not match", workPath: &WorkPath{Recursive: true,
+			IncludePatterns: []string{"groups/**/*.yaml"}}, filePath: "sets/prod/set.yaml", expected: false},
+		{name: "include by file name", workPath: &WorkPath{Recursive: true, IncludePatterns: []string{"*.yaml"}},
+			filePath: "groups/prod/group.yaml", expected: true},
+		{name: "include and exclude", workPath: &WorkPath{Recursive: true,
+			IncludePatterns: []string{"**/*.yaml"}, ExcludePatterns: []string{"**/test/**"}},
+			filePath: "groups/test/group.yaml", expected: false},
+		{name: "include and exclude of other files", workPath: &WorkPath{Recursive: true,
+			IncludePatterns: []string{"**/*.yaml"}, ExcludePatterns: []string{"**/test/**"}},
+			filePath: "groups/prod/group.yaml", expected: true},
+		{name: "exclude only", workPath: &WorkPath{Recursive: true, ExcludePatterns: []string{"*.md"}},
+			filePath: "groups/README.md", expected: false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := test.workPath.ContainsFile(test.filePath); actual != test.expected {
+				t.Fatalf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	appv1 "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DriftDetectionModeDisabled disables the drift detection.
+	DriftDetectionModeDisabled = "disabled"
+	// DriftDetectionModeReport only reports the drift between the git desired labels and the DB labels.
+	DriftDetectionModeReport = "report"
+	// DriftDetectionModeCorrect reports the drift and corrects it right away (unless the subscription is planned).
+	DriftDetectionModeCorrect = "correct"
+	// driftedClustersAnnotation holds the number of managed clusters whose labels drifted in the last drift detection.
+	driftedClustersAnnotation = db.HubOfHubsGroup + "/gitops-drifted-clusters"
+)
+
+// detectDrift detects (and corrects, if configured) the drift of the labels of all synced repos.
+func (walker *gitStorageWalker) detectDrift(ctx context.Context) {
+	gitRepos, err := ioutil.ReadDir(walker.rootDirPath)
+	if err != nil {
+		walker.log.Error(err, "failed to open git root folder", "root-path", walker.rootDirPath)
+		return
+	}
+
+	for _, gitRepo := range gitRepos {
+		if !gitRepo.IsDir() {
+			continue // stray file
+		}
+
+		info, err := walker.getInfoFromSubscription(ctx, gitRepo.Name())
+		if err != nil {
+			continue // handled by the sync
+		}
+
+		// planned subscriptions must not be changed, their drift is only reported
+		correct := walker.driftDetectionMode == DriftDetectionModeCorrect && !walker.planMode && !info.dryRun
+
+		report := walker.dbSyncer.DetectDrift(ctx, filepath.Join(walker.rootDirPath, gitRepo.Name()), correct)
+		if report == nil {
+			continue // repo was not synced
+		}
+
+		walker.handleDriftReport(ctx, info.subscription, report)
+	}
+}
+
+// handleDriftReport logs the drift report of a subscription's repo and reports it as metrics and as an annotation on
+// the subscription.
+func (walker *gitStorageWalker) handleDriftReport(ctx context.Context, subscription *appv1.Subscription,
+	report *dbsyncer.DriftReport,
+) {
+	if report.Error != "" {
+		walker.log.Info("failed to detect drift of local git repo", "path", subscription.Name, "error", report.Error)
+		return
+	}
+
+	driftedManagedClustersCount := report.GetDriftedManagedClustersCount()
+	walker.metrics.DriftedManagedClusters.WithLabelValues(subscription.Name).Set(
+		float64(driftedManagedClustersCount))
+
+	for _, objectDrift := range report.Drifts {
+		if objectDrift.Error != "" {
+			walker.log.Info("failed to detect or correct drift of object", "path", subscription.Name,
+				"file", objectDrift.FilePath, "object", objectDrift.Object, "error", objectDrift.Error)
+
+			continue
+		}
+
+		walker.log.Info("detected drift of object", "path", subscription.Name, "file", objectDrift.FilePath,
+			"object", objectDrift.Object, "corrected", objectDrift.Corrected)
+	}
+
+	walker.metrics.DriftCorrectedManagedClusters.Add(float64(report.GetCorrectedManagedClustersCount()))
+
+	if err := walker.reportDrift(ctx, subscription, driftedManagedClustersCount); err != nil {
+		walker.log.Error(err, "failed to report drift of local git repo", "path", subscription.Name)
+	}
+}
+
+// reportDrift reports the number of drifted managed clusters as an annotation on the subscription, if changed.
+func (walker *gitStorageWalker) reportDrift(ctx context.Context, subscription *appv1.Subscription,
+	driftedManagedClustersCount int,
+) error {
+	driftedManagedClustersCountString := strconv.Itoa(driftedManagedClustersCount)
+	if subscription.Annotations[driftedClustersAnnotation] == driftedManagedClustersCountString {
+		return nil // not changed
+	}
+
+	originalSubscription := subscription.DeepCopy()
+
+	if subscription.Annotations == nil {
+		subscription.Annotations = map[string]string{}
+	}
+
+	subscription.Annotations[driftedClustersAnnotation] = driftedManagedClustersCountString
+
+	if err := walker.k8sClient.Patch(ctx, subscription, client.MergeFrom(originalSubscription)); err != nil {
+		return fmt.Errorf("failed to patch subscription %s - %w", subscription.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// reevaluateDynamicIdentifiers re-resolves the dynamic identifiers of the objects of all synced repos against the
+// status DB and applies the resulting label changes, so that the labels follow the managed clusters that join / leave
+// the identified managed clusters without waiting for a new commit.
+func (walker *gitStorageWalker) reevaluateDynamicIdentifiers(ctx context.Context) {
+	gitRepos, err := ioutil.ReadDir(walker.rootDirPath)
+	if err != nil {
+		walker.log.Error(err, "failed to open git root folder", "root-path", walker.rootDirPath)
+		return
+	}
+
+	for _, gitRepo := range gitRepos {
+		if !gitRepo.IsDir() {
+			continue // stray file
+		}
+
+		info, err := walker.getInfoFromSubscription(ctx, gitRepo.Name())
+		if err != nil {
+			continue // handled by the sync
+		}
+
+		if walker.planMode || info.dryRun {
+			continue // planned subscriptions must not be changed
+		}
+
+		report := walker.dbSyncer.ReevaluateDynamicObjects(ctx, filepath.Join(walker.rootDirPath, gitRepo.Name()))
+		if report == nil {
+			continue // repo was not synced
+		}
+
+		if report.Error != "" {
+			walker.log.Info("failed to re-evaluate dynamic identifiers of local git repo", "path", gitRepo.Name(),
+				"error", report.Error)
+
+			continue
+		}
+
+		for _, objectDrift := range report.Drifts {
+			if objectDrift.Error != "" {
+				walker.log.Info("failed to re-evaluate dynamic identifiers of object", "path", gitRepo.Name(),
+					"file", objectDrift.FilePath, "object", objectDrift.Object, "error", objectDrift.Error)
+
+				continue
+			}
+
+			walker.log.Info("updated managed clusters of object with dynamic identifiers", "path", gitRepo.Name(),
+				"file", objectDrift.FilePath, "object", objectDrift.Object)
+		}
+
+		walker.metrics.MembershipUpdatedManagedClusters.Add(float64(report.GetCorrectedManagedClustersCount()))
+	}
+}
@@ -4,15 +4,24 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/intervalpolicy"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/metrics"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
 	appv1 "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -20,30 +29,73 @@ import (
 const (
 	hubOfHubsSubscriptionsNamespace = "hoh-subscriptions"
 	fullReconciliationInterval      = 1 * time.Hour
+	// recursiveAnnotation sets whether files in nested directories of the git-path are synced ("true" / "false").
+	recursiveAnnotation = db.HubOfHubsGroup + "/gitops-recursive"
+	// includeAnnotation holds comma-separated glob patterns of files to sync.
+	includeAnnotation = db.HubOfHubsGroup + "/gitops-include"
+	// excludeAnnotation holds comma-separated glob patterns of files not to sync.
+	excludeAnnotation = db.HubOfHubsGroup + "/gitops-exclude"
+	// planAnnotation sets whether the subscription's changes are only planned (published) but not applied.
+	planAnnotation = db.HubOfHubsGroup + "/gitops-plan"
 )
 
 var (
-	errSyncerTagNotFound                = fmt.Errorf("subscription's assigned syncer tag is not registered")
 	errUserIdentityAnnotationNotFound   = fmt.Errorf("user-identity annotation was not found on subscription")
 	errUserGroupAnnotationNotFound      = fmt.Errorf("user-group annotation was not found on subscription")
 	errHubOfHubsGitopsPlacementNotFound = fmt.Errorf("hubOfHubsGitOps was not set in subscription.spec.placement")
+	errSyncCycleNotCompleted            = fmt.Errorf("git storage walker did not complete a sync cycle")
 )
 
-// gitStorageWalker watches a local git storage root (contains git repositories) and syncs entries via registered
-// syncers.
+// subscriptionInfo wraps the information that is needed from a subscription CR to sync its git repo.
+type subscriptionInfo struct {
+	subscription       *appv1.Subscription
+	dryRun             bool
+	workPath           *dbsyncer.WorkPath
+	base64UserIdentity string
+	base64UserGroup    string
+}
+
+// gitStorageWalker watches a local git storage root (contains git repositories) and syncs entries via a syncer that
+// routes objects by their kinds.
 type gitStorageWalker struct {
 	log            logr.Logger
 	k8sClient      client.Client
+	eventRecorder  record.EventRecorder
 	rootDirPath    string
-	tagToSyncerMap map[string]dbsyncer.StorageToDBSyncer
+	dbSyncer       dbsyncer.StorageToDBSyncer
 	intervalPolicy intervalpolicy.IntervalPolicy
+	// planMode sets whether the changes of all subscriptions are only planned (published) but not applied.
+	planMode bool
+	metrics  *metrics.Metrics
+	// livenessWindow is the max duration allowed between completed sync cycles before the walker is considered stuck.
+	livenessWindow time.Duration
+	// lastSyncCycleTime holds the time (unix nano) of the last completed sync cycle, accessed atomically.
+	lastSyncCycleTime int64
+	// driftDetectionMode is one of DriftDetectionModeDisabled, DriftDetectionModeReport or DriftDetectionModeCorrect.
+	driftDetectionMode string
+	// driftDetectionInterval is the interval between drift detections of all synced repos.
+	driftDetectionInterval time.Duration
+	// dynamicIdentifiersInterval is the interval between re-evaluations of the dynamic identifiers of all synced
+	// repos. zero if disabled.
+	dynamicIdentifiersInterval time.Duration
 }
 
 func (walker *gitStorageWalker) Start(ctx context.Context) error {
+	walker.markSyncCycleCompleted() // the liveness window starts when the walker starts
 	walker.init(ctx)
+	walker.markSyncCycleCompleted()
 
 	go walker.periodicSync(ctx)
 
+	// drift detection and re-evaluation run on their own, so that slow DB rounds do not delay the syncs
+	if walker.driftDetectionMode != DriftDetectionModeDisabled {
+		go walker.periodicDriftDetection(ctx)
+	}
+
+	if walker.dynamicIdentifiersInterval > 0 {
+		go walker.periodicDynamicIdentifiersReevaluation(ctx)
+	}
+
 	<-ctx.Done() // blocking wait for cancel context event
 	walker.log.Info("git storage walker", "root", walker.rootDirPath)
 
@@ -52,11 +104,12 @@ func (walker *gitStorageWalker) Start(ctx context.Context) error {
 
 func (walker *gitStorageWalker) init(ctx context.Context) {
 	walker.log.Info("initialized git storage walker", "root", walker.rootDirPath)
-	walker.syncGitRepos(ctx, true)
+	walker.syncGitRepos(ctx, false) // synced commits are persisted, resume from where the last leader stopped
 }
 
 func (walker *gitStorageWalker) periodicSync(ctx context.Context) {
 	ticker := time.NewTicker(walker.intervalPolicy.GetInterval())
+	walker.metrics.SyncInterval.Set(walker.intervalPolicy.GetInterval().Seconds())
 	forceReconcileTicker := time.NewTicker(fullReconciliationInterval)
 
 	for {
@@ -67,6 +120,7 @@ func (walker *gitStorageWalker) periodicSync(ctx context.Context) {
 
 		case <-forceReconcileTicker.C:
 			walker.syncGitRepos(ctx, true)
+			walker.markSyncCycleCompleted()
 
 		case <-ticker.C:
 			// define timeout of max sync interval on the sync function
@@ -74,6 +128,7 @@ func (walker *gitStorageWalker) periodicSync(ctx context.Context) {
 			synced := walker.syncGitRepos(ctxWithTimeout, false)
 
 			cancelFunc() // cancel child ctx and is used to cleanup resources once context expires or sync is done.
+			walker.markSyncCycleCompleted()
 
 			// get current sync interval
 			currentInterval := walker.intervalPolicy.GetInterval()
@@ -91,16 +146,83 @@ func (walker *gitStorageWalker) periodicSync(ctx context.Context) {
 			// reset ticker if needed
 			if currentInterval != reevaluatedInterval {
 				ticker.Reset(reevaluatedInterval)
+				walker.metrics.SyncInterval.Set(reevaluatedInterval.Seconds())
 				walker.log.Info(fmt.Sprintf("sync interval has been reset to %s", reevaluatedInterval.String()))
 			}
 		}
 	}
 }
 
+// periodicDriftDetection detects the drift of all synced repos every drift detection interval. the syncer serializes
+// the detection of a repo with its syncs, so that the synced state does not change during detection.
+func (walker *gitStorageWalker) periodicDriftDetection(ctx context.Context) {
+	ticker := time.NewTicker(walker.driftDetectionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			ctxWithTimeout, cancelFunc := context.WithTimeout(ctx, walker.driftDetectionInterval)
+			walker.detectDrift(ctxWithTimeout)
+			cancelFunc()
+		}
+	}
+}
+
+// periodicDynamicIdentifiersReevaluation re-evaluates the dynamic identifiers of all synced repos every dynamic
+// identifiers interval. the syncer serializes the re-evaluation of a repo with its syncs, so that the synced state
+// does not change meanwhile.
+func (walker *gitStorageWalker) periodicDynamicIdentifiersReevaluation(ctx context.Context) {
+	ticker := time.NewTicker(walker.dynamicIdentifiersInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			ctxWithTimeout, cancelFunc := context.WithTimeout(ctx, walker.dynamicIdentifiersInterval)
+			walker.reevaluateDynamicIdentifiers(ctxWithTimeout)
+			cancelFunc()
+		}
+	}
+}
+
+// markSyncCycleCompleted records that a sync cycle was completed now.
+func (walker *gitStorageWalker) markSyncCycleCompleted() {
+	atomic.StoreInt64(&walker.lastSyncCycleTime, time.Now().UnixNano())
+}
+
+// checkLiveness is a liveness checker that fails if the walker did not complete a sync cycle within the liveness
+// window. a walker that was not started (e.g. not the leader) is considered alive.
+func (walker *gitStorageWalker) checkLiveness(_ *http.Request) error {
+	lastSyncCycleTime := atomic.LoadInt64(&walker.lastSyncCycleTime)
+	if lastSyncCycleTime == 0 {
+		return nil // not started
+	}
+
+	if elapsed := time.Since(time.Unix(0, lastSyncCycleTime)); elapsed > walker.livenessWindow {
+		return fmt.Errorf("%w within %s (last completed %s ago)", errSyncCycleNotCompleted,
+			walker.livenessWindow.String(), elapsed.String())
+	}
+
+	return nil
+}
+
 func (walker *gitStorageWalker) syncGitRepos(ctx context.Context, forceReconcile bool) bool {
+	ctx, span := tracing.StartSpan(ctx, "syncGitRepos", trace.WithAttributes(
+		attribute.String("root", walker.rootDirPath), attribute.Bool("force-reconcile", forceReconcile)))
+	defer span.End()
+
 	gitRepos, err := ioutil.ReadDir(walker.rootDirPath)
 	if err != nil {
 		walker.log.Error(err, "failed to open git root folder", "root-path", walker.rootDirPath)
+		tracing.SetError(span, err)
+
 		return false
 	}
 
@@ -111,18 +233,28 @@ func (walker *gitStorageWalker) syncGitRepos(ctx context.Context, forceReconcile
 			continue // stray file
 		}
 
+		walker.metrics.ReposScanned.Inc()
+
 		repoFullPath := filepath.Join(walker.rootDirPath, gitRepo.Name())
 
-		syncerTag, gitPath, base64UserIdentity, base64UserGroup,
-			err := walker.getInfoFromSubscription(ctx, gitRepo.Name())
+		info, err := walker.getInfoFromSubscription(ctx, gitRepo.Name())
 		if err != nil {
 			if apierrors.IsNotFound(err) {
-				// resource was deleted, delete folder (safe since writer writes by resource)
+				// resource was deleted, un-deploy the objects that were synced from the repo before deleting it
+				if !walker.dbSyncer.DeleteGitRepo(ctx, repoFullPath) {
+					walker.log.Info("failed to un-deploy repo for deleted subscription", "path", gitRepo.Name())
+					successRate--
+
+					continue
+				}
+				// delete folder (safe since writer writes by resource)
 				if err := os.RemoveAll(repoFullPath); err != nil {
 					walker.log.Error(err, "failed to delete repo for deleted subscription", "path", gitRepo.Name())
 					successRate--
 				}
 
+				walker.metrics.DriftedManagedClusters.DeleteLabelValues(gitRepo.Name())
+
 				continue
 			}
 
@@ -132,16 +264,32 @@ func (walker *gitStorageWalker) syncGitRepos(ctx context.Context, forceReconcile
 			continue
 		}
 
-		dbSyncer, found := walker.tagToSyncerMap[syncerTag]
-		if !found {
-			walker.log.Error(errSyncerTagNotFound, "failed to sync local git repo", "path", gitRepo.Name(),
-				"walker-tag", syncerTag)
-			successRate--
+		dryRun := walker.planMode || info.dryRun
 
-			continue
+		plan := walker.dbSyncer.SyncGitRepo(ctx, info.base64UserIdentity, info.base64UserGroup, repoFullPath,
+			info.workPath, forceReconcile, dryRun)
+		if plan == nil {
+			continue // no updates
 		}
 
-		if dbSyncer.SyncGitRepo(ctx, base64UserIdentity, base64UserGroup, repoFullPath, gitPath, forceReconcile) {
+		if dryRun {
+			if err := walker.publishPlan(ctx, info.subscription, plan); err != nil {
+				walker.log.Error(err, "failed to publish plan of local git repo", "path", gitRepo.Name())
+				successRate--
+
+				continue
+			}
+		} else {
+			if err := walker.reportStatus(ctx, info.subscription, info.base64UserIdentity, plan); err != nil {
+				walker.log.Error(err, "failed to report sync status of local git repo", "path", gitRepo.Name())
+			}
+
+			if err := walker.publishSyncReport(ctx, info.subscription, plan); err != nil {
+				walker.log.Error(err, "failed to publish sync report of local git repo", "path", gitRepo.Name())
+			}
+		}
+
+		if plan.Succeeded() {
 			successRate++
 		}
 	}
@@ -149,11 +297,12 @@ func (walker *gitStorageWalker) syncGitRepos(ctx context.Context, forceReconcile
 	return successRate > 0 // majority succeeded
 }
 
-// getInfoFromSubscription opens a subscription CR and returns syncer tag (spec.placement.hubOfHubsGitOps),
-// gitpath annotation value, base64(user-identity), base64(user-group) and error if failed.
+// getInfoFromSubscription opens a subscription CR and returns it along with whether it is in plan mode, the work path
+// (gitpath annotation value and gitops file-selection annotations), base64(user-identity), base64(user-group) and
+// error if failed.
 func (walker *gitStorageWalker) getInfoFromSubscription(ctx context.Context,
 	subscriptionName string,
-) (string, string, string, string, error) {
+) (*subscriptionInfo, error) {
 	subscription := &appv1.Subscription{}
 	// try to get subscription
 	objKey := client.ObjectKey{
@@ -161,29 +310,83 @@ func (walker *gitStorageWalker) getInfoFromSubscription(ctx context.Context,
 		Name:      subscriptionName,
 	}
 	if err := walker.k8sClient.Get(ctx, objKey, subscription); err != nil {
-		if !apierrors.IsNotFound(err) {
-			return "", "", "", "", apierrors.NewNotFound(schema.GroupResource{Group: subscription.APIVersion},
-				subscriptionName)
-		}
+		// NotFound is kept wrapped so that callers only un-deploy repos of subscriptions that were actually deleted
+		return nil, fmt.Errorf("failed to get subscription with name %s - %w", subscriptionName, err)
+	}
 
-		return "", "", "", "", fmt.Errorf("failed to get subscription with name %s - %w", subscriptionName, err)
+	workPath, err := getWorkPathFromSubscription(subscription)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get work path of subscription with name %s - %w", subscriptionName, err)
 	}
 
-	gitPath := subscription.Annotations[appv1.AnnotationGitPath]
+	dryRun := false
+
+	if plan, found := subscription.Annotations[planAnnotation]; found {
+		parsedPlan, err := strconv.ParseBool(plan)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation value - %w", planAnnotation, err)
+		}
+
+		dryRun = parsedPlan
+	}
 
 	base64UserIdentity, found := subscription.Annotations[appv1.AnnotationUserIdentity]
 	if !found {
-		return "", "", "", "", errUserIdentityAnnotationNotFound
+		return nil, errUserIdentityAnnotationNotFound
 	}
 
 	base64UserGroup, found := subscription.Annotations[appv1.AnnotationUserGroup]
 	if !found {
-		return "", "", "", "", errUserGroupAnnotationNotFound
+		return nil, errUserGroupAnnotationNotFound
 	}
 
+	// objects are routed by their kinds, the field only marks the subscription as handled by hub-of-hubs-gitops
 	if subscription.Spec.Placement.HubOfHubsGitOps == nil { // shouldn't happen but just for safety
-		return "", "", "", "", errHubOfHubsGitopsPlacementNotFound
+		return nil, errHubOfHubsGitopsPlacementNotFound
+	}
+
+	return &subscriptionInfo{
+		subscription:       subscription,
+		dryRun:             dryRun,
+		workPath:           workPath,
+		base64UserIdentity: base64UserIdentity,
+		base64UserGroup:    base64UserGroup,
+	}, nil
+}
+
+// getWorkPathFromSubscription returns the work path defined by the gitpath and gitops file-selection annotations.
+func getWorkPathFromSubscription(subscription *appv1.Subscription) (*dbsyncer.WorkPath, error) {
+	workPath := &dbsyncer.WorkPath{
+		Path:            subscription.Annotations[appv1.AnnotationGitPath],
+		IncludePatterns: splitPatterns(subscription.Annotations[includeAnnotation]),
+		ExcludePatterns: splitPatterns(subscription.Annotations[excludeAnnotation]),
+	}
+
+	if recursive, found := subscription.Annotations[recursiveAnnotation]; found {
+		parsedRecursive, err := strconv.ParseBool(recursive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation value - %w", recursiveAnnotation, err)
+		}
+
+		workPath.Recursive = parsedRecursive
+	}
+
+	if err := workPath.ValidatePatterns(); err != nil {
+		return nil, fmt.Errorf("invalid file-selection annotation value - %w", err)
+	}
+
+	return workPath, nil
+}
+
+// splitPatterns returns the patterns in a comma-separated list, ignoring empty entries.
+func splitPatterns(commaSeparatedPatterns string) []string {
+	patterns := make([]string, 0)
+
+	for _, pattern := range strings.Split(commaSeparatedPatterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
 	}
 
-	return *subscription.Spec.Placement.HubOfHubsGitOps, gitPath, base64UserIdentity, base64UserGroup, nil
+	return patterns
 }
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appv1 "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	planConfigMapNameSuffix = "-gitops-plan"
+	planConfigMapDataKey    = "plan.yaml"
+)
+
+// publishPlan publishes the plan of a subscription's repo sync as a ConfigMap named {subscription}-gitops-plan in the
+// subscriptions namespace. the ConfigMap is owned by the subscription, so it is garbage-collected along with it.
+func (walker *gitStorageWalker) publishPlan(ctx context.Context, subscription *appv1.Subscription,
+	plan *dbsyncer.SyncPlan,
+) error {
+	planBytes, err := yaml.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan - %w", err)
+	}
+
+	planConfigMap := &corev1.ConfigMap{}
+	objKey := client.ObjectKey{
+		Namespace: subscription.Namespace,
+		Name:      subscription.Name + planConfigMapNameSuffix,
+	}
+
+	if err := walker.k8sClient.Get(ctx, objKey, planConfigMap); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get plan ConfigMap %s - %w", objKey.Name, err)
+		}
+
+		planConfigMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      objKey.Name,
+				Namespace: objKey.Namespace,
+				Labels:    map[string]string{dbsyncer.GitOpsSubscriptionLabelKey: subscription.Name},
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(subscription, appv1.SchemeGroupVersion.WithKind("Subscription")),
+				},
+			},
+			Data: map[string]string{planConfigMapDataKey: string(planBytes)},
+		}
+
+		if err := walker.k8sClient.Create(ctx, planConfigMap); err != nil {
+			return fmt.Errorf("failed to create plan ConfigMap %s - %w", objKey.Name, err)
+		}
+
+		return nil
+	}
+
+	if planConfigMap.Data[planConfigMapDataKey] == string(planBytes) {
+		return nil // plan was not changed
+	}
+
+	planConfigMap.Data = map[string]string{planConfigMapDataKey: string(planBytes)}
+
+	if err := walker.k8sClient.Update(ctx, planConfigMap); err != nil {
+		return fmt.Errorf("failed to update plan ConfigMap %s - %w", objKey.Name, err)
+	}
+
+	return nil
+}
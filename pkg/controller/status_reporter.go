@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	corev1 "k8s.io/api/core/v1"
+	appv1 "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// lastSyncedCommitAnnotation holds the ID of the last commit that was fully synced.
+	lastSyncedCommitAnnotation = db.HubOfHubsGroup + "/gitops-last-synced-commit"
+	// lastSyncAttemptAnnotation holds the time (RFC3339) of the last sync attempt.
+	lastSyncAttemptAnnotation = db.HubOfHubsGroup + "/gitops-last-sync-attempt"
+	// lastSyncAttemptRefreshInterval is the minimal interval between updates of the last sync attempt annotation of
+	// a failing sync whose status did not change.
+	lastSyncAttemptRefreshInterval = 5 * time.Minute
+	// syncErrorsAnnotation holds the errors of the last sync attempt as a JSON list. removed if succeeded.
+	syncErrorsAnnotation = db.HubOfHubsGroup + "/gitops-sync-errors"
+	// unauthorizedClustersAnnotation holds the number of managed clusters that were filtered out in the last sync
+	// attempt since the subscription's user is not authorized to access them.
+	unauthorizedClustersAnnotation = db.HubOfHubsGroup + "/gitops-unauthorized-clusters"
+	// unauthorizedClustersEventReason is the reason of events that report managed clusters that were filtered out.
+	unauthorizedClustersEventReason = "UnauthorizedManagedClusters"
+)
+
+// reportStatus reports the status of a subscription's repo sync as annotations on the subscription, and records
+// events for the managed clusters that were filtered out. a failing sync is retried on every tick, so its status and
+// events are reported only if they differ from the reported ones (its errors or its number of unauthorized managed
+// clusters), otherwise only the last sync attempt is updated, at most once per lastSyncAttemptRefreshInterval.
+func (walker *gitStorageWalker) reportStatus(ctx context.Context, subscription *appv1.Subscription,
+	base64UserIdentity string, plan *dbsyncer.SyncPlan,
+) error {
+	now := time.Now().UTC()
+	sameFailure := false
+
+	unauthorizedClusters := strconv.Itoa(plan.GetUnauthorizedManagedClustersCount())
+	syncErrors := plan.GetErrors()
+	syncErrorsString := ""
+
+	if len(syncErrors) != 0 {
+		syncErrorsBytes, err := json.Marshal(syncErrors)
+		if err != nil {
+			return fmt.Errorf("failed to marshal sync errors - %w", err)
+		}
+
+		syncErrorsString = string(syncErrorsBytes)
+		sameFailure = subscription.Annotations[syncErrorsAnnotation] == syncErrorsString &&
+			subscription.Annotations[unauthorizedClustersAnnotation] == unauthorizedClusters
+	}
+
+	if sameFailure && !isLastSyncAttemptStale(subscription, now) {
+		return nil // same failure as reported, recently
+	}
+
+	originalSubscription := subscription.DeepCopy()
+
+	if subscription.Annotations == nil {
+		subscription.Annotations = map[string]string{}
+	}
+
+	subscription.Annotations[lastSyncAttemptAnnotation] = now.Format(time.RFC3339)
+
+	if !sameFailure {
+		walker.recordUnauthorizedManagedClustersEvents(subscription, base64UserIdentity, plan)
+
+		subscription.Annotations[unauthorizedClustersAnnotation] = unauthorizedClusters
+
+		if syncErrorsString != "" {
+			subscription.Annotations[syncErrorsAnnotation] = syncErrorsString
+		} else {
+			subscription.Annotations[lastSyncedCommitAnnotation] = plan.CommitID
+			delete(subscription.Annotations, syncErrorsAnnotation)
+		}
+	}
+
+	if err := walker.k8sClient.Patch(ctx, subscription, client.MergeFrom(originalSubscription)); err != nil {
+		return fmt.Errorf("failed to patch subscription %s - %w", subscription.Name, err)
+	}
+
+	return nil
+}
+
+// isLastSyncAttemptStale returns whether the last sync attempt reported on the subscription is older than
+// lastSyncAttemptRefreshInterval (or is missing / invalid).
+func isLastSyncAttemptStale(subscription *appv1.Subscription, now time.Time) bool {
+	lastSyncAttempt, err := time.Parse(time.RFC3339, subscription.Annotations[lastSyncAttemptAnnotation])
+
+	return err != nil || now.Sub(lastSyncAttempt) >= lastSyncAttemptRefreshInterval
+}
+
+// recordUnauthorizedManagedClustersEvents records a warning event on the subscription for each synced object that had
+// managed clusters filtered out since the subscription's user is not authorized to access them.
+func (walker *gitStorageWalker) recordUnauthorizedManagedClustersEvents(subscription *appv1.Subscription,
+	base64UserIdentity string, plan *dbsyncer.SyncPlan,
+) {
+	// get decoded identity - assuming correctness because annotated by operator
+	userID, _ := base64.StdEncoding.DecodeString(base64UserIdentity)
+
+	for _, change := range plan.Changes {
+		for _, labelChange := range change.LabelChanges {
+			if len(labelChange.UnauthorizedManagedClusters) == 0 {
+				continue
+			}
+
+			walker.eventRecorder.Eventf(subscription, corev1.EventTypeWarning, unauthorizedClustersEventReason,
+				"user %s is not authorized to access managed clusters, label %s was not changed for them "+
+					"(object %s, file %s, document %d): %s", string(userID), labelChange.Key, change.Object,
+				change.FilePath, change.DocumentIndex,
+				formatHubToManagedClustersMap(labelChange.UnauthorizedManagedClusters))
+		}
+	}
+}
+
+// formatHubToManagedClustersMap returns a string representation (hub: [clusters], ...) of a map of hub -> managed
+// clusters, sorted by hub.
+func formatHubToManagedClustersMap(hubToManagedClustersMap map[string][]string) string {
+	hubNames := make([]string, 0, len(hubToManagedClustersMap))
+	for hubName := range hubToManagedClustersMap {
+		hubNames = append(hubNames, hubName)
+	}
+
+	sort.Strings(hubNames)
+
+	hubStrings := make([]string, 0, len(hubNames))
+	for _, hubName := range hubNames {
+		hubStrings = append(hubStrings, fmt.Sprintf("%s: [%s]", hubName,
+			strings.Join(hubToManagedClustersMap[hubName], ", ")))
+	}
+
+	return strings.Join(hubStrings, ", ")
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	appv1 "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestFailedPlan(syncError string, unauthorizedManagedClusters map[string][]string) *dbsyncer.SyncPlan {
+	return &dbsyncer.SyncPlan{
+		CommitID: "commit2",
+		Changes: []*dbsyncer.ObjectChange{{
+			FilePath: "groups.yaml",
+			Object:   "ManagedClustersGroup/aws",
+			LabelChanges: []*dbsyncer.LabelChange{{
+				Key:                         "hub-of-hubs.open-cluster-management.io/aws",
+				Value:                       "true",
+				UnauthorizedManagedClusters: unauthorizedManagedClusters,
+			}},
+			Error: syncError,
+		}},
+	}
+}
+
+func TestReportStatus(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to create scheme - %v", err)
+	}
+
+	subscriptionKey := client.ObjectKey{Namespace: hubOfHubsSubscriptionsNamespace, Name: "subscription"}
+	eventRecorder := record.NewFakeRecorder(10)
+	walker := &gitStorageWalker{
+		k8sClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(&appv1.Subscription{
+			ObjectMeta: metav1.ObjectMeta{Namespace: subscriptionKey.Namespace, Name: subscriptionKey.Name},
+		}).Build(),
+		eventRecorder: eventRecorder,
+	}
+
+	unauthorizedManagedClusters := map[string][]string{"hub1": {"cluster1"}}
+
+	staleLastSyncAttempt := time.Now().UTC().Add(-lastSyncAttemptRefreshInterval).Format(time.RFC3339)
+
+	steps := []struct {
+		name            string
+		plan            *dbsyncer.SyncPlan
+		lastSyncAttempt string
+		expectedEvents  int
+		expectReport    bool
+	}{
+		{
+			name:           "first failure",
+			plan:           newTestFailedPlan("failed to update labels", unauthorizedManagedClusters),
+			expectedEvents: 1,
+			expectReport:   true,
+		},
+		{
+			name:           "same failure",
+			plan:           newTestFailedPlan("failed to update labels", unauthorizedManagedClusters),
+			expectedEvents: 0,
+			expectReport:   false,
+		},
+		{
+			name:            "same failure after refresh interval",
+			plan:            newTestFailedPlan("failed to update labels", unauthorizedManagedClusters),
+			lastSyncAttempt: staleLastSyncAttempt,
+			expectedEvents:  0,
+			expectReport:    true,
+		},
+		{
+			name:           "failure with other errors",
+			plan:           newTestFailedPlan("failed to get managed clusters", unauthorizedManagedClusters),
+			expectedEvents: 1,
+			expectReport:   true,
+		},
+		{
+			name: "failure with other unauthorized managed clusters",
+			plan: newTestFailedPlan("failed to get managed clusters",
+				map[string][]string{"hub1": {"cluster1", "cluster2"}}),
+			expectedEvents: 1,
+			expectReport:   true,
+		},
+		{
+			name:           "success",
+			plan:           &dbsyncer.SyncPlan{CommitID: "commit2"},
+			expectedEvents: 0,
+			expectReport:   true,
+		},
+	}
+
+	// steps depend on the status reported by the previous steps
+	for _, step := range steps {
+		subscription := &appv1.Subscription{}
+		if err := walker.k8sClient.Get(ctx, subscriptionKey, subscription); err != nil {
+			t.Fatalf("%s: failed to get subscription - %v", step.name, err)
+		}
+
+		if step.lastSyncAttempt != "" {
+			subscription.Annotations[lastSyncAttemptAnnotation] = step.lastSyncAttempt
+			if err := walker.k8sClient.Update(ctx, subscription); err != nil {
+				t.Fatalf("%s: failed to update subscription - %v", step.name, err)
+			}
+		}
+
+		resourceVersion := subscription.ResourceVersion
+		syncErrors := subscription.Annotations[syncErrorsAnnotation]
+
+		if err := walker.reportStatus(ctx, subscription, "", step.plan); err != nil {
+			t.Fatalf("%s: failed to report status - %v", step.name, err)
+		}
+
+		if err := walker.k8sClient.Get(ctx, subscriptionKey, subscription); err != nil {
+			t.Fatalf("%s: failed to get subscription - %v", step.name, err)
+		}
+
+		if reported := subscription.ResourceVersion != resourceVersion; reported != step.expectReport {
+			t.Fatalf("%s: expected status reported: %t, got %t", step.name, step.expectReport, reported)
+		}
+
+		if step.lastSyncAttempt != "" {
+			if subscription.Annotations[lastSyncAttemptAnnotation] == step.lastSyncAttempt {
+				t.Fatalf("%s: expected last sync attempt to be updated", step.name)
+			}
+
+			if subscription.Annotations[syncErrorsAnnotation] != syncErrors {
+				t.Fatalf("%s: expected sync errors to be unchanged", step.name)
+			}
+		}
+
+		if len(eventRecorder.Events) != step.expectedEvents {
+			t.Fatalf("%s: expected %d events, got %d", step.name, step.expectedEvents, len(eventRecorder.Events))
+		}
+
+		for len(eventRecorder.Events) != 0 {
+			<-eventRecorder.Events
+		}
+	}
+
+	subscription := &appv1.Subscription{}
+	if err := walker.k8sClient.Get(ctx, subscriptionKey, subscription); err != nil {
+		t.Fatalf("failed to get subscription - %v", err)
+	}
+
+	if _, found := subscription.Annotations[syncErrorsAnnotation]; found {
+		t.Fatalf("expected sync errors annotation to be removed after success")
+	}
+
+	if commitID := subscription.Annotations[lastSyncedCommitAnnotation]; commitID != "commit2" {
+		t.Fatalf("expected last synced commit commit2, got %s", commitID)
+	}
+}
@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	set "github.com/deckarep/golang-set"
+	gitopsv1alpha1 "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/apis/v1alpha1"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appv1 "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// publishSyncReport publishes the result of a subscription's repo sync as a GitOpsSyncReport named after the
+// subscription in the subscription's namespace. the report is owned by the subscription, so it is garbage-collected
+// along with it. a failing sync that is retried with the same result does not update the report.
+func (walker *gitStorageWalker) publishSyncReport(ctx context.Context, subscription *appv1.Subscription,
+	plan *dbsyncer.SyncPlan,
+) error {
+	syncReport := &gitopsv1alpha1.GitOpsSyncReport{}
+	objKey := client.ObjectKey{
+		Namespace: subscription.Namespace,
+		Name:      subscription.Name,
+	}
+
+	if err := walker.k8sClient.Get(ctx, objKey, syncReport); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get GitOpsSyncReport %s - %w", objKey.Name, err)
+		}
+
+		syncReport = &gitopsv1alpha1.GitOpsSyncReport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      objKey.Name,
+				Namespace: objKey.Namespace,
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(subscription, appv1.SchemeGroupVersion.WithKind("Subscription")),
+				},
+			},
+			Status: getSyncReportStatus(plan),
+		}
+
+		if err := walker.k8sClient.Create(ctx, syncReport); err != nil {
+			return fmt.Errorf("failed to create GitOpsSyncReport %s - %w", objKey.Name, err)
+		}
+
+		return nil
+	}
+
+	syncReportStatus := getSyncReportStatus(plan)
+	if !plan.Succeeded() && isSameSyncResult(&syncReport.Status, &syncReportStatus) {
+		return nil
+	}
+
+	syncReport.Status = syncReportStatus
+
+	if err := walker.k8sClient.Update(ctx, syncReport); err != nil {
+		return fmt.Errorf("failed to update GitOpsSyncReport %s - %w", objKey.Name, err)
+	}
+
+	return nil
+}
+
+// isSameSyncResult returns whether two sync report statuses hold the same result, regardless of the time and durations
+// of their syncs.
+func isSameSyncResult(status *gitopsv1alpha1.GitOpsSyncReportStatus,
+	otherStatus *gitopsv1alpha1.GitOpsSyncReportStatus,
+) bool {
+	return equality.Semantic.DeepEqual(getSyncResult(status), getSyncResult(otherStatus))
+}
+
+// getSyncResult returns a copy of a sync report status without the time and durations of its sync.
+func getSyncResult(status *gitopsv1alpha1.GitOpsSyncReportStatus) *gitopsv1alpha1.GitOpsSyncReportStatus {
+	syncResult := &gitopsv1alpha1.GitOpsSyncReportStatus{}
+	status.DeepCopyInto(syncResult)
+	syncResult.StartTime = metav1.Time{}
+	syncResult.Duration = metav1.Duration{}
+
+	for i := range syncResult.Files {
+		syncResult.Files[i].Duration = metav1.Duration{}
+	}
+
+	return syncResult
+}
+
+// getSyncReportStatus returns the sync report status of the given (applied) plan.
+func getSyncReportStatus(plan *dbsyncer.SyncPlan) gitopsv1alpha1.GitOpsSyncReportStatus {
+	return gitopsv1alpha1.GitOpsSyncReportStatus{
+		CommitID:     plan.CommitID,
+		FromCommitID: plan.FromCommitID,
+		Syncer:       plan.Syncer,
+		FullSync:     plan.FullSync,
+		Succeeded:    plan.Succeeded(),
+		Error:        plan.Error,
+		StartTime:    metav1.NewTime(plan.StartTime),
+		Duration:     metav1.Duration{Duration: plan.Duration},
+		Files:        getFileSyncResults(plan),
+		Hubs:         getHubSyncResults(plan),
+	}
+}
+
+// getFileSyncResults returns the outcomes of the files whose objects were synced (or un-deployed) by the plan, sorted
+// by path. pruned objects have no file and are not included.
+func getFileSyncResults(plan *dbsyncer.SyncPlan) []gitopsv1alpha1.FileSyncResult {
+	filePathToResultMap := map[string]*gitopsv1alpha1.FileSyncResult{}
+
+	for _, change := range plan.Changes {
+		if change.FilePath == "" {
+			continue
+		}
+
+		fileResult, found := filePathToResultMap[change.FilePath]
+		if !found {
+			fileResult = &gitopsv1alpha1.FileSyncResult{
+				Path:    change.FilePath,
+				Outcome: gitopsv1alpha1.FileSyncOutcomeApplied,
+			}
+			filePathToResultMap[change.FilePath] = fileResult
+		}
+
+		fileResult.Duration.Duration += change.Duration
+
+		if change.Error == "" {
+			continue
+		}
+
+		fileResult.Errors = append(fileResult.Errors, change.Error)
+
+		// a parse error takes precedence, it is the first thing to fix in the file
+		if change.ErrorReason == dbsyncer.ErrorReasonParse {
+			fileResult.Outcome = gitopsv1alpha1.FileSyncOutcomeParseError
+		} else if fileResult.Outcome != gitopsv1alpha1.FileSyncOutcomeParseError {
+			fileResult.Outcome = gitopsv1alpha1.FileSyncOutcomeDBError
+		}
+	}
+
+	fileResults := make([]gitopsv1alpha1.FileSyncResult, 0, len(filePathToResultMap))
+	for _, fileResult := range filePathToResultMap {
+		fileResults = append(fileResults, *fileResult)
+	}
+
+	sort.Slice(fileResults, func(i, j int) bool {
+		return fileResults[i].Path < fileResults[j].Path
+	})
+
+	return fileResults
+}
+
+// getHubSyncResults returns the counts of the (distinct) managed clusters that labels were applied to / denied for by
+// the plan, by hub, sorted by name. labels are applied only for objects that were synced successfully.
+func getHubSyncResults(plan *dbsyncer.SyncPlan) []gitopsv1alpha1.HubSyncResult {
+	hubToAppliedManagedClustersMap := map[string]set.Set{}
+	hubToDeniedManagedClustersMap := map[string]set.Set{}
+
+	for _, change := range plan.Changes {
+		for _, labelChange := range change.LabelChanges {
+			if change.Error == "" {
+				addToHubToManagedClustersMap(hubToAppliedManagedClustersMap, labelChange.AssignedManagedClusters)
+				addToHubToManagedClustersMap(hubToAppliedManagedClustersMap, labelChange.RemovedManagedClusters)
+			}
+
+			addToHubToManagedClustersMap(hubToDeniedManagedClustersMap, labelChange.UnauthorizedManagedClusters)
+		}
+	}
+
+	hubNames := set.NewSet()
+	for hubName := range hubToAppliedManagedClustersMap {
+		hubNames.Add(hubName)
+	}
+
+	for hubName := range hubToDeniedManagedClustersMap {
+		hubNames.Add(hubName)
+	}
+
+	hubResults := make([]gitopsv1alpha1.HubSyncResult, 0, hubNames.Cardinality())
+
+	for _, hubName := range hubNames.ToSlice() {
+		name, ok := hubName.(string)
+		if !ok {
+			continue
+		}
+
+		hubResult := gitopsv1alpha1.HubSyncResult{Name: name}
+
+		if appliedManagedClustersSet, found := hubToAppliedManagedClustersMap[name]; found {
+			hubResult.AppliedManagedClusters = appliedManagedClustersSet.Cardinality()
+		}
+
+		if deniedManagedClustersSet, found := hubToDeniedManagedClustersMap[name]; found {
+			hubResult.DeniedManagedClusters = deniedManagedClustersSet.Cardinality()
+		}
+
+		hubResults = append(hubResults, hubResult)
+	}
+
+	sort.Slice(hubResults, func(i, j int) bool {
+		return hubResults[i].Name < hubResults[j].Name
+	})
+
+	return hubResults
+}
+
+// addToHubToManagedClustersMap adds the managed clusters of a map of hub -> managed clusters to a map of hub -> set of
+// managed clusters.
+func addToHubToManagedClustersMap(hubToManagedClustersMap map[string]set.Set,
+	hubToManagedClustersSlicesMap map[string][]string,
+) {
+	for hubName, clusters := range hubToManagedClustersSlicesMap {
+		clustersSet, found := hubToManagedClustersMap[hubName]
+		if !found {
+			clustersSet = set.NewSet()
+			hubToManagedClustersMap[hubName] = clustersSet
+		}
+
+		for _, cluster := range clusters {
+			clustersSet.Add(cluster)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/apis/v1alpha1"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	appv1 "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestTimedPlan(plan *dbsyncer.SyncPlan, duration time.Duration) *dbsyncer.SyncPlan {
+	plan.StartTime = time.Now()
+	plan.Duration = duration
+
+	for _, change := range plan.Changes {
+		change.Duration = duration
+	}
+
+	return plan
+}
+
+func TestPublishSyncReport(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to create scheme - %v", err)
+	}
+
+	subscription := &appv1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Namespace: hubOfHubsSubscriptionsNamespace, Name: "subscription"},
+	}
+	syncReportKey := client.ObjectKey{Namespace: subscription.Namespace, Name: subscription.Name}
+	walker := &gitStorageWalker{
+		k8sClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(subscription).Build(),
+	}
+
+	unauthorizedManagedClusters := map[string][]string{"hub1": {"cluster1"}}
+
+	steps := []struct {
+		name         string
+		plan         *dbsyncer.SyncPlan
+		expectReport bool
+	}{
+		{
+			name:         "first failure",
+			plan:         newTestTimedPlan(newTestFailedPlan("failed to update labels", unauthorizedManagedClusters), 1),
+			expectReport: true,
+		},
+		{
+			name:         "same failure with other durations",
+			plan:         newTestTimedPlan(newTestFailedPlan("failed to update labels", unauthorizedManagedClusters), 2),
+			expectReport: false,
+		},
+		{
+			name:         "failure with other errors",
+			plan:         newTestTimedPlan(newTestFailedPlan("failed to get managed clusters", unauthorizedManagedClusters), 3),
+			expectReport: true,
+		},
+		{
+			name:         "success",
+			plan:         newTestTimedPlan(&dbsyncer.SyncPlan{CommitID: "commit2"}, 4),
+			expectReport: true,
+		},
+		{
+			name:         "same success",
+			plan:         newTestTimedPlan(&dbsyncer.SyncPlan{CommitID: "commit2"}, 5),
+			expectReport: true,
+		},
+	}
+
+	// steps depend on the report published by the previous steps
+	for _, step := range steps {
+		resourceVersion := ""
+
+		syncReport := &gitopsv1alpha1.GitOpsSyncReport{}
+		if err := walker.k8sClient.Get(ctx, syncReportKey, syncReport); err == nil {
+			resourceVersion = syncReport.ResourceVersion
+		}
+
+		if err := walker.publishSyncReport(ctx, subscription, step.plan); err != nil {
+			t.Fatalf("%s: failed to publish sync report - %v", step.name, err)
+		}
+
+		if err := walker.k8sClient.Get(ctx, syncReportKey, syncReport); err != nil {
+			t.Fatalf("%s: failed to get sync report - %v", step.name, err)
+		}
+
+		if reported := syncReport.ResourceVersion != resourceVersion; reported != step.expectReport {
+			t.Fatalf("%s: expected sync report published: %t, got %t", step.name, step.expectReport, reported)
+		}
+
+		if step.expectReport && syncReport.Status.Duration.Duration != step.plan.Duration {
+			t.Fatalf("%s: expected sync duration %v, got %v", step.name, step.plan.Duration,
+				syncReport.Status.Duration.Duration)
+		}
+	}
+}
@@ -16,6 +16,8 @@ const (
 // SpecDB is the needed interface for nonk8s-gitops DB related functionality.
 type SpecDB interface {
 	ManagedClusterLabelsSpecDB
+	ManagedClusterLabelOwnersSpecDB
+	GitRepoSyncStateSpecDB
 	// Stop stops db and releases resources (e.g. connection pool).
 	Stop()
 }
@@ -23,15 +25,79 @@ type SpecDB interface {
 // ManagedClusterLabelsSpecDB is the interface needed by the spec transport bridge to sync managed-cluster labels table.
 type ManagedClusterLabelsSpecDB interface {
 	// UpdateLabelForManagedClusters receives a map of hub -> set of managed clusters and updates their labels to be
-	// appended by the given label
+	// appended by the given label. the label changes are audited with the given audit info.
 	//
 	// If the operation fails, hubToManagedClustersMap will contain un-synced entries only.
 	UpdateLabelForManagedClusters(ctx context.Context, tableName string, labelKey string, labelValue string,
-		hubToManagedClustersMap map[string]set.Set) error
+		hubToManagedClustersMap map[string]set.Set, auditInfo *LabelsAuditInfo) error
+	// RemoveLabelForManagedClusters receives a map of hub -> set of managed clusters and updates their labels to
+	// have the given label key removed (marked as deleted). the label changes are audited with the given audit info.
+	//
+	// If the operation fails, hubToManagedClustersMap will contain un-synced entries only.
+	RemoveLabelForManagedClusters(ctx context.Context, tableName string, labelKey string,
+		hubToManagedClustersMap map[string]set.Set, auditInfo *LabelsAuditInfo) error
+	// GetManagedClustersByLabel returns a map of hub -> set of managed clusters whose labels contain the given key.
+	// If labelValue is not empty, only managed clusters that have the key assigned with labelValue are returned.
+	GetManagedClustersByLabel(ctx context.Context, tableName string, labelKey string,
+		labelValue string) (map[string]set.Set, error)
+	// GetManagedClustersLabelsStates returns a map of hub -> managed cluster -> labels state of all managed clusters
+	// in the table. the table is only read.
+	GetManagedClustersLabelsStates(ctx context.Context,
+		tableName string) (map[string]map[string]*ManagedClusterLabelsState, error)
 	// Stop stops db and releases resources (e.g. connection pool).
 	Stop()
 }
 
+// ManagedClusterLabelOwnersSpecDB is the interface needed by the syncers to record the objects (owners) that assigned
+// label keys to managed clusters, so that a label key that is assigned by several objects is removed by none of them
+// but the last one.
+type ManagedClusterLabelOwnersSpecDB interface {
+	// GetManagedClusterLabelOwners returns a map of owner -> hub -> set of managed clusters that the owner assigned with
+	// the given label key.
+	GetManagedClusterLabelOwners(ctx context.Context, tableName string,
+		labelKey string) (map[string]map[string]set.Set, error)
+	// GetOwnedLabelKeys returns the label keys that the given owner assigned to any managed cluster.
+	GetOwnedLabelKeys(ctx context.Context, tableName string, owner string) ([]string, error)
+	// UpdateManagedClusterLabelOwner replaces the managed clusters that the given owner assigned with the given label
+	// key by the given map of hub -> set of managed clusters. an empty map removes the owner from the label key.
+	UpdateManagedClusterLabelOwner(ctx context.Context, tableName string, owner string, labelKey string,
+		hubToManagedClustersMap map[string]set.Set) error
+}
+
+// GitRepoSyncStateSpecDB is the interface needed by the syncers to persist the sync state of git repos.
+type GitRepoSyncStateSpecDB interface {
+	// GetGitRepoSyncState returns the state of the last successful sync of a git repo by the given syncer. If the repo
+	// was not synced by the syncer, a state with an empty commit ID is returned.
+	GetGitRepoSyncState(ctx context.Context, tableName string, repoName string,
+		syncerName string) (*GitRepoSyncState, error)
+	// UpdateGitRepoSyncState inserts or updates the state of the last successful sync of a git repo by the given
+	// syncer.
+	UpdateGitRepoSyncState(ctx context.Context, tableName string, repoName string, syncerName string,
+		syncState *GitRepoSyncState) error
+	// DeleteGitRepoSyncState deletes the sync state of a git repo by the given syncer.
+	DeleteGitRepoSyncState(ctx context.Context, tableName string, repoName string, syncerName string) error
+}
+
+// GitRepoSyncState wraps the information of the last successful sync of a git repo.
+type GitRepoSyncState struct {
+	CommitID           string
+	WorkPath           string
+	Recursive          bool
+	IncludePatterns    []string
+	ExcludePatterns    []string
+	Base64UserIdentity string
+	Base64UserGroup    string
+}
+
+// LabelsAuditInfo wraps the information that identifies who made label changes, and from where.
+type LabelsAuditInfo struct {
+	UserIdentity string
+	UserGroup    string
+	RepoPath     string
+	CommitID     string
+	FilePath     string
+}
+
 // ManagedClusterLabelsState wraps the information that define a managed-cluster labels state.
 type ManagedClusterLabelsState struct {
 	LabelsMap        map[string]string
@@ -43,6 +109,8 @@ type StatusDB interface {
 	// GetAccessibleManagedClusters gets a map of hub -> set { managed-clusters } that are accessible with the given
 	// filter clause (WHERE ...).
 	GetAccessibleManagedClusters(ctx context.Context, tableName string, filterClause string) (map[string]set.Set, error)
+	// GetManagedClustersLabels returns a map of hub -> managed cluster -> labels of all managed clusters in the table.
+	GetManagedClustersLabels(ctx context.Context, tableName string) (map[string]map[string]map[string]string, error)
 	// Stop stops db and releases resources (e.g. connection pool).
 	Stop()
 }
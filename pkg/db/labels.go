@@ -0,0 +1,12 @@
+package db
+
+import "strings"
+
+// ManagedClusterSetLabelKey is the key of the label that assigns a managed cluster to a ManagedClusterSet.
+const ManagedClusterSetLabelKey = "cluster.open-cluster-management.io/clusterset"
+
+// LabelKeyIsAllowed returns whether a managed cluster label with the given key may be assigned by hub-of-hubs gitops.
+// labels with other keys are dropped when the labels of a managed cluster are updated.
+func LabelKeyIsAllowed(key string) bool {
+	return key == ManagedClusterSetLabelKey || strings.HasPrefix(key, HubOfHubsGroup)
+}
@@ -9,9 +9,14 @@ import (
 
 	set "github.com/deckarep/golang-set"
 	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
 	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/intervalpolicy"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/metrics"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -19,6 +24,9 @@ const (
 	envVarDatabaseURL                 = "DATABASE_URL"
 	optimisticConcurrencyRetriesCount = 5
 	retryInterval                     = 5 * time.Second
+	labelsAuditTableName              = "gitops_managed_clusters_labels_audit"
+	labelsAuditOperationAdd           = "add"
+	labelsAuditOperationRemove        = "remove"
 )
 
 var (
@@ -29,12 +37,13 @@ var (
 
 // PostgreSQL abstracts PostgreSQL client.
 type PostgreSQL struct {
-	log  logr.Logger
-	conn *pgxpool.Pool
+	log     logr.Logger
+	conn    *pgxpool.Pool
+	metrics *metrics.Metrics
 }
 
 // NewPostgreSQL creates a new instance of PostgreSQL object.
-func NewPostgreSQL() (*PostgreSQL, error) {
+func NewPostgreSQL(gitOpsMetrics *metrics.Metrics) (*PostgreSQL, error) {
 	databaseURL, found := os.LookupEnv(envVarDatabaseURL)
 	if !found {
 		return nil, fmt.Errorf("%w: %s", errEnvVarNotFound, envVarDatabaseURL)
@@ -46,8 +55,9 @@ func NewPostgreSQL() (*PostgreSQL, error) {
 	}
 
 	return &PostgreSQL{
-		log:  ctrl.Log.WithName("git-storage-walker"),
-		conn: dbConnectionPool,
+		log:     ctrl.Log.WithName("git-storage-walker"),
+		conn:    dbConnectionPool,
+		metrics: gitOpsMetrics,
 	}, nil
 }
 
@@ -56,12 +66,274 @@ func (p *PostgreSQL) Stop() {
 	p.conn.Close()
 }
 
+// Ping checks that a connection can be acquired from the pool and that the db responds.
+func (p *PostgreSQL) Ping(ctx context.Context) error {
+	if err := p.conn.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping db - %w", err)
+	}
+
+	return nil
+}
+
 // UpdateLabelForManagedClusters receives a map of hub -> set of managed clusters and updates their labels to be
-// appended by the given label
+// appended by the given label. the label changes are audited with the given audit info.
 //
 // If the operation fails, hubToManagedClustersMap will contain un-synced entries only.
 func (p *PostgreSQL) UpdateLabelForManagedClusters(ctx context.Context, tableName string, labelKey string,
-	labelValue string, hubToManagedClustersMap map[string]set.Set,
+	labelValue string, hubToManagedClustersMap map[string]set.Set, auditInfo *db.LabelsAuditInfo,
+) error {
+	return p.updateManagedClustersWithRetries(ctx, labelKey, hubToManagedClustersMap,
+		func(hubName string, clusterName string) error {
+			return p.updateLabels(ctx, hubName, clusterName, labelKey, labelValue, auditInfo)
+		})
+}
+
+// RemoveLabelForManagedClusters receives a map of hub -> set of managed clusters and updates their labels to have
+// the given label key removed (marked as deleted). the label changes are audited with the given audit info.
+//
+// If the operation fails, hubToManagedClustersMap will contain un-synced entries only.
+func (p *PostgreSQL) RemoveLabelForManagedClusters(ctx context.Context, tableName string, labelKey string,
+	hubToManagedClustersMap map[string]set.Set, auditInfo *db.LabelsAuditInfo,
+) error {
+	return p.updateManagedClustersWithRetries(ctx, labelKey, hubToManagedClustersMap,
+		func(hubName string, clusterName string) error {
+			return p.removeLabel(ctx, hubName, clusterName, labelKey, auditInfo)
+		})
+}
+
+// GetManagedClustersByLabel returns a map of hub -> set of managed clusters whose labels contain the given key.
+// If labelValue is not empty, only managed clusters that have the key assigned with labelValue are returned.
+func (p *PostgreSQL) GetManagedClustersByLabel(ctx context.Context, tableName string, labelKey string,
+	labelValue string,
+) (map[string]set.Set, error) {
+	hubToManagedClustersMap := map[string]set.Set{}
+
+	rows, err := p.conn.Query(ctx, fmt.Sprintf(`SELECT leaf_hub_name, managed_cluster_name FROM spec.%s WHERE 
+labels ? $1 AND ($2::text = '' OR labels->>$1 = $2)`, tableName), labelKey, labelValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from table spec.%s - %w", tableName, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			hubName            string
+			managedClusterName string
+		)
+
+		if err := rows.Scan(&hubName, &managedClusterName); err != nil {
+			return nil, fmt.Errorf("error reading from table spec.%s - %w", tableName, err)
+		}
+
+		clustersSet, found := hubToManagedClustersMap[hubName]
+		if !found {
+			clustersSet = set.NewSet()
+			hubToManagedClustersMap[hubName] = clustersSet
+		}
+
+		clustersSet.Add(managedClusterName)
+	}
+
+	return hubToManagedClustersMap, nil
+}
+
+// GetManagedClustersLabelsStates returns a map of hub -> managed cluster -> labels state of all managed clusters in
+// the table. the table is only read.
+func (p *PostgreSQL) GetManagedClustersLabelsStates(ctx context.Context,
+	tableName string,
+) (map[string]map[string]*db.ManagedClusterLabelsState, error) {
+	hubToManagedClusterLabelsStatesMap := map[string]map[string]*db.ManagedClusterLabelsState{}
+
+	rows, err := p.conn.Query(ctx, fmt.Sprintf(`SELECT leaf_hub_name, managed_cluster_name, labels, 
+deleted_label_keys FROM spec.%s`, tableName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from table spec.%s - %w", tableName, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			hubName            string
+			managedClusterName string
+			labelsState        db.ManagedClusterLabelsState
+		)
+
+		if err := rows.Scan(&hubName, &managedClusterName, &labelsState.LabelsMap,
+			&labelsState.DeletedLabelKeys); err != nil {
+			return nil, fmt.Errorf("error reading from table spec.%s - %w", tableName, err)
+		}
+
+		managedClusterToLabelsStateMap, found := hubToManagedClusterLabelsStatesMap[hubName]
+		if !found {
+			managedClusterToLabelsStateMap = map[string]*db.ManagedClusterLabelsState{}
+			hubToManagedClusterLabelsStatesMap[hubName] = managedClusterToLabelsStateMap
+		}
+
+		managedClusterToLabelsStateMap[managedClusterName] = &labelsState
+	}
+
+	return hubToManagedClusterLabelsStatesMap, nil
+}
+
+// GetManagedClusterLabelOwners returns a map of owner -> hub -> set of managed clusters that the owner assigned with
+// the given label key.
+func (p *PostgreSQL) GetManagedClusterLabelOwners(ctx context.Context, tableName string,
+	labelKey string,
+) (map[string]map[string]set.Set, error) {
+	ownerToHubToManagedClustersMap := map[string]map[string]set.Set{}
+
+	rows, err := p.conn.Query(ctx, fmt.Sprintf(`SELECT owner, leaf_hub_name, managed_cluster_name FROM spec.%s WHERE 
+label_key = $1`, tableName), labelKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from table spec.%s - %w", tableName, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			owner              string
+			hubName            string
+			managedClusterName string
+		)
+
+		if err := rows.Scan(&owner, &hubName, &managedClusterName); err != nil {
+			return nil, fmt.Errorf("error reading from table spec.%s - %w", tableName, err)
+		}
+
+		hubToManagedClustersMap, found := ownerToHubToManagedClustersMap[owner]
+		if !found {
+			hubToManagedClustersMap = map[string]set.Set{}
+			ownerToHubToManagedClustersMap[owner] = hubToManagedClustersMap
+		}
+
+		clustersSet, found := hubToManagedClustersMap[hubName]
+		if !found {
+			clustersSet = set.NewSet()
+			hubToManagedClustersMap[hubName] = clustersSet
+		}
+
+		clustersSet.Add(managedClusterName)
+	}
+
+	return ownerToHubToManagedClustersMap, nil
+}
+
+// GetOwnedLabelKeys returns the label keys that the given owner assigned to any managed cluster.
+func (p *PostgreSQL) GetOwnedLabelKeys(ctx context.Context, tableName string, owner string) ([]string, error) {
+	labelKeys := make([]string, 0)
+
+	rows, err := p.conn.Query(ctx, fmt.Sprintf(`SELECT DISTINCT label_key FROM spec.%s WHERE owner = $1`, tableName),
+		owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from table spec.%s - %w", tableName, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var labelKey string
+
+		if err := rows.Scan(&labelKey); err != nil {
+			return nil, fmt.Errorf("error reading from table spec.%s - %w", tableName, err)
+		}
+
+		labelKeys = append(labelKeys, labelKey)
+	}
+
+	return labelKeys, nil
+}
+
+// UpdateManagedClusterLabelOwner replaces the managed clusters that the given owner assigned with the given label key
+// by the given map of hub -> set of managed clusters, in a single transaction. an empty map removes the owner from the
+// label key.
+func (p *PostgreSQL) UpdateManagedClusterLabelOwner(ctx context.Context, tableName string, owner string,
+	labelKey string, hubToManagedClustersMap map[string]set.Set,
+) error {
+	return p.runInTransaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM spec.%s WHERE label_key = $1 AND owner = $2`, tableName),
+			labelKey, owner); err != nil {
+			return fmt.Errorf("failed to delete from table spec.%s - %w", tableName, err)
+		}
+
+		for hubName, managedClustersSet := range hubToManagedClustersMap {
+			for _, managedClusterName := range managedClustersSet.ToSlice() {
+				clusterName, ok := managedClusterName.(string)
+				if !ok {
+					p.log.Info("bad cast", "cluster", managedClusterName)
+					continue
+				}
+
+				if _, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO spec.%s (owner, leaf_hub_name, 
+managed_cluster_name, label_key) values($1, $2, $3, $4)`, tableName), owner, hubName, clusterName,
+					labelKey); err != nil {
+					return fmt.Errorf("failed to insert into table spec.%s - %w", tableName, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetGitRepoSyncState returns the state of the last successful sync of a git repo by the given syncer. If the repo
+// was not synced by the syncer, a state with an empty commit ID is returned.
+func (p *PostgreSQL) GetGitRepoSyncState(ctx context.Context, tableName string, repoName string,
+	syncerName string,
+) (*db.GitRepoSyncState, error) {
+	syncState := &db.GitRepoSyncState{}
+
+	if err := p.conn.QueryRow(ctx, fmt.Sprintf(`SELECT commit_id, work_path, recursive, include_patterns, 
+exclude_patterns, user_identity, user_group FROM spec.%s WHERE repo_name = $1 AND syncer = $2`, tableName), repoName,
+		syncerName).Scan(&syncState.CommitID, &syncState.WorkPath, &syncState.Recursive, &syncState.IncludePatterns,
+		&syncState.ExcludePatterns, &syncState.Base64UserIdentity, &syncState.Base64UserGroup); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &db.GitRepoSyncState{}, nil // not synced
+		}
+
+		return nil, fmt.Errorf("failed to read from table spec.%s - %w", tableName, err)
+	}
+
+	return syncState, nil
+}
+
+// UpdateGitRepoSyncState inserts or updates the state of the last successful sync of a git repo by the given syncer.
+func (p *PostgreSQL) UpdateGitRepoSyncState(ctx context.Context, tableName string, repoName string,
+	syncerName string, syncState *db.GitRepoSyncState,
+) error {
+	if _, err := p.conn.Exec(ctx, fmt.Sprintf(`INSERT INTO spec.%s (repo_name, syncer, commit_id, work_path, 
+recursive, include_patterns, exclude_patterns, user_identity, user_group, updated_at) values($1, $2, $3, $4, $5, 
+$6::jsonb, $7::jsonb, $8, $9, now()) ON CONFLICT (repo_name, syncer) DO UPDATE SET commit_id = $3, work_path = $4, 
+recursive = $5, include_patterns = $6::jsonb, exclude_patterns = $7::jsonb, user_identity = $8, user_group = $9, 
+updated_at = now()`, tableName), repoName, syncerName, syncState.CommitID, syncState.WorkPath, syncState.Recursive,
+		syncState.IncludePatterns, syncState.ExcludePatterns, syncState.Base64UserIdentity,
+		syncState.Base64UserGroup); err != nil {
+		return fmt.Errorf("failed to upsert into table spec.%s - %w", tableName, err)
+	}
+
+	return nil
+}
+
+// DeleteGitRepoSyncState deletes the sync state of a git repo by the given syncer.
+func (p *PostgreSQL) DeleteGitRepoSyncState(ctx context.Context, tableName string, repoName string,
+	syncerName string,
+) error {
+	if _, err := p.conn.Exec(ctx, fmt.Sprintf(`DELETE FROM spec.%s WHERE repo_name = $1 AND syncer = $2`,
+		tableName), repoName, syncerName); err != nil {
+		return fmt.Errorf("failed to delete from table spec.%s - %w", tableName, err)
+	}
+
+	return nil
+}
+
+// updateManagedClustersWithRetries runs updateFunc on each managed cluster separately under optimistic concurrency
+// control with exponential backoff for retries.
+//
+// If the operation fails, hubToManagedClustersMap will contain un-synced entries only.
+func (p *PostgreSQL) updateManagedClustersWithRetries(ctx context.Context, labelKey string,
+	hubToManagedClustersMap map[string]set.Set, updateFunc func(hubName string, clusterName string) error,
 ) error {
 	intervalPolicy := intervalpolicy.NewExponentialBackoffPolicy(retryInterval)
 	retryAttempts := optimisticConcurrencyRetriesCount
@@ -76,7 +348,7 @@ func (p *PostgreSQL) UpdateLabelForManagedClusters(ctx context.Context, tableNam
 					continue
 				}
 
-				if err := p.updateLabels(ctx, hubName, clusterName, labelKey, labelValue); err != nil {
+				if err := updateFunc(hubName, clusterName); err != nil {
 					p.log.Error(err, "failed to update labels for cluster", "hub", hubName, "cluster", clusterName,
 						"label", labelKey)
 					continue
@@ -94,10 +366,15 @@ func (p *PostgreSQL) UpdateLabelForManagedClusters(ctx context.Context, tableNam
 			break // all synced
 		}
 
+		retryAttempts--
+		if retryAttempts == 0 {
+			break // no attempts left
+		}
+
 		intervalPolicy.Evaluate()
 		time.Sleep(intervalPolicy.GetInterval())
 
-		retryAttempts--
+		p.metrics.DBUpdateRetries.Inc()
 	}
 
 	if len(hubToManagedClustersMap) != 0 { // some failed
@@ -112,6 +389,10 @@ func (p *PostgreSQL) UpdateLabelForManagedClusters(ctx context.Context, tableNam
 func (p *PostgreSQL) GetAccessibleManagedClusters(ctx context.Context, tableName string,
 	filterClause string,
 ) (map[string]set.Set, error) {
+	ctx, span := tracing.StartSpan(ctx, "GetAccessibleManagedClusters", trace.WithAttributes(
+		attribute.String("table", tableName)))
+	defer span.End()
+
 	hubToManagedClustersMap := map[string]set.Set{}
 
 	rows, _ := p.conn.Query(ctx, fmt.Sprintf(`SELECT leaf_hub_name, payload->'metadata'->>'name' FROM status.%s WHERE 
@@ -126,6 +407,7 @@ TRUE AND %s`, tableName, filterClause))
 		)
 
 		if err := rows.Scan(&hubName, &managedClusterName); err != nil {
+			tracing.SetError(span, err)
 			return nil, fmt.Errorf("error reading from table status.%s - %w", tableName, err)
 		}
 
@@ -141,73 +423,172 @@ TRUE AND %s`, tableName, filterClause))
 	return hubToManagedClustersMap, nil
 }
 
-func (p *PostgreSQL) updateLabels(ctx context.Context, hubName string, cluster string, labelKey string,
-	labelValue string,
-) error {
-	rows, err := p.conn.Query(ctx,
-		"SELECT labels, deleted_label_keys, version from spec.managed_clusters_labels WHERE leaf_hub_name = $1 AND "+
-			"managed_cluster_name = $2", hubName, cluster)
+// GetManagedClustersLabels returns a map of hub -> managed cluster -> labels of all managed clusters in the table.
+func (p *PostgreSQL) GetManagedClustersLabels(ctx context.Context,
+	tableName string,
+) (map[string]map[string]map[string]string, error) {
+	ctx, span := tracing.StartSpan(ctx, "GetManagedClustersLabels", trace.WithAttributes(
+		attribute.String("table", tableName)))
+	defer span.End()
+
+	hubToManagedClusterLabelsMap := map[string]map[string]map[string]string{}
+
+	rows, err := p.conn.Query(ctx, fmt.Sprintf(`SELECT leaf_hub_name, payload->'metadata'->>'name', 
+COALESCE(payload->'metadata'->'labels', '{}'::jsonb) FROM status.%s`, tableName))
 	if err != nil {
-		return fmt.Errorf("failed to read from managed_clusters_labels: %w", err)
+		tracing.SetError(span, err)
+		return nil, fmt.Errorf("error reading from table status.%s - %w", tableName, err)
 	}
+
 	defer rows.Close()
 
+	for rows.Next() {
+		var (
+			hubName            string
+			managedClusterName string
+			labels             map[string]string
+		)
+
+		if err := rows.Scan(&hubName, &managedClusterName, &labels); err != nil {
+			tracing.SetError(span, err)
+			return nil, fmt.Errorf("error reading from table status.%s - %w", tableName, err)
+		}
+
+		managedClusterToLabelsMap, found := hubToManagedClusterLabelsMap[hubName]
+		if !found {
+			managedClusterToLabelsMap = map[string]map[string]string{}
+			hubToManagedClusterLabelsMap[hubName] = managedClusterToLabelsMap
+		}
+
+		managedClusterToLabelsMap[managedClusterName] = labels
+	}
+
+	return hubToManagedClusterLabelsMap, nil
+}
+
+// updateLabels assigns the given label to a managed cluster and audits the label changes in a single transaction, so
+// that the audit log never disagrees with the labels table.
+func (p *PostgreSQL) updateLabels(ctx context.Context, hubName string, cluster string, labelKey string,
+	labelValue string, auditInfo *db.LabelsAuditInfo,
+) error {
 	if labelValue == "" {
 		labelValue = db.ManagedClusterSetDefaultTagValue
 	}
 
 	labelsToAdd := map[string]string{labelKey: labelValue}
 
-	if !rows.Next() { // insert the labels
-		_, err := p.conn.Exec(ctx,
-			`INSERT INTO spec.managed_clusters_labels (leaf_hub_name, managed_cluster_name, labels, version, updated_at) 
-				values($1, $2, $3::jsonb, 0, now())`,
-			hubName, cluster, labelsToAdd)
-		if err != nil {
-			return fmt.Errorf("failed to insert into the managed_clusters_labels table: %w", err)
+	ctx, span := tracing.StartSpan(ctx, "updateLabels", trace.WithAttributes(attribute.String("hub", hubName),
+		attribute.String("cluster", cluster), attribute.String("label", labelKey)))
+	defer span.End()
+
+	err := p.runInTransaction(ctx, func(tx pgx.Tx) error {
+		var (
+			currentLabelsToAdd         map[string]string
+			currentLabelsToRemoveSlice []string
+			version                    int64
+		)
+
+		if err := tx.QueryRow(ctx,
+			"SELECT labels, deleted_label_keys, version from spec.managed_clusters_labels WHERE leaf_hub_name = $1 "+
+				"AND managed_cluster_name = $2", hubName, cluster).Scan(&currentLabelsToAdd,
+			&currentLabelsToRemoveSlice, &version); err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("failed to read from managed_clusters_labels: %w", err)
+			}
+			// insert the labels
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO spec.managed_clusters_labels (leaf_hub_name, managed_cluster_name, labels, version, 
+				updated_at) values($1, $2, $3::jsonb, 0, now())`,
+				hubName, cluster, labelsToAdd); err != nil {
+				return fmt.Errorf("failed to insert into the managed_clusters_labels table: %w", err)
+			}
+
+			return p.insertLabelsAudit(ctx, tx, hubName, cluster, labelsToAdd, map[string]string{}, auditInfo)
+		}
+
+		// every label that is not prefixed by hohGroup should be dropped
+		labelsToRemove := map[string]struct{}{}
+
+		for key, value := range currentLabelsToAdd {
+			if db.LabelKeyIsAllowed(key) {
+				if _, found := labelsToAdd[key]; !found {
+					labelsToAdd[key] = value // label should be retained, unless assigned with a new value
+				}
+
+				continue
+			}
+
+			labelsToRemove[key] = struct{}{}
+		}
+
+		if err := p.putRow(ctx, tx, hubName, cluster, labelsToAdd, currentLabelsToAdd, labelsToRemove,
+			p.getMap(currentLabelsToRemoveSlice), version, auditInfo); err != nil {
+			return fmt.Errorf("failed to update managed_clusters_labels table: %w", err)
 		}
 
 		return nil
-	}
+	})
 
-	var (
-		currentLabelsToAdd         map[string]string
-		currentLabelsToRemoveSlice []string
-		version                    int64
-	)
+	tracing.SetError(span, err)
 
-	err = rows.Scan(&currentLabelsToAdd, &currentLabelsToRemoveSlice, &version)
-	if err != nil {
-		return fmt.Errorf("failed to scan a row: %w", err)
-	}
+	return err
+}
 
-	// every label that is not prefixed by hohGroup should be dropped
-	labelsToRemove := map[string]struct{}{}
+// removeLabel removes the given label from a managed cluster and audits the label changes in a single transaction, so
+// that the audit log never disagrees with the labels table.
+func (p *PostgreSQL) removeLabel(ctx context.Context, hubName string, cluster string, labelKey string,
+	auditInfo *db.LabelsAuditInfo,
+) error {
+	ctx, span := tracing.StartSpan(ctx, "removeLabel", trace.WithAttributes(attribute.String("hub", hubName),
+		attribute.String("cluster", cluster), attribute.String("label", labelKey)))
+	defer span.End()
 
-	for key, value := range currentLabelsToAdd {
-		if labelKeyIsAllowed(key) {
-			labelsToAdd[key] = value // label should be retained
-			continue
+	err := p.runInTransaction(ctx, func(tx pgx.Tx) error {
+		var (
+			currentLabelsToAdd         map[string]string
+			currentLabelsToRemoveSlice []string
+			version                    int64
+		)
+
+		if err := tx.QueryRow(ctx,
+			"SELECT labels, deleted_label_keys, version from spec.managed_clusters_labels WHERE leaf_hub_name = $1 "+
+				"AND managed_cluster_name = $2", hubName, cluster).Scan(&currentLabelsToAdd,
+			&currentLabelsToRemoveSlice, &version); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil // no labels are assigned to managed cluster, nothing to remove
+			}
+
+			return fmt.Errorf("failed to read from managed_clusters_labels: %w", err)
 		}
 
-		labelsToRemove[key] = struct{}{}
-	}
+		if _, found := currentLabelsToAdd[labelKey]; !found {
+			return nil // label is not assigned, nothing to remove
+		}
 
-	err = p.putRow(ctx, cluster, labelsToAdd, currentLabelsToAdd, labelsToRemove, p.getMap(currentLabelsToRemoveSlice),
-		version)
-	if err != nil {
-		return fmt.Errorf("failed to update managed_clusters_labels table: %w", err)
-	}
+		labelsToRemove := map[string]struct{}{labelKey: {}}
 
-	return nil
+		if err := p.putRow(ctx, tx, hubName, cluster, map[string]string{}, currentLabelsToAdd, labelsToRemove,
+			p.getMap(currentLabelsToRemoveSlice), version, auditInfo); err != nil {
+			return fmt.Errorf("failed to update managed_clusters_labels table: %w", err)
+		}
+
+		return nil
+	})
+
+	tracing.SetError(span, err)
+
+	return err
 }
 
-func (p *PostgreSQL) putRow(ctx context.Context, cluster string, labelsToAdd map[string]string,
-	currentLabelsToAdd map[string]string, labelsToRemove map[string]struct{}, currentLabelsToRemove map[string]struct{},
-	version int64,
+func (p *PostgreSQL) putRow(ctx context.Context, tx pgx.Tx, hubName string, cluster string,
+	labelsToAdd map[string]string, currentLabelsToAdd map[string]string, labelsToRemove map[string]struct{},
+	currentLabelsToRemove map[string]struct{}, version int64, auditInfo *db.LabelsAuditInfo,
 ) error {
 	newLabelsToAdd := make(map[string]string)
 	newLabelsToRemove := make(map[string]struct{})
+	// audit only labels that are actually changed by this row update
+	addedLabels := make(map[string]string)
+	removedLabels := make(map[string]string)
 
 	for key := range currentLabelsToRemove {
 		if _, keyToBeAdded := labelsToAdd[key]; !keyToBeAdded {
@@ -217,6 +598,10 @@ func (p *PostgreSQL) putRow(ctx context.Context, cluster string, labelsToAdd map
 
 	for key := range labelsToRemove {
 		newLabelsToRemove[key] = struct{}{}
+
+		if value, assigned := currentLabelsToAdd[key]; assigned {
+			removedLabels[key] = value
+		}
 	}
 
 	for key, value := range currentLabelsToAdd {
@@ -227,16 +612,20 @@ func (p *PostgreSQL) putRow(ctx context.Context, cluster string, labelsToAdd map
 
 	for key, value := range labelsToAdd {
 		newLabelsToAdd[key] = value
+
+		if currentValue, assigned := currentLabelsToAdd[key]; !assigned || currentValue != value {
+			addedLabels[key] = value
+		}
 	}
 
-	commandTag, err := p.conn.Exec(ctx,
+	commandTag, err := tx.Exec(ctx,
 		`UPDATE spec.managed_clusters_labels SET
 		labels = $1::jsonb,
 		deleted_label_keys = $2::jsonb,
 		version = version + 1,
 		updated_at = now()
-		WHERE managed_cluster_name=$3 AND version=$4`,
-		newLabelsToAdd, p.getKeys(newLabelsToRemove), cluster, version)
+		WHERE leaf_hub_name=$3 AND managed_cluster_name=$4 AND version=$5`,
+		newLabelsToAdd, p.getKeys(newLabelsToRemove), hubName, cluster, version)
 	if err != nil {
 		return fmt.Errorf("failed to insert a row: %w", err)
 	}
@@ -245,6 +634,50 @@ func (p *PostgreSQL) putRow(ctx context.Context, cluster string, labelsToAdd map
 		return errOptimisticConcurrencyUpdateFailed
 	}
 
+	return p.insertLabelsAudit(ctx, tx, hubName, cluster, addedLabels, removedLabels, auditInfo)
+}
+
+// insertLabelsAudit inserts a row into the labels audit table for each added / removed label of a managed cluster.
+func (p *PostgreSQL) insertLabelsAudit(ctx context.Context, tx pgx.Tx, hubName string, cluster string,
+	addedLabels map[string]string, removedLabels map[string]string, auditInfo *db.LabelsAuditInfo,
+) error {
+	for operation, labels := range map[string]map[string]string{
+		labelsAuditOperationAdd:    addedLabels,
+		labelsAuditOperationRemove: removedLabels,
+	} {
+		for key, value := range labels {
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO spec.%s (user_identity, user_group, repo_path, 
+commit_id, file_path, leaf_hub_name, managed_cluster_name, label_key, label_value, operation, created_at) values($1, 
+$2, $3, $4, $5, $6, $7, $8, $9, $10, now())`, labelsAuditTableName), auditInfo.UserIdentity, auditInfo.UserGroup,
+				auditInfo.RepoPath, auditInfo.CommitID, auditInfo.FilePath, hubName, cluster, key, value,
+				operation); err != nil {
+				return fmt.Errorf("failed to insert into table spec.%s - %w", labelsAuditTableName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// runInTransaction runs txFunc in a transaction that is committed if txFunc succeeds, and rolled back otherwise.
+func (p *PostgreSQL) runInTransaction(ctx context.Context, txFunc func(tx pgx.Tx) error) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction - %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if the transaction was committed
+	}()
+
+	if err := txFunc(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction - %w", err)
+	}
+
 	return nil
 }
 
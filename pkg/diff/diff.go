@@ -0,0 +1,511 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	set "github.com/deckarep/golang-set"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
+)
+
+const (
+	// LabelOperationAdd is the operation of a label that is assigned to a managed cluster that does not have its key.
+	LabelOperationAdd = "add"
+	// LabelOperationUpdate is the operation of a label whose value is changed.
+	LabelOperationUpdate = "update"
+	// LabelOperationRemove is the operation of a label that is removed from a managed cluster.
+	LabelOperationRemove = "remove"
+	// managedClusterLabelsDBTableName is the table that holds the labels of managed clusters.
+	managedClusterLabelsDBTableName = "managed_clusters_labels"
+	// managedClustersStatusDBTableName is the status table of managed clusters.
+	managedClustersStatusDBTableName = "managed_clusters"
+)
+
+var (
+	errKindNotSupported             = errors.New("kind is not supported")
+	errManagedClustersGroupNotFound = errors.New("managed clusters group not found")
+)
+
+// Diff holds the label changes that syncing the objects of a local directory would apply, by hub.
+type Diff struct {
+	Hubs []*HubDiff `json:"hubs"`
+}
+
+// HubDiff holds the label changes of the managed clusters of a hub.
+type HubDiff struct {
+	Name            string                `json:"name"`
+	ManagedClusters []*ManagedClusterDiff `json:"managedClusters"`
+}
+
+// ManagedClusterDiff holds the label changes of a managed cluster.
+type ManagedClusterDiff struct {
+	Name         string         `json:"name"`
+	LabelChanges []*LabelChange `json:"labelChanges"`
+}
+
+// LabelChange holds the change of a single label of a managed cluster.
+type LabelChange struct {
+	// Key of the label.
+	Key string `json:"key"`
+	// Operation is one of LabelOperationAdd, LabelOperationUpdate or LabelOperationRemove.
+	Operation string `json:"operation"`
+	// Value is the value that the label is assigned with. empty if the label is removed.
+	Value string `json:"value,omitempty"`
+	// CurrentValue is the value of the label in the DB. empty if the label is added.
+	CurrentValue string `json:"currentValue,omitempty"`
+	// Object identifies the object (kind/name) that assigns or owns the label. empty if the label is removed since
+	// its key is not allowed to be assigned by hub-of-hubs gitops.
+	Object string `json:"object,omitempty"`
+}
+
+// labelAssignment is the assignment of a label by an object, as the syncer applies it.
+type labelAssignment struct {
+	object      string
+	key         string
+	value       string
+	identifiers []map[string]yamltypes.HubIdentifier
+	// managedClustersGroup is set if the label is assigned by a group, whose composition of other groups is resolved
+	// along with its identifiers.
+	managedClustersGroup *yamltypes.ManagedClustersGroup
+	// hubToManagedClustersMap holds the managed clusters that are identified by the identifiers, once resolved.
+	hubToManagedClustersMap map[string][]string
+	// ownsKey is set if the object owns the label's key, i.e. managed clusters that are assigned with the key (with
+	// any value) but are not identified by the object have the label removed. otherwise, only managed clusters that
+	// are assigned with the key and the object's value have the label removed.
+	ownsKey bool
+}
+
+// getLabelAssignmentsFunc returns the label assignments of the object in a document of a specific kind.
+type getLabelAssignmentsFunc func(document []byte) ([]*labelAssignment, error)
+
+// GetDiff returns the label changes that syncing the objects of a local directory (e.g. a git repo checkout) would
+// apply to the managed clusters in the DB, without applying them. workPath selects the files of the directory, as
+// the subscription's file-selection annotations select the files to sync. dynamic identifiers are resolved against
+// the managed clusters in the status DB. the DBs are only read.
+func GetDiff(ctx context.Context, specDB db.ManagedClusterLabelsSpecDB, statusDB db.StatusDB, dirPath string,
+	workPath *dbsyncer.WorkPath,
+) (*Diff, error) {
+	labelAssignments, err := getLabelAssignments(dirPath, workPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get label assignments - %w", err)
+	}
+
+	if err := resolveLabelAssignments(ctx, statusDB, labelAssignments); err != nil {
+		return nil, fmt.Errorf("failed to resolve label assignments - %w", err)
+	}
+
+	hubToManagedClusterLabelsStatesMap, err := specDB.GetManagedClustersLabelsStates(ctx,
+		managedClusterLabelsDBTableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed clusters labels - %w", err)
+	}
+
+	return getDiff(labelAssignments, hubToManagedClusterLabelsStatesMap), nil
+}
+
+// getLabelAssignments returns the label assignments of the objects in the files of a local directory. fails if any
+// object can not be parsed or is not supported.
+func getLabelAssignments(dirPath string, workPath *dbsyncer.WorkPath) ([]*labelAssignment, error) {
+	if err := workPath.ValidatePatterns(); err != nil {
+		return nil, fmt.Errorf("invalid work path - %w", err)
+	}
+
+	kindToGetLabelAssignmentsFuncMap := map[string]getLabelAssignmentsFunc{
+		yamltypes.ManagedClustersGroupKind: getManagedClustersGroupLabelAssignments,
+		yamltypes.ManagedClusterSetKind:    getManagedClusterSetLabelAssignments,
+		yamltypes.ManagedClusterLabelsKind: getManagedClusterLabelsLabelAssignments,
+	}
+
+	labelAssignments := make([]*labelAssignment, 0)
+
+	if err := workPath.WalkDir(dirPath, func(filePath string, contents []byte) error {
+		for documentIndex, document := range yamltypes.SplitDocuments(contents) {
+			objectHeader, err := yamltypes.NewObjectHeaderFromBytes(document)
+			if err != nil {
+				return fmt.Errorf("failed to get object header in %s (document %d) - %w", filePath, documentIndex,
+					err)
+			}
+
+			labelAssignmentsFunc, found := kindToGetLabelAssignmentsFuncMap[objectHeader.Kind]
+			if !found {
+				return fmt.Errorf("failed to get label assignment in %s (document %d) - %w: %s", filePath,
+					documentIndex, errKindNotSupported, objectHeader.Kind)
+			}
+
+			assignments, err := labelAssignmentsFunc(document)
+			if err != nil {
+				return fmt.Errorf("failed to get label assignment in %s (document %d) - %w", filePath,
+					documentIndex, err)
+			}
+
+			labelAssignments = append(labelAssignments, assignments...)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to load directory - %w", err)
+	}
+
+	return labelAssignments, nil
+}
+
+// getManagedClustersGroupLabelAssignments returns the label assignment of a ManagedClustersGroup. the group owns its
+// label key.
+func getManagedClustersGroupLabelAssignments(document []byte) ([]*labelAssignment, error) {
+	managedClustersGroup, err := yamltypes.NewManagedClustersGroupFromBytes(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create managed clusters group - %w", err)
+	}
+
+	labelValue := managedClustersGroup.Spec.TagValue
+	if labelValue == "" {
+		labelValue = db.ManagedClusterSetDefaultTagValue
+	}
+
+	return []*labelAssignment{{
+		object:               fmt.Sprintf("%s/%s", managedClustersGroup.Kind, managedClustersGroup.Metadata.Name),
+		key:                  managedClustersGroup.GetLabelKey(),
+		value:                labelValue,
+		identifiers:          managedClustersGroup.Spec.Identifiers,
+		managedClustersGroup: managedClustersGroup,
+		ownsKey:              true,
+	}}, nil
+}
+
+// getManagedClusterSetLabelAssignments returns the label assignment of a ManagedClusterSet. the set label key is
+// shared by all sets, so the set only owns the label with its name as the value.
+func getManagedClusterSetLabelAssignments(document []byte) ([]*labelAssignment, error) {
+	managedClusterSet, err := yamltypes.NewManagedClusterSetFromBytes(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create managed cluster set - %w", err)
+	}
+
+	return []*labelAssignment{{
+		object:      fmt.Sprintf("%s/%s", managedClusterSet.Kind, managedClusterSet.Metadata.Name),
+		key:         db.ManagedClusterSetLabelKey,
+		value:       managedClusterSet.Metadata.Name,
+		identifiers: managedClusterSet.Spec.Identifiers,
+	}}, nil
+}
+
+// getManagedClusterLabelsLabelAssignments returns the label assignments of a ManagedClusterLabels, one per label. the
+// object only owns each label with its value. the syncer only removes a label from the managed clusters that the object
+// assigned it to, so the removals are an upper bound of the syncer's removals.
+func getManagedClusterLabelsLabelAssignments(document []byte) ([]*labelAssignment, error) {
+	managedClusterLabels, err := yamltypes.NewManagedClusterLabelsFromBytes(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create managed cluster labels - %w", err)
+	}
+
+	labels := managedClusterLabels.GetLabels()
+	labelAssignments := make([]*labelAssignment, 0, len(labels))
+
+	for _, labelKey := range managedClusterLabels.GetLabelKeys() {
+		labelAssignments = append(labelAssignments, &labelAssignment{
+			object:      fmt.Sprintf("%s/%s", managedClusterLabels.Kind, managedClusterLabels.Metadata.Name),
+			key:         labelKey,
+			value:       labels[labelKey],
+			identifiers: managedClusterLabels.Spec.Identifiers,
+		})
+	}
+
+	return labelAssignments, nil
+}
+
+// resolveLabelAssignments resolves the identifiers of the given label assignments into the managed clusters that
+// they identify. compositions of groups are resolved with the groups of the given label assignments. the status DB is
+// only read if any of the identifiers is dynamic.
+func resolveLabelAssignments(ctx context.Context, statusDB db.StatusDB, labelAssignments []*labelAssignment) error {
+	var hubToManagedClusterLabelsMap map[string]map[string]map[string]string
+
+	getHubToManagedClustersMap := func(identifiers []map[string]yamltypes.HubIdentifier) (map[string][]string,
+		error,
+	) {
+		if hubToManagedClusterLabelsMap == nil && yamltypes.IdentifiersAreDynamic(identifiers) {
+			statusHubToManagedClusterLabelsMap, err := statusDB.GetManagedClustersLabels(ctx,
+				managedClustersStatusDBTableName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get managed clusters from status DB - %w", err)
+			}
+
+			hubToManagedClusterLabelsMap = statusHubToManagedClusterLabelsMap
+		}
+
+		hubToManagedClustersMap, err := yamltypes.GetHubToManagedClustersMap(identifiers,
+			hubToManagedClusterLabelsMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve identifiers - %w", err)
+		}
+
+		return hubToManagedClustersMap, nil
+	}
+
+	groupResolver := newManagedClustersGroupResolver(labelAssignments, getHubToManagedClustersMap)
+
+	for _, assignment := range labelAssignments {
+		if assignment.managedClustersGroup != nil {
+			hubToManagedClustersMap, err := groupResolver.Resolve(assignment.managedClustersGroup)
+			if err != nil {
+				return fmt.Errorf("failed to resolve %s - %w", assignment.object, err)
+			}
+
+			assignment.hubToManagedClustersMap = getHubToManagedClustersSlicesMap(hubToManagedClustersMap)
+
+			continue
+		}
+
+		hubToManagedClustersMap, err := getHubToManagedClustersMap(assignment.identifiers)
+		if err != nil {
+			return fmt.Errorf("failed to resolve identifiers of %s - %w", assignment.object, err)
+		}
+
+		assignment.hubToManagedClustersMap = hubToManagedClustersMap
+	}
+
+	return nil
+}
+
+// newManagedClustersGroupResolver returns a resolver of the groups of the given label assignments, that resolves
+// identifiers using the given function.
+func newManagedClustersGroupResolver(labelAssignments []*labelAssignment,
+	getHubToManagedClustersMap func(identifiers []map[string]yamltypes.HubIdentifier) (map[string][]string, error),
+) *dbsyncer.ManagedClustersGroupResolver {
+	nameToManagedClustersGroupMap := make(map[string]*yamltypes.ManagedClustersGroup)
+
+	for _, assignment := range labelAssignments {
+		if assignment.managedClustersGroup == nil {
+			continue
+		}
+
+		if _, found := nameToManagedClustersGroupMap[assignment.managedClustersGroup.Metadata.Name]; !found {
+			nameToManagedClustersGroupMap[assignment.managedClustersGroup.Metadata.Name] =
+				assignment.managedClustersGroup
+		}
+	}
+
+	return dbsyncer.NewManagedClustersGroupResolver(func(name string) (*yamltypes.ManagedClustersGroup, error) {
+		managedClustersGroup, found := nameToManagedClustersGroupMap[name]
+		if !found {
+			return nil, fmt.Errorf("%w: %s", errManagedClustersGroupNotFound, name)
+		}
+
+		return managedClustersGroup, nil
+	}, func(identifiers []map[string]yamltypes.HubIdentifier) (map[string]set.Set, error) {
+		hubToManagedClustersMap, err := getHubToManagedClustersMap(identifiers)
+		if err != nil {
+			return nil, err
+		}
+
+		hubToManagedClustersSetsMap := make(map[string]set.Set, len(hubToManagedClustersMap))
+
+		for hubName, managedClusters := range hubToManagedClustersMap {
+			managedClustersSet := set.NewSet()
+
+			for _, managedCluster := range managedClusters {
+				managedClustersSet.Add(managedCluster)
+			}
+
+			hubToManagedClustersSetsMap[hubName] = managedClustersSet
+		}
+
+		return hubToManagedClustersSetsMap, nil
+	})
+}
+
+// getHubToManagedClustersSlicesMap converts a map of hub -> set of managed clusters to a map of hub -> sorted slice
+// of managed clusters.
+func getHubToManagedClustersSlicesMap(hubToManagedClustersMap map[string]set.Set) map[string][]string {
+	hubToManagedClustersSlicesMap := make(map[string][]string, len(hubToManagedClustersMap))
+
+	for hubName, managedClustersSet := range hubToManagedClustersMap {
+		managedClusters := make([]string, 0, managedClustersSet.Cardinality())
+
+		for _, managedCluster := range managedClustersSet.ToSlice() {
+			if managedClusterName, ok := managedCluster.(string); ok {
+				managedClusters = append(managedClusters, managedClusterName)
+			}
+		}
+
+		sort.Strings(managedClusters)
+		hubToManagedClustersSlicesMap[hubName] = managedClusters
+	}
+
+	return hubToManagedClustersSlicesMap
+}
+
+// getDiff returns the label changes that applying the given label assignments to the given managed cluster labels
+// states would result in:
+// - labels are added to / updated on the managed clusters that are identified by the assigning objects.
+// - labels that are owned by an object are removed from the managed clusters that it does not identify.
+// - labels with keys that are not allowed are dropped from managed clusters whose labels are added / updated.
+func getDiff(labelAssignments []*labelAssignment,
+	hubToManagedClusterLabelsStatesMap map[string]map[string]*db.ManagedClusterLabelsState,
+) *Diff {
+	changes := newLabelChanges()
+
+	getCurrentLabels := func(hubName string, managedClusterName string) map[string]string {
+		if labelsState, found := hubToManagedClusterLabelsStatesMap[hubName][managedClusterName]; found {
+			return labelsState.LabelsMap
+		}
+
+		return nil
+	}
+
+	for _, assignment := range labelAssignments {
+		for hubName, managedClusters := range assignment.hubToManagedClustersMap {
+			for _, managedClusterName := range managedClusters {
+				changes.markAssigned(hubName, managedClusterName, assignment.key)
+
+				currentValue, found := getCurrentLabels(hubName, managedClusterName)[assignment.key]
+				if found && currentValue == assignment.value {
+					continue // not changed
+				}
+
+				operation := LabelOperationAdd
+				if found {
+					operation = LabelOperationUpdate
+				}
+
+				changes.add(hubName, managedClusterName, &LabelChange{
+					Key:          assignment.key,
+					Operation:    operation,
+					Value:        assignment.value,
+					CurrentValue: currentValue,
+					Object:       assignment.object,
+				})
+			}
+		}
+	}
+
+	for hubName, managedClusterToLabelsStateMap := range hubToManagedClusterLabelsStatesMap {
+		for managedClusterName, labelsState := range managedClusterToLabelsStateMap {
+			for _, assignment := range labelAssignments {
+				currentValue, found := labelsState.LabelsMap[assignment.key]
+				if !found || (!assignment.ownsKey && currentValue != assignment.value) ||
+					changes.isAssigned(hubName, managedClusterName, assignment.key) {
+					continue // not owned by the object, or assigned by an object
+				}
+
+				changes.add(hubName, managedClusterName, &LabelChange{
+					Key:          assignment.key,
+					Operation:    LabelOperationRemove,
+					CurrentValue: currentValue,
+					Object:       assignment.object,
+				})
+			}
+
+			if !changes.hasAssignedChanges(hubName, managedClusterName) {
+				continue // labels of the managed cluster are not updated
+			}
+
+			for key, currentValue := range labelsState.LabelsMap {
+				if !db.LabelKeyIsAllowed(key) {
+					changes.add(hubName, managedClusterName, &LabelChange{
+						Key:          key,
+						Operation:    LabelOperationRemove,
+						CurrentValue: currentValue,
+					})
+				}
+			}
+		}
+	}
+
+	return changes.toDiff()
+}
+
+// labelChanges collects label changes by hub -> managed cluster -> label key.
+type labelChanges struct {
+	hubToManagedClusterChangesMap map[string]map[string]map[string]*LabelChange
+	// assignedLabelKeys holds the keys (hub/managed cluster/key) of the labels that are assigned by any object.
+	assignedLabelKeys map[string]struct{}
+}
+
+func newLabelChanges() *labelChanges {
+	return &labelChanges{
+		hubToManagedClusterChangesMap: make(map[string]map[string]map[string]*LabelChange),
+		assignedLabelKeys:             make(map[string]struct{}),
+	}
+}
+
+func (changes *labelChanges) markAssigned(hubName string, managedClusterName string, key string) {
+	changes.assignedLabelKeys[fmt.Sprintf("%s/%s/%s", hubName, managedClusterName, key)] = struct{}{}
+}
+
+func (changes *labelChanges) isAssigned(hubName string, managedClusterName string, key string) bool {
+	_, found := changes.assignedLabelKeys[fmt.Sprintf("%s/%s/%s", hubName, managedClusterName, key)]
+	return found
+}
+
+// add adds a change of a managed cluster's label. a later change of the same label replaces the former one, as the
+// later sync of the same label overrides the former one.
+func (changes *labelChanges) add(hubName string, managedClusterName string, change *LabelChange) {
+	managedClusterToChangesMap, found := changes.hubToManagedClusterChangesMap[hubName]
+	if !found {
+		managedClusterToChangesMap = make(map[string]map[string]*LabelChange)
+		changes.hubToManagedClusterChangesMap[hubName] = managedClusterToChangesMap
+	}
+
+	keyToChangeMap, found := managedClusterToChangesMap[managedClusterName]
+	if !found {
+		keyToChangeMap = make(map[string]*LabelChange)
+		managedClusterToChangesMap[managedClusterName] = keyToChangeMap
+	}
+
+	keyToChangeMap[change.Key] = change
+}
+
+// hasAssignedChanges returns whether a label is added to / updated on the managed cluster.
+func (changes *labelChanges) hasAssignedChanges(hubName string, managedClusterName string) bool {
+	for _, change := range changes.hubToManagedClusterChangesMap[hubName][managedClusterName] {
+		if change.Operation != LabelOperationRemove {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toDiff returns the collected changes as a diff, sorted by hub, managed cluster and label key.
+func (changes *labelChanges) toDiff() *Diff {
+	diff := &Diff{Hubs: make([]*HubDiff, 0, len(changes.hubToManagedClusterChangesMap))}
+
+	for hubName, managedClusterToChangesMap := range changes.hubToManagedClusterChangesMap {
+		hubDiff := &HubDiff{
+			Name:            hubName,
+			ManagedClusters: make([]*ManagedClusterDiff, 0, len(managedClusterToChangesMap)),
+		}
+
+		for managedClusterName, keyToChangeMap := range managedClusterToChangesMap {
+			managedClusterDiff := &ManagedClusterDiff{
+				Name:         managedClusterName,
+				LabelChanges: make([]*LabelChange, 0, len(keyToChangeMap)),
+			}
+
+			for _, change := range keyToChangeMap {
+				managedClusterDiff.LabelChanges = append(managedClusterDiff.LabelChanges, change)
+			}
+
+			sort.Slice(managedClusterDiff.LabelChanges, func(i, j int) bool {
+				return managedClusterDiff.LabelChanges[i].Key < managedClusterDiff.LabelChanges[j].Key
+			})
+
+			hubDiff.ManagedClusters = append(hubDiff.ManagedClusters, managedClusterDiff)
+		}
+
+		sort.Slice(hubDiff.ManagedClusters, func(i, j int) bool {
+			return hubDiff.ManagedClusters[i].Name < hubDiff.ManagedClusters[j].Name
+		})
+
+		diff.Hubs = append(diff.Hubs, hubDiff)
+	}
+
+	sort.Slice(diff.Hubs, func(i, j int) bool {
+		return diff.Hubs[i].Name < diff.Hubs[j].Name
+	})
+
+	return diff
+}
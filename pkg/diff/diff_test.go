@@ -0,0 +1,271 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	set "github.com/deckarep/golang-set"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+)
+
+const (
+	testAWSLabelKey  = "hub-of-hubs.open-cluster-management.io/aws"
+	testTierLabelKey = "hub-of-hubs.open-cluster-management.io/tier"
+	testAWSGroup     = `kind: ManagedClustersGroup
+metadata:
+  name: aws
+spec:
+  identifiers:
+  - hubIdentifier:
+      name: hub1
+      managedClusterIdentifiers: [cluster1]
+`
+	testGoldLabels = `kind: ManagedClusterLabels
+metadata:
+  name: gold
+spec:
+  labels:
+    hub-of-hubs.open-cluster-management.io/tier: gold
+  identifiers:
+  - hubIdentifier:
+      name: hub1
+      managedClusterIdentifiers: [cluster1]
+`
+)
+
+// fakeSpecDB is an in-memory db.ManagedClusterLabelsSpecDB that is only read.
+type fakeSpecDB struct {
+	// labels maps hub -> managed cluster -> labels.
+	labels map[string]map[string]map[string]string
+}
+
+func (specDB *fakeSpecDB) UpdateLabelForManagedClusters(_ context.Context, _ string, _ string, _ string,
+	_ map[string]set.Set, _ *db.LabelsAuditInfo,
+) error {
+	return nil
+}
+
+func (specDB *fakeSpecDB) RemoveLabelForManagedClusters(_ context.Context, _ string, _ string,
+	_ map[string]set.Set, _ *db.LabelsAuditInfo,
+) error {
+	return nil
+}
+
+func (specDB *fakeSpecDB) GetManagedClustersByLabel(_ context.Context, _ string, _ string,
+	_ string,
+) (map[string]set.Set, error) {
+	return map[string]set.Set{}, nil
+}
+
+func (specDB *fakeSpecDB) GetManagedClustersLabelsStates(_ context.Context,
+	_ string,
+) (map[string]map[string]*db.ManagedClusterLabelsState, error) {
+	hubToManagedClusterLabelsStatesMap := make(map[string]map[string]*db.ManagedClusterLabelsState)
+
+	for hubName, managedClusterToLabelsMap := range specDB.labels {
+		hubToManagedClusterLabelsStatesMap[hubName] = make(map[string]*db.ManagedClusterLabelsState)
+
+		for managedClusterName, labels := range managedClusterToLabelsMap {
+			hubToManagedClusterLabelsStatesMap[hubName][managedClusterName] = &db.ManagedClusterLabelsState{
+				LabelsMap: labels,
+			}
+		}
+	}
+
+	return hubToManagedClusterLabelsStatesMap, nil
+}
+
+func (specDB *fakeSpecDB) Stop() {}
+
+// fakeStatusDB is an in-memory db.StatusDB.
+type fakeStatusDB struct {
+	// labels maps hub -> managed cluster -> labels.
+	labels map[string]map[string]map[string]string
+}
+
+func (statusDB *fakeStatusDB) GetAccessibleManagedClusters(_ context.Context, _ string,
+	_ string,
+) (map[string]set.Set, error) {
+	return map[string]set.Set{}, nil
+}
+
+func (statusDB *fakeStatusDB) GetManagedClustersLabels(_ context.Context,
+	_ string,
+) (map[string]map[string]map[string]string, error) {
+	return statusDB.labels, nil
+}
+
+func (statusDB *fakeStatusDB) Stop() {}
+
+// formatDiff returns the label changes of a diff as "hub/managed cluster operation key current -> value (object)".
+func formatDiff(diff *Diff) []string {
+	changes := make([]string, 0)
+
+	for _, hubDiff := range diff.Hubs {
+		for _, managedClusterDiff := range hubDiff.ManagedClusters {
+			for _, change := range managedClusterDiff.LabelChanges {
+				changes = append(changes, fmt.Sprintf("%s/%s %s %s %s -> %s (%s)", hubDiff.Name,
+					managedClusterDiff.Name, change.Operation, change.Key, change.CurrentValue, change.Value,
+					change.Object))
+			}
+		}
+	}
+
+	return changes
+}
+
+func TestGetDiff(t *testing.T) {
+	t.Parallel()
+
+	statusLabels := map[string]map[string]map[string]string{
+		"hub1": {
+			"cluster1": {"cloud": "aws"},
+			"cluster2": {"cloud": "gcp"},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		files           map[string]string
+		labels          map[string]map[string]map[string]string
+		expectedChanges []string
+		expectedErr     error
+	}{
+		{
+			name:   "no changes",
+			files:  map[string]string{"groups.yaml": testAWSGroup},
+			labels: map[string]map[string]map[string]string{"hub1": {"cluster1": {testAWSLabelKey: "true"}}},
+		},
+		{
+			name:  "labels added",
+			files: map[string]string{"objects.yaml": testAWSGroup + "---\n" + testGoldLabels},
+			expectedChanges: []string{
+				"hub1/cluster1 add " + testAWSLabelKey + "  -> true (ManagedClustersGroup/aws)",
+				"hub1/cluster1 add " + testTierLabelKey + "  -> gold (ManagedClusterLabels/gold)",
+			},
+		},
+		{
+			name:   "label updated",
+			files:  map[string]string{"labels.yaml": testGoldLabels},
+			labels: map[string]map[string]map[string]string{"hub1": {"cluster1": {testTierLabelKey: "silver"}}},
+			expectedChanges: []string{
+				"hub1/cluster1 update " + testTierLabelKey + " silver -> gold (ManagedClusterLabels/gold)",
+			},
+		},
+		{
+			name:  "group label removed from managed clusters that the group does not identify",
+			files: map[string]string{"groups.yaml": testAWSGroup},
+			labels: map[string]map[string]map[string]string{"hub1": {
+				"cluster1": {testAWSLabelKey: "true"},
+				"cluster2": {testAWSLabelKey: "false"},
+			}},
+			expectedChanges: []string{
+				"hub1/cluster2 remove " + testAWSLabelKey + " false ->  (ManagedClustersGroup/aws)",
+			},
+		},
+		{
+			name:  "labels with other values are not removed",
+			files: map[string]string{"labels.yaml": testGoldLabels},
+			labels: map[string]map[string]map[string]string{"hub1": {
+				"cluster1": {testTierLabelKey: "gold"},
+				"cluster2": {testTierLabelKey: "silver"},
+				"cluster3": {testTierLabelKey: "gold"},
+			}},
+			expectedChanges: []string{
+				"hub1/cluster3 remove " + testTierLabelKey + " gold ->  (ManagedClusterLabels/gold)",
+			},
+		},
+		{
+			name:   "disallowed labels dropped from managed clusters whose labels are added",
+			files:  map[string]string{"groups.yaml": testAWSGroup},
+			labels: map[string]map[string]map[string]string{"hub1": {"cluster1": {"tier": "gold"}}},
+			expectedChanges: []string{
+				"hub1/cluster1 add " + testAWSLabelKey + "  -> true (ManagedClustersGroup/aws)",
+				"hub1/cluster1 remove tier gold ->  ()",
+			},
+		},
+		{
+			name: "dynamic identifiers resolved against status",
+			files: map[string]string{"groups.yaml": `kind: ManagedClustersGroup
+metadata:
+  name: aws
+spec:
+  identifiers:
+  - hubIdentifier:
+      namePattern: hub*
+      managedClusterSelector:
+        matchLabels:
+          cloud: aws
+`},
+			expectedChanges: []string{
+				"hub1/cluster1 add " + testAWSLabelKey + "  -> true (ManagedClustersGroup/aws)",
+			},
+		},
+		{
+			name: "composed group resolved",
+			files: map[string]string{"groups.yaml": testAWSGroup + `---
+kind: ManagedClustersGroup
+metadata:
+  name: all
+spec:
+  composition:
+    operator: union
+    groups: [aws]
+`},
+			expectedChanges: []string{
+				"hub1/cluster1 add hub-of-hubs.open-cluster-management.io/all  -> true (ManagedClustersGroup/all)",
+				"hub1/cluster1 add " + testAWSLabelKey + "  -> true (ManagedClustersGroup/aws)",
+			},
+		},
+		{
+			name:        "unsupported kind",
+			files:       map[string]string{"groups.yaml": "kind: Group\nmetadata:\n  name: aws\n"},
+			expectedErr: errKindNotSupported,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dirPath := t.TempDir()
+
+			for filePath, contents := range test.files {
+				if err := ioutil.WriteFile(filepath.Join(dirPath, filePath), []byte(contents), 0o600); err != nil {
+					t.Fatalf("failed to write file %s - %v", filePath, err)
+				}
+			}
+
+			diff, err := GetDiff(context.Background(), &fakeSpecDB{labels: test.labels},
+				&fakeStatusDB{labels: statusLabels}, dirPath, &dbsyncer.WorkPath{})
+			if test.expectedErr != nil {
+				if !errors.Is(err, test.expectedErr) {
+					t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to get diff - %v", err)
+			}
+
+			expectedChanges := test.expectedChanges
+			if expectedChanges == nil {
+				expectedChanges = []string{}
+			}
+
+			if actual := formatDiff(diff); !reflect.DeepEqual(actual, expectedChanges) {
+				t.Fatalf("expected changes %v, got %v", expectedChanges, actual)
+			}
+		})
+	}
+}
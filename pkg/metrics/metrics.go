@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace         = "hub_of_hubs_gitops"
+	kindLabel         = "kind"
+	subscriptionLabel = "subscription"
+)
+
+// NewMetrics creates a new instance of Metrics and registers its collectors in the given registerer.
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	metrics := &Metrics{
+		ReposScanned: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repos_scanned_total",
+			Help:      "Number of local git repos that were scanned by the git storage walker.",
+		}),
+		SyncDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sync_duration_seconds",
+			Help: "Duration of each attempt to sync (or un-deploy) a single object, by the kind of the object. " +
+				"a failing object is observed again on every retry.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{kindLabel}),
+		FilesSynced: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_synced_total",
+			Help:      "Number of files whose objects were all synced successfully.",
+		}),
+		FilesFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_failed_total",
+			Help:      "Number of files that failed to be read or had at least one object that failed to sync.",
+		}),
+		ManagedClustersLabeled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "managed_clusters_labeled_total",
+			Help:      "Number of managed cluster label assignments, by the kind of the assigning object.",
+		}, []string{kindLabel}),
+		ManagedClustersDenied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "managed_clusters_denied_total",
+			Help: "Number of managed clusters that were filtered out by the authorizer, by the kind of the " +
+				"object that identified them. counted on every sync attempt of the object, retries included.",
+		}, []string{kindLabel}),
+		DBUpdateRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_update_retries_total",
+			Help:      "Number of optimistic-concurrency retry rounds of managed cluster label updates in the DB.",
+		}),
+		SyncInterval: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sync_interval_seconds",
+			Help:      "Current interval of the git storage walker's periodic sync.",
+		}),
+		DriftedManagedClusters: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "drifted_managed_clusters",
+			Help: "Number of managed clusters whose labels in the DB drifted from the labels that the synced " +
+				"objects assign, by subscription. updated by each drift detection.",
+		}, []string{subscriptionLabel}),
+		DriftCorrectedManagedClusters: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "drift_corrected_managed_clusters_total",
+			Help:      "Number of drifted managed clusters whose labels were corrected.",
+		}),
+		MembershipUpdatedManagedClusters: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "membership_updated_managed_clusters_total",
+			Help: "Number of managed clusters whose labels were updated by the re-evaluation of dynamic " +
+				"identifiers, since they joined / left the identified managed clusters.",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		metrics.ReposScanned, metrics.SyncDuration, metrics.FilesSynced, metrics.FilesFailed,
+		metrics.ManagedClustersLabeled, metrics.ManagedClustersDenied, metrics.DBUpdateRetries, metrics.SyncInterval,
+		metrics.DriftedManagedClusters, metrics.DriftCorrectedManagedClusters, metrics.MembershipUpdatedManagedClusters,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register metrics collector - %w", err)
+		}
+	}
+
+	return metrics, nil
+}
+
+// Metrics holds the prometheus collectors of the git storage walker, syncers and DB.
+type Metrics struct {
+	// ReposScanned counts the local git repos that were scanned.
+	ReposScanned prometheus.Counter
+	// SyncDuration observes the duration of each attempt to sync a single object, by kind.
+	SyncDuration *prometheus.HistogramVec
+	// FilesSynced counts the files whose objects were all synced.
+	FilesSynced prometheus.Counter
+	// FilesFailed counts the files that failed to be synced.
+	FilesFailed prometheus.Counter
+	// ManagedClustersLabeled counts managed cluster label assignments, by kind.
+	ManagedClustersLabeled *prometheus.CounterVec
+	// ManagedClustersDenied counts managed clusters that were filtered out by the authorizer on each sync attempt,
+	// by kind.
+	ManagedClustersDenied *prometheus.CounterVec
+	// DBUpdateRetries counts optimistic-concurrency retry rounds of label updates.
+	DBUpdateRetries prometheus.Counter
+	// SyncInterval holds the current interval of the periodic sync.
+	SyncInterval prometheus.Gauge
+	// DriftedManagedClusters holds the number of managed clusters whose labels drifted, by subscription.
+	DriftedManagedClusters *prometheus.GaugeVec
+	// DriftCorrectedManagedClusters counts drifted managed clusters whose labels were corrected.
+	DriftCorrectedManagedClusters prometheus.Counter
+	// MembershipUpdatedManagedClusters counts managed clusters whose labels were updated by the re-evaluation of
+	// dynamic identifiers.
+	MembershipUpdatedManagedClusters prometheus.Counter
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "hub-of-hubs-gitops"
+	tracerName  = "github.com/stolostron/hub-of-hubs-nonk8s-gitops"
+	// envVarOTLPEndpoint and envVarOTLPTracesEndpoint are the standard OTLP exporter endpoint environment variables,
+	// tracing is enabled only if one of them is set.
+	envVarOTLPEndpoint       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	envVarOTLPTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+)
+
+// InitTracing sets up exporting the spans over OTLP (HTTP) if an OTLP endpoint is configured, the exporter is
+// configured by the standard OTEL_EXPORTER_OTLP_* environment variables. returns a function that flushes the spans and
+// stops exporting them. if no endpoint is configured, spans are not recorded.
+func InitTracing(ctx context.Context) (func(ctx context.Context) error, error) {
+	_, endpointFound := os.LookupEnv(envVarOTLPEndpoint)
+	_, tracesEndpointFound := os.LookupEnv(envVarOTLPTracesEndpoint)
+
+	if !endpointFound && !tracesEndpointFound {
+		return func(ctx context.Context) error { return nil }, nil // tracing is disabled
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter - %w", err)
+	}
+
+	traceResource, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource - %w", err)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(traceResource))
+	otel.SetTracerProvider(tracerProvider)
+
+	return func(ctx context.Context) error {
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to shutdown tracer provider - %w", err)
+		}
+
+		return nil
+	}, nil
+}
+
+// StartSpan starts a span with the given name and attributes as a child of the span in ctx (if any). returns a context
+// that holds the new span.
+func StartSpan(ctx context.Context, spanName string, options ...trace.SpanStartOption) (context.Context,
+	trace.Span,
+) {
+	return otel.Tracer(tracerName).Start(ctx, spanName, options...)
+}
+
+// SetError records the given error (if not nil) as the status of the span.
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,52 @@
+package yamltypes
+
+import (
+	"bytes"
+	"strings"
+)
+
+const documentSeparator = "---"
+
+// SplitDocuments splits a (multi-document) yaml byte slice into its documents. Documents that hold no content (only
+// whitespaces and comments) are dropped, so that the index of a document in the returned slice is its index among
+// the non-empty documents of the data.
+func SplitDocuments(data []byte) [][]byte {
+	documents := make([][]byte, 0)
+	document := &bytes.Buffer{}
+	documentHasContent := false
+
+	appendDocument := func() {
+		if documentHasContent {
+			documents = append(documents, document.Bytes())
+		}
+
+		document = &bytes.Buffer{}
+		documentHasContent = false
+	}
+
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if isDocumentSeparator(line) {
+			appendDocument()
+			continue
+		}
+
+		if trimmedLine := strings.TrimSpace(line); trimmedLine != "" && !strings.HasPrefix(trimmedLine, "#") {
+			documentHasContent = true
+		}
+
+		document.WriteString(line)
+	}
+
+	appendDocument()
+
+	return documents
+}
+
+// isDocumentSeparator returns whether the given line starts a new document ("---", optionally followed by a
+// whitespace and a comment).
+func isDocumentSeparator(line string) bool {
+	line = strings.TrimRight(line, "\r\n")
+
+	return line == documentSeparator || strings.HasPrefix(line, documentSeparator+" ") ||
+		strings.HasPrefix(line, documentSeparator+"\t")
+}
@@ -0,0 +1,314 @@
+package yamltypes
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	errHubIdentifiedTwice = errors.New("hub identifier can not have both name and namePattern")
+	errHubNotIdentified   = errors.New("hub identifier must have either name or namePattern")
+)
+
+// HubIdentifier identifies managed clusters within a specific hub, or within all hubs whose names match a pattern.
+// Managed clusters are identified by name and/or by a label selector, except for the excluded ones. Identifiers with a
+// hub name pattern or a label selector are resolved against the managed clusters in the status DB at sync time.
+type HubIdentifier struct {
+	// Name of the hub.
+	Name string `yaml:"name"`
+	// NamePattern is a glob pattern (e.g. prod-*) of hub names, used instead of Name. if no MCs are identified by name
+	// or by a selector, all MCs of the matching hubs are identified.
+	NamePattern string `yaml:"namePattern"`
+	// ManagedClusterIDs is an array of MC identifiers.
+	ManagedClusterIDs []string `yaml:"managedClusterIdentifiers"`
+	// ManagedClusterSelector selects MCs by their labels. an empty selector selects all MCs of the hub(s).
+	ManagedClusterSelector *ManagedClusterSelector `yaml:"managedClusterSelector"`
+	// Exclude holds the MCs of the hub(s) that are not identified, even if identified by other identifiers.
+	Exclude *ManagedClustersExclusion `yaml:"exclude"`
+}
+
+// ManagedClustersExclusion identifies managed clusters to exclude, by name and/or by a label selector.
+type ManagedClustersExclusion struct {
+	// ManagedClusterIDs is an array of excluded MC identifiers.
+	ManagedClusterIDs []string `yaml:"managedClusterIdentifiers"`
+	// ManagedClusterSelector selects excluded MCs by their labels.
+	ManagedClusterSelector *ManagedClusterSelector `yaml:"managedClusterSelector"`
+}
+
+// ManagedClusterSelector is a label selector of managed clusters, with the semantics of a k8s label selector.
+type ManagedClusterSelector struct {
+	// MatchLabels is a map of label key -> value that MCs must be labeled with.
+	MatchLabels map[string]string `yaml:"matchLabels"`
+	// MatchExpressions is a list of requirements on the MCs labels.
+	MatchExpressions []ManagedClusterSelectorRequirement `yaml:"matchExpressions"`
+}
+
+// ManagedClusterSelectorRequirement is a requirement on the value of a label key.
+type ManagedClusterSelectorRequirement struct {
+	// Key of the label.
+	Key string `yaml:"key"`
+	// Operator is one of In, NotIn, Exists or DoesNotExist.
+	Operator string `yaml:"operator"`
+	// Values of the label, must be empty if the operator is Exists or DoesNotExist.
+	Values []string `yaml:"values"`
+}
+
+// IsDynamic returns whether the identified managed clusters are resolved against the status DB, i.e. whether the
+// identifier has a hub name pattern or a label selector (of identified or of excluded managed clusters).
+func (hi *HubIdentifier) IsDynamic() bool {
+	return hi.NamePattern != "" || hi.ManagedClusterSelector != nil ||
+		(hi.Exclude != nil && hi.Exclude.ManagedClusterSelector != nil)
+}
+
+// Validate returns an error if the identifier can not be resolved.
+func (hi *HubIdentifier) Validate() error {
+	if hi.Name != "" && hi.NamePattern != "" {
+		return fmt.Errorf("%w: %s, %s", errHubIdentifiedTwice, hi.Name, hi.NamePattern)
+	}
+
+	if hi.Name == "" && hi.NamePattern == "" {
+		return errHubNotIdentified
+	}
+
+	if _, err := path.Match(hi.NamePattern, ""); err != nil {
+		return fmt.Errorf("invalid hub name pattern %s - %w", hi.NamePattern, err)
+	}
+
+	if hi.ManagedClusterSelector != nil {
+		if _, err := hi.ManagedClusterSelector.AsLabelSelector(); err != nil {
+			return fmt.Errorf("invalid managed cluster selector - %w", err)
+		}
+	}
+
+	if hi.Exclude != nil && hi.Exclude.ManagedClusterSelector != nil {
+		if _, err := hi.Exclude.ManagedClusterSelector.AsLabelSelector(); err != nil {
+			return fmt.Errorf("invalid excluded managed cluster selector - %w", err)
+		}
+	}
+
+	return nil
+}
+
+// MatchesHub returns whether the identifier identifies managed clusters within the given hub.
+func (hi *HubIdentifier) MatchesHub(hubName string) bool {
+	if hi.NamePattern == "" {
+		return hi.Name == hubName
+	}
+
+	matched, err := path.Match(hi.NamePattern, hubName)
+
+	return err == nil && matched
+}
+
+// addManagedClusters adds the managed clusters identified by the identifier to the given map of hub -> set of
+// managed clusters. dynamic identifiers are resolved against the given map of hub -> managed cluster -> labels.
+func (hi *HubIdentifier) addManagedClusters(hubToManagedClustersSetMap map[string]map[string]struct{},
+	hubToManagedClusterLabelsMap map[string]map[string]map[string]string,
+) error {
+	selector := hi.ManagedClusterSelector
+	if hi.NamePattern != "" && len(hi.ManagedClusterIDs) == 0 && selector == nil {
+		selector = &ManagedClusterSelector{} // a hub name pattern alone identifies all MCs of the matching hubs
+	}
+
+	if err := hi.addMatchingManagedClusters(hubToManagedClustersSetMap, hubToManagedClusterLabelsMap,
+		hi.ManagedClusterIDs, selector); err != nil {
+		return fmt.Errorf("invalid managed cluster selector - %w", err)
+	}
+
+	return nil
+}
+
+// addExcludedManagedClusters adds the managed clusters excluded by the identifier to the given map of hub -> set of
+// managed clusters. selectors are resolved against the given map of hub -> managed cluster -> labels.
+func (hi *HubIdentifier) addExcludedManagedClusters(hubToManagedClustersSetMap map[string]map[string]struct{},
+	hubToManagedClusterLabelsMap map[string]map[string]map[string]string,
+) error {
+	if hi.Exclude == nil {
+		return nil
+	}
+
+	if err := hi.addMatchingManagedClusters(hubToManagedClustersSetMap, hubToManagedClusterLabelsMap,
+		hi.Exclude.ManagedClusterIDs, hi.Exclude.ManagedClusterSelector); err != nil {
+		return fmt.Errorf("invalid excluded managed cluster selector - %w", err)
+	}
+
+	return nil
+}
+
+// addMatchingManagedClusters adds the managed clusters of the hubs that the identifier matches, that are either
+// listed in managedClusterIDs or match selector (if not nil), to the given map of hub -> set of managed clusters.
+// managed clusters that are listed within a named hub are added even if they are not in the status DB.
+func (hi *HubIdentifier) addMatchingManagedClusters(hubToManagedClustersSetMap map[string]map[string]struct{},
+	hubToManagedClusterLabelsMap map[string]map[string]map[string]string, managedClusterIDs []string,
+	selector *ManagedClusterSelector,
+) error {
+	addManagedCluster := func(hubName string, managedClusterName string) {
+		if _, found := hubToManagedClustersSetMap[hubName]; !found {
+			hubToManagedClustersSetMap[hubName] = make(map[string]struct{})
+		}
+
+		hubToManagedClustersSetMap[hubName][managedClusterName] = struct{}{}
+	}
+
+	managedClusterIDsSet := make(map[string]struct{}, len(managedClusterIDs))
+
+	for _, managedClusterID := range managedClusterIDs {
+		managedClusterIDsSet[managedClusterID] = struct{}{}
+
+		if hi.NamePattern == "" {
+			addManagedCluster(hi.Name, managedClusterID)
+		}
+	}
+
+	if hi.NamePattern == "" && selector == nil {
+		return nil // nothing to resolve
+	}
+
+	labelSelector := labels.Nothing()
+
+	if selector != nil {
+		k8sSelector, err := selector.AsLabelSelector()
+		if err != nil {
+			return err
+		}
+
+		labelSelector = k8sSelector
+	}
+
+	for hubName, managedClusterToLabelsMap := range hubToManagedClusterLabelsMap {
+		if !hi.MatchesHub(hubName) {
+			continue
+		}
+
+		for managedClusterName, managedClusterLabels := range managedClusterToLabelsMap {
+			if _, found := managedClusterIDsSet[managedClusterName]; found ||
+				labelSelector.Matches(labels.Set(managedClusterLabels)) {
+				addManagedCluster(hubName, managedClusterName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// AsLabelSelector returns the selector as a k8s label selector.
+func (selector *ManagedClusterSelector) AsLabelSelector() (labels.Selector, error) {
+	labelSelector := &metav1.LabelSelector{
+		MatchLabels:      selector.MatchLabels,
+		MatchExpressions: make([]metav1.LabelSelectorRequirement, 0, len(selector.MatchExpressions)),
+	}
+
+	for _, requirement := range selector.MatchExpressions {
+		labelSelector.MatchExpressions = append(labelSelector.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      requirement.Key,
+			Operator: metav1.LabelSelectorOperator(requirement.Operator),
+			Values:   requirement.Values,
+		})
+	}
+
+	k8sSelector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse label selector - %w", err)
+	}
+
+	return k8sSelector, nil
+}
+
+// validateIdentifiers returns an error if any of the given identifiers can not be resolved.
+func validateIdentifiers(identifiers []map[string]HubIdentifier) error {
+	for _, identifier := range identifiers {
+		for _, hubIdentifier := range identifier {
+			hubIdentifier := hubIdentifier
+			if err := hubIdentifier.Validate(); err != nil {
+				return fmt.Errorf("invalid identifier - %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// objectIdentifiers holds the identifiers of an object of any of the kinds that assign labels to identified managed
+// clusters.
+type objectIdentifiers struct {
+	Spec struct {
+		Identifiers []map[string]HubIdentifier `yaml:"identifiers"`
+	} `yaml:"spec"`
+}
+
+// NewIdentifiersFromBytes unmarshals the identifiers (spec.identifiers) of an object of any kind from a byte slice.
+func NewIdentifiersFromBytes(data []byte) ([]map[string]HubIdentifier, error) {
+	object := &objectIdentifiers{}
+
+	if err := yaml.Unmarshal(data, object); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml - %w", err)
+	}
+
+	return object.Spec.Identifiers, nil
+}
+
+// IdentifiersAreDynamic returns whether any of the given identifiers is resolved against the status DB.
+func IdentifiersAreDynamic(identifiers []map[string]HubIdentifier) bool {
+	for _, identifier := range identifiers {
+		for _, hubIdentifier := range identifier {
+			hubIdentifier := hubIdentifier
+			if hubIdentifier.IsDynamic() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// GetHubToManagedClustersMap returns a map of hub -> sorted managed clusters identified by the given identifiers.
+// managed clusters that are excluded by any of the identifiers are not identified, even if identified by others.
+// hubToManagedClusterLabelsMap is a map of hub -> managed cluster -> labels of the managed clusters in the status DB,
+// that dynamic identifiers are resolved against (it is not used if none of the identifiers is dynamic). managed
+// clusters that are identified by name within a named hub are identified even if they are not in the status DB.
+func GetHubToManagedClustersMap(identifiers []map[string]HubIdentifier,
+	hubToManagedClusterLabelsMap map[string]map[string]map[string]string,
+) (map[string][]string, error) {
+	hubToManagedClustersSetMap := make(map[string]map[string]struct{})
+	hubToExcludedManagedClustersSetMap := make(map[string]map[string]struct{})
+
+	for _, identifier := range identifiers {
+		for _, hubIdentifier := range identifier {
+			hubIdentifier := hubIdentifier
+			if err := hubIdentifier.addManagedClusters(hubToManagedClustersSetMap,
+				hubToManagedClusterLabelsMap); err != nil {
+				return nil, fmt.Errorf("failed to resolve identifier - %w", err)
+			}
+
+			if err := hubIdentifier.addExcludedManagedClusters(hubToExcludedManagedClustersSetMap,
+				hubToManagedClusterLabelsMap); err != nil {
+				return nil, fmt.Errorf("failed to resolve identifier - %w", err)
+			}
+		}
+	}
+
+	hubToManagedClustersMap := make(map[string][]string, len(hubToManagedClustersSetMap))
+
+	for hubName, managedClustersSet := range hubToManagedClustersSetMap {
+		managedClusters := make([]string, 0, len(managedClustersSet))
+
+		for managedClusterName := range managedClustersSet {
+			if _, excluded := hubToExcludedManagedClustersSetMap[hubName][managedClusterName]; excluded {
+				continue // exclusions take precedence
+			}
+
+			managedClusters = append(managedClusters, managedClusterName)
+		}
+
+		sort.Strings(managedClusters)
+		hubToManagedClustersMap[hubName] = managedClusters
+	}
+
+	return hubToManagedClustersMap, nil
+}
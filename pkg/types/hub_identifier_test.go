@@ -0,0 +1,252 @@
+package yamltypes
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHubIdentifierValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		hubIdentifier *HubIdentifier
+		expectedErr   error
+		expectFailure bool
+	}{
+		{
+			name:          "name",
+			hubIdentifier: &HubIdentifier{Name: "hub1"},
+		},
+		{
+			name:          "name pattern",
+			hubIdentifier: &HubIdentifier{NamePattern: "prod-*"},
+		},
+		{
+			name:          "both name and name pattern",
+			hubIdentifier: &HubIdentifier{Name: "hub1", NamePattern: "prod-*"},
+			expectedErr:   errHubIdentifiedTwice,
+			expectFailure: true,
+		},
+		{
+			name:          "neither name nor name pattern",
+			hubIdentifier: &HubIdentifier{ManagedClusterIDs: []string{"cluster1"}},
+			expectedErr:   errHubNotIdentified,
+			expectFailure: true,
+		},
+		{
+			name:          "invalid name pattern",
+			hubIdentifier: &HubIdentifier{NamePattern: "prod-["},
+			expectFailure: true,
+		},
+		{
+			name: "invalid managed cluster selector",
+			hubIdentifier: &HubIdentifier{
+				Name: "hub1",
+				ManagedClusterSelector: &ManagedClusterSelector{
+					MatchExpressions: []ManagedClusterSelectorRequirement{{Key: "env", Operator: "Equals"}},
+				},
+			},
+			expectFailure: true,
+		},
+		{
+			name: "invalid excluded managed cluster selector",
+			hubIdentifier: &HubIdentifier{
+				Name: "hub1",
+				Exclude: &ManagedClustersExclusion{
+					ManagedClusterSelector: &ManagedClusterSelector{
+						MatchExpressions: []ManagedClusterSelectorRequirement{{Key: "env", Operator: "Exists",
+							Values: []string{"prod"}}},
+					},
+				},
+			},
+			expectFailure: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := test.hubIdentifier.Validate()
+			if (err != nil) != test.expectFailure {
+				t.Fatalf("expected failure: %t, got error: %v", test.expectFailure, err)
+			}
+
+			if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestGetHubToManagedClustersMap(t *testing.T) {
+	t.Parallel()
+
+	hubToManagedClusterLabelsMap := map[string]map[string]map[string]string{
+		"prod-east": {
+			"cluster1": {"env": "prod", "cloud": "aws"},
+			"cluster2": {"env": "prod", "cloud": "gcp"},
+			"cluster3": {"env": "staging", "cloud": "aws"},
+		},
+		"prod-west": {
+			"cluster4": {"env": "prod", "cloud": "aws"},
+		},
+		"dev": {
+			"cluster5": {"env": "dev", "cloud": "aws"},
+		},
+	}
+
+	awsSelector := &ManagedClusterSelector{MatchLabels: map[string]string{"cloud": "aws"}}
+
+	tests := []struct {
+		name        string
+		identifiers []map[string]HubIdentifier
+		expected    map[string][]string
+	}{
+		{
+			name: "managed clusters by name",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {Name: "prod-east", ManagedClusterIDs: []string{"cluster2", "cluster1", "cluster9"}}},
+			},
+			expected: map[string][]string{"prod-east": {"cluster1", "cluster2", "cluster9"}},
+		},
+		{
+			name: "hub name pattern",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {NamePattern: "prod-*", ManagedClusterIDs: []string{"cluster1", "cluster4", "cluster9"}}},
+			},
+			expected: map[string][]string{"prod-east": {"cluster1"}, "prod-west": {"cluster4"}},
+		},
+		{
+			name: "hub name pattern only",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {NamePattern: "prod-*"}},
+			},
+			expected: map[string][]string{
+				"prod-east": {"cluster1", "cluster2", "cluster3"},
+				"prod-west": {"cluster4"},
+			},
+		},
+		{
+			name: "hub name pattern only with exclusions",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {NamePattern: "prod-*", Exclude: &ManagedClustersExclusion{ManagedClusterIDs: []string{"cluster2"}}}},
+			},
+			expected: map[string][]string{"prod-east": {"cluster1", "cluster3"}, "prod-west": {"cluster4"}},
+		},
+		{
+			name: "managed cluster selector",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {Name: "prod-east", ManagedClusterSelector: awsSelector}},
+			},
+			expected: map[string][]string{"prod-east": {"cluster1", "cluster3"}},
+		},
+		{
+			name: "empty managed cluster selector",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {Name: "prod-west", ManagedClusterSelector: &ManagedClusterSelector{}}},
+			},
+			expected: map[string][]string{"prod-west": {"cluster4"}},
+		},
+		{
+			name: "managed cluster selector with expressions",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {NamePattern: "*", ManagedClusterSelector: &ManagedClusterSelector{
+					MatchExpressions: []ManagedClusterSelectorRequirement{
+						{Key: "env", Operator: "In", Values: []string{"prod", "dev"}},
+						{Key: "cloud", Operator: "NotIn", Values: []string{"gcp"}},
+					},
+				}}},
+			},
+			expected: map[string][]string{
+				"prod-east": {"cluster1"},
+				"prod-west": {"cluster4"},
+				"dev":       {"cluster5"},
+			},
+		},
+		{
+			name: "hub name pattern with selector and names",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {
+					NamePattern:            "prod-*",
+					ManagedClusterIDs:      []string{"cluster2"},
+					ManagedClusterSelector: &ManagedClusterSelector{MatchLabels: map[string]string{"env": "staging"}},
+				}},
+			},
+			expected: map[string][]string{"prod-east": {"cluster2", "cluster3"}},
+		},
+		{
+			name: "excluded by name",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {
+					NamePattern:            "prod-*",
+					ManagedClusterSelector: awsSelector,
+					Exclude:                &ManagedClustersExclusion{ManagedClusterIDs: []string{"cluster1"}},
+				}},
+			},
+			expected: map[string][]string{"prod-east": {"cluster3"}, "prod-west": {"cluster4"}},
+		},
+		{
+			name: "excluded by selector",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {
+					Name:              "prod-east",
+					ManagedClusterIDs: []string{"cluster1", "cluster2", "cluster3"},
+					Exclude: &ManagedClustersExclusion{
+						ManagedClusterSelector: &ManagedClusterSelector{MatchLabels: map[string]string{"env": "prod"}},
+					},
+				}},
+			},
+			expected: map[string][]string{"prod-east": {"cluster3"}},
+		},
+		{
+			name: "exclusions take precedence over other identifiers",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {Name: "prod-east", ManagedClusterIDs: []string{"cluster1", "cluster2"}}},
+				{"hub": {
+					NamePattern:            "prod-*",
+					ManagedClusterSelector: awsSelector,
+					Exclude:                &ManagedClustersExclusion{ManagedClusterIDs: []string{"cluster1"}},
+				}},
+			},
+			expected: map[string][]string{"prod-east": {"cluster2", "cluster3"}, "prod-west": {"cluster4"}},
+		},
+		{
+			name: "all managed clusters of hub excluded",
+			identifiers: []map[string]HubIdentifier{
+				{"hub": {
+					Name:              "prod-west",
+					ManagedClusterIDs: []string{"cluster4"},
+					Exclude:           &ManagedClustersExclusion{ManagedClusterSelector: awsSelector},
+				}},
+			},
+			expected: map[string][]string{"prod-west": {}},
+		},
+		{
+			name:        "no identifiers",
+			identifiers: []map[string]HubIdentifier{},
+			expected:    map[string][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := GetHubToManagedClustersMap(test.identifiers, hubToManagedClusterLabelsMap)
+			if err != nil {
+				t.Fatalf("failed to get managed clusters - %v", err)
+			}
+
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package yamltypes
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	"gopkg.in/yaml.v2"
+)
+
+// ManagedClusterLabelsKind is the kind of a ManagedClusterLabels yaml.
+const ManagedClusterLabelsKind = "ManagedClusterLabels"
+
+var errLabelKeyNotAllowed = errors.New("label key is not allowed")
+
+// NewManagedClusterLabelsFromBytes unmarshals a byte slice into a ManagedClusterLabels. fails if any of the label
+// keys is not prefixed by the hub-of-hubs group, or if any of the identifiers is invalid.
+func NewManagedClusterLabelsFromBytes(data []byte) (*ManagedClusterLabels, error) {
+	managedClusterLabels := &ManagedClusterLabels{}
+
+	if err := yaml.Unmarshal(data, managedClusterLabels); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml - %w", err)
+	}
+
+	if err := validateIdentifiers(managedClusterLabels.Spec.Identifiers); err != nil {
+		return nil, err
+	}
+
+	for labelKey := range managedClusterLabels.Spec.Labels {
+		if !strings.HasPrefix(labelKey, fmt.Sprintf("%s/", db.HubOfHubsGroup)) {
+			return nil, fmt.Errorf("%w: %s, keys must be prefixed by %s/", errLabelKeyNotAllowed, labelKey,
+				db.HubOfHubsGroup)
+		}
+	}
+
+	return managedClusterLabels, nil
+}
+
+// ManagedClusterLabels implements the API for a ManagedClusterLabels.
+type ManagedClusterLabels struct {
+	// Kind is kind of yaml.
+	Kind string `yaml:"kind"`
+	// ManagedClusterLabelsMetadata is the metadata of a ManagedClusterLabels.
+	Metadata ManagedClusterLabelsMetadata `yaml:"metadata"`
+	// ManagedClusterLabelsSpec is the spec of a ManagedClusterLabels.
+	Spec ManagedClusterLabelsSpec `yaml:"spec"`
+}
+
+// ManagedClusterLabelsMetadata is the metadata of a ManagedClusterLabels.
+type ManagedClusterLabelsMetadata struct {
+	// Name of the labels object.
+	Name string `yaml:"name"`
+}
+
+// ManagedClusterLabelsSpec is the spec of a ManagedClusterLabels. The spec contains the labels to assign and the
+// identifiers of MCs to be assigned with them.
+type ManagedClusterLabelsSpec struct {
+	// Labels is a map of label key -> value. keys must be prefixed by the hub-of-hubs group.
+	Labels map[string]string `yaml:"labels"`
+	// Identifiers of the managed clusters.
+	Identifiers []map[string]HubIdentifier `yaml:"identifiers"`
+}
+
+// GetLabels returns the labels that are assigned to the managed clusters, labels with empty values are assigned with
+// the default tag value.
+func (mcl *ManagedClusterLabels) GetLabels() map[string]string {
+	labels := make(map[string]string, len(mcl.Spec.Labels))
+
+	for labelKey, labelValue := range mcl.Spec.Labels {
+		if labelValue == "" {
+			labelValue = db.ManagedClusterSetDefaultTagValue
+		}
+
+		labels[labelKey] = labelValue
+	}
+
+	return labels
+}
+
+// GetLabelKeys returns the sorted keys of the labels.
+func (mcl *ManagedClusterLabels) GetLabelKeys() []string {
+	labelKeys := make([]string, 0, len(mcl.Spec.Labels))
+	for labelKey := range mcl.Spec.Labels {
+		labelKeys = append(labelKeys, labelKey)
+	}
+
+	sort.Strings(labelKeys)
+
+	return labelKeys
+}
@@ -8,7 +8,11 @@ import (
 	controllerruntime "sigs.k8s.io/controller-runtime"
 )
 
-// NewManagedClusterSetFromBytes unmarshals a byte slice into a ManagedClusterSet.
+// ManagedClusterSetKind is the kind of a ManagedClusterSet yaml.
+const ManagedClusterSetKind = "HubOfHubsManagedClusterSet"
+
+// NewManagedClusterSetFromBytes unmarshals a byte slice into a ManagedClusterSet. fails if any of the identifiers is
+// invalid.
 func NewManagedClusterSetFromBytes(data []byte) (*ManagedClusterSet, error) {
 	managedClusterSet := &ManagedClusterSet{}
 
@@ -16,6 +20,10 @@ func NewManagedClusterSetFromBytes(data []byte) (*ManagedClusterSet, error) {
 		return nil, fmt.Errorf("failed to unmarshal yaml - %w", err)
 	}
 
+	if err := validateIdentifiers(managedClusterSet.Spec.Identifiers); err != nil {
+		return nil, err
+	}
+
 	return managedClusterSet, nil
 }
 
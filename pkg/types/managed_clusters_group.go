@@ -1,12 +1,35 @@
 package yamltypes
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
 	"gopkg.in/yaml.v2"
 )
 
-// NewManagedClustersGroupFromBytes unmarshals a byte slice into a ManagedClustersGroup.
+const (
+	// ManagedClustersGroupKind is the kind of a ManagedClustersGroup yaml.
+	ManagedClustersGroupKind = "ManagedClustersGroup"
+	// CompositionOperatorUnion composes the managed clusters that are members of any of the referenced groups.
+	CompositionOperatorUnion = "union"
+	// CompositionOperatorIntersection composes the managed clusters that are members of all the referenced groups.
+	CompositionOperatorIntersection = "intersection"
+	// CompositionOperatorDifference composes the managed clusters that are members of the first referenced group but
+	// are not members of any of the other referenced groups.
+	CompositionOperatorDifference = "difference"
+)
+
+var (
+	errInvalidCompositionOperator = errors.New("composition operator must be one of union, intersection and " +
+		"difference")
+	errEmptyComposition        = errors.New("composition must reference at least one group")
+	errGroupReferencesItself   = errors.New("group can not reference itself")
+	errEmptyGroupReferenceName = errors.New("referenced group name can not be empty")
+)
+
+// NewManagedClustersGroupFromBytes unmarshals a byte slice into a ManagedClustersGroup. fails if any of the
+// identifiers or the composition is invalid.
 func NewManagedClustersGroupFromBytes(data []byte) (*ManagedClustersGroup, error) {
 	managedClustersGroup := &ManagedClustersGroup{}
 
@@ -14,6 +37,14 @@ func NewManagedClustersGroupFromBytes(data []byte) (*ManagedClustersGroup, error
 		return nil, fmt.Errorf("failed to unmarshal yaml - %w", err)
 	}
 
+	if err := validateIdentifiers(managedClustersGroup.Spec.Identifiers); err != nil {
+		return nil, err
+	}
+
+	if err := managedClustersGroup.validateComposition(); err != nil {
+		return nil, fmt.Errorf("invalid composition - %w", err)
+	}
+
 	return managedClustersGroup, nil
 }
 
@@ -34,18 +65,70 @@ type ManagedClustersGroupMetadata struct {
 }
 
 // ManagedClustersGroupSpec is the spec of a ManagedClustersGroup. The spec contains identifiers of MCs to be tagged
-// with the cluster group.
+// with the cluster group, and optionally a composition of other groups whose MCs are tagged as well.
 type ManagedClustersGroupSpec struct {
 	// TagValue is the value that will be assigned to the group label's key.
 	TagValue string `yaml:"tagValue"`
 	// Identifiers of the managed clusters.
 	Identifiers []map[string]HubIdentifier `yaml:"identifiers"`
+	// Composition of other groups (of the same repo), nil if the group is not composed.
+	Composition *ManagedClustersGroupComposition `yaml:"composition"`
 }
 
-// HubIdentifier identifies managed clusters within a specific hub.
-type HubIdentifier struct {
-	// Name of the hub.
-	Name string `yaml:"name"`
-	// ManagedClusterIDs is an array of MC identifiers.
-	ManagedClusterIDs []string `yaml:"managedClusterIdentifiers"`
+// ManagedClustersGroupComposition composes the MCs of a group from the MCs of other groups, by a set operator. the
+// composed MCs are added to the MCs identified by the group's identifiers.
+type ManagedClustersGroupComposition struct {
+	// Operator is one of CompositionOperatorUnion, CompositionOperatorIntersection and CompositionOperatorDifference.
+	Operator string `yaml:"operator"`
+	// Groups are the names of the referenced groups, in order.
+	Groups []string `yaml:"groups"`
+}
+
+// GetLabelKey returns the key of the label that the group assigns to its managed clusters.
+func (mcg *ManagedClustersGroup) GetLabelKey() string {
+	return fmt.Sprintf("%s/%s", db.HubOfHubsGroup, mcg.Metadata.Name)
+}
+
+// GetReferences returns the identifiers (kind/name) of the groups that the group is composed of. empty if the group is
+// not composed.
+func (mcg *ManagedClustersGroup) GetReferences() []string {
+	if mcg.Spec.Composition == nil {
+		return []string{}
+	}
+
+	references := make([]string, 0, len(mcg.Spec.Composition.Groups))
+	for _, groupName := range mcg.Spec.Composition.Groups {
+		references = append(references, fmt.Sprintf("%s/%s", ManagedClustersGroupKind, groupName))
+	}
+
+	return references
+}
+
+func (mcg *ManagedClustersGroup) validateComposition() error {
+	composition := mcg.Spec.Composition
+	if composition == nil {
+		return nil
+	}
+
+	switch composition.Operator {
+	case CompositionOperatorUnion, CompositionOperatorIntersection, CompositionOperatorDifference:
+	default:
+		return fmt.Errorf("%w: %s", errInvalidCompositionOperator, composition.Operator)
+	}
+
+	if len(composition.Groups) == 0 {
+		return errEmptyComposition
+	}
+
+	for _, groupName := range composition.Groups {
+		if groupName == "" {
+			return errEmptyGroupReferenceName
+		}
+
+		if groupName == mcg.Metadata.Name {
+			return fmt.Errorf("%w: %s", errGroupReferencesItself, groupName)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,37 @@
+package yamltypes
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// NewObjectHeaderFromBytes unmarshals a byte slice into an ObjectHeader.
+func NewObjectHeaderFromBytes(data []byte) (*ObjectHeader, error) {
+	objectHeader := &ObjectHeader{}
+
+	if err := yaml.Unmarshal(data, objectHeader); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml - %w", err)
+	}
+
+	return objectHeader, nil
+}
+
+// ObjectHeader holds the fields that are common to all non-k8s gitops objects and identify them.
+type ObjectHeader struct {
+	// Kind is kind of yaml.
+	Kind string `yaml:"kind"`
+	// Metadata is the metadata of the object.
+	Metadata ObjectHeaderMetadata `yaml:"metadata"`
+}
+
+// ObjectHeaderMetadata is the metadata that is common to all non-k8s gitops objects.
+type ObjectHeaderMetadata struct {
+	// Name of the object.
+	Name string `yaml:"name"`
+}
+
+// GetIdentifier returns a string that uniquely identifies the object (kind/name).
+func (header *ObjectHeader) GetIdentifier() string {
+	return fmt.Sprintf("%s/%s", header.Kind, header.Metadata.Name)
+}
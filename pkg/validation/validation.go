@@ -0,0 +1,383 @@
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/db"
+	yamltypes "github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/types"
+	"gopkg.in/yaml.v2"
+)
+
+// Issue is a problem that was found by the validation in a file or in an object.
+type Issue struct {
+	// FilePath is the path of the file, relative to the validated directory.
+	FilePath string `yaml:"file"`
+	// DocumentIndex is the index of the object's document within its file. -1 if the issue is of the whole file.
+	DocumentIndex int `yaml:"documentIndex"`
+	// Object identifies the object (kind/name). empty if the object could not be identified.
+	Object string `yaml:"object,omitempty"`
+	// Message describes the issue.
+	Message string `yaml:"message"`
+}
+
+func (issue *Issue) String() string {
+	location := issue.FilePath
+	if issue.DocumentIndex >= 0 {
+		location = fmt.Sprintf("%s (document %d)", issue.FilePath, issue.DocumentIndex)
+	}
+
+	if issue.Object != "" {
+		location = fmt.Sprintf("%s %s", location, issue.Object)
+	}
+
+	return fmt.Sprintf("%s: %s", location, issue.Message)
+}
+
+// validateObjectFunc validates the object in a document of a specific kind. returns the object's spec fields that
+// are validated across kinds and the messages of the issues that were found in the object.
+type validateObjectFunc func(document []byte) (*objectSpec, []string)
+
+// objectSpec holds the fields of an object that are validated regardless of its kind.
+type objectSpec struct {
+	// labelKeys are the keys of the labels that the object assigns.
+	labelKeys []string
+	// identifiers are the identifiers of the managed clusters that the object assigns labels to.
+	identifiers []map[string]yamltypes.HubIdentifier
+	// references are the identifiers (kind/name) of the objects that the object references.
+	references []string
+}
+
+// objectLocation is the location of an object that was validated.
+type objectLocation struct {
+	filePath      string
+	documentIndex int
+	// kind of the object.
+	kind string
+	// labelKeys are the keys of the labels that the object assigns.
+	labelKeys []string
+	// references are the identifiers (kind/name) of the objects that the object references.
+	references []string
+}
+
+// ValidateDirectory validates the non-k8s gitops objects in the files of a local directory (e.g. a git repo clone),
+// the same way the syncer parses them, without requiring Kubernetes or a DB. workPath selects the files to validate
+// relative to dirPath, as the subscription's file-selection annotations select the files to sync. returns the issues
+// that were found, or an error if the directory could not be read.
+func ValidateDirectory(dirPath string, workPath *dbsyncer.WorkPath) ([]*Issue, error) {
+	if err := workPath.ValidatePatterns(); err != nil {
+		return nil, fmt.Errorf("invalid work path - %w", err)
+	}
+
+	kindToValidateFuncMap := map[string]validateObjectFunc{
+		yamltypes.ManagedClustersGroupKind: validateManagedClustersGroup,
+		yamltypes.ManagedClusterSetKind:    validateManagedClusterSet,
+		yamltypes.ManagedClusterLabelsKind: validateManagedClusterLabels,
+	}
+
+	issues := make([]*Issue, 0)
+	objectIdentifierToLocationMap := make(map[string]*objectLocation)
+
+	if err := workPath.WalkDir(dirPath, func(filePath string, contents []byte) error {
+		for documentIndex, document := range yamltypes.SplitDocuments(contents) {
+			issues = append(issues, validateDocument(kindToValidateFuncMap, objectIdentifierToLocationMap,
+				filePath, documentIndex, document)...)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to validate directory - %w", err)
+	}
+
+	issues = append(issues, validateReferences(objectIdentifierToLocationMap)...)
+
+	return append(issues, validateLabelKeyCollisions(objectIdentifierToLocationMap)...), nil
+}
+
+// validateDocument validates the object in a document and records its location and references, to detect duplicate
+// objects and invalid references.
+func validateDocument(kindToValidateFuncMap map[string]validateObjectFunc,
+	objectIdentifierToLocationMap map[string]*objectLocation, filePath string, documentIndex int, document []byte,
+) []*Issue {
+	issues := make([]*Issue, 0)
+
+	newIssue := func(object string, message string) *Issue {
+		return &Issue{FilePath: filePath, DocumentIndex: documentIndex, Object: object, Message: message}
+	}
+
+	objectHeader, err := yamltypes.NewObjectHeaderFromBytes(document)
+	if err != nil {
+		return append(issues, newIssue("", fmt.Sprintf("failed to get object header - %s", err.Error())))
+	}
+
+	validateFunc, found := kindToValidateFuncMap[objectHeader.Kind]
+	if !found {
+		return append(issues, newIssue("", fmt.Sprintf("kind '%s' is not supported", objectHeader.Kind)))
+	}
+
+	objectIdentifier := objectHeader.GetIdentifier()
+	spec, messages := validateFunc(document)
+
+	if objectHeader.Metadata.Name == "" {
+		issues = append(issues, newIssue(objectIdentifier, "metadata.name is empty"))
+	} else if location, found := objectIdentifierToLocationMap[objectIdentifier]; found {
+		issues = append(issues, newIssue(objectIdentifier, fmt.Sprintf(
+			"duplicate name, object is already defined in %s (document %d)", location.filePath,
+			location.documentIndex)))
+	} else {
+		location := &objectLocation{
+			filePath:      filePath,
+			documentIndex: documentIndex,
+			kind:          objectHeader.Kind,
+		}
+
+		if spec != nil {
+			location.labelKeys = spec.labelKeys
+			location.references = spec.references
+		}
+
+		objectIdentifierToLocationMap[objectIdentifier] = location
+	}
+
+	if spec != nil {
+		messages = append(messages, validateLabelKeys(spec.labelKeys)...)
+		messages = append(messages, validateIdentifiers(spec.identifiers)...)
+	}
+
+	for _, message := range messages {
+		issues = append(issues, newIssue(objectIdentifier, message))
+	}
+
+	return issues
+}
+
+// validateManagedClustersGroup validates a ManagedClustersGroup, parsed as the syncer parses it.
+func validateManagedClustersGroup(document []byte) (*objectSpec, []string) {
+	managedClustersGroup, err := yamltypes.NewManagedClustersGroupFromBytes(document)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("schema error - %s", err.Error())}
+	}
+
+	return &objectSpec{
+		labelKeys:   []string{managedClustersGroup.GetLabelKey()},
+		identifiers: managedClustersGroup.Spec.Identifiers,
+		references:  managedClustersGroup.GetReferences(),
+	}, validateStrictSchema(document, &yamltypes.ManagedClustersGroup{})
+}
+
+// validateManagedClusterSet validates a ManagedClusterSet, parsed as the syncer parses it.
+func validateManagedClusterSet(document []byte) (*objectSpec, []string) {
+	managedClusterSet, err := yamltypes.NewManagedClusterSetFromBytes(document)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("schema error - %s", err.Error())}
+	}
+
+	return &objectSpec{
+		labelKeys:   []string{db.ManagedClusterSetLabelKey},
+		identifiers: managedClusterSet.Spec.Identifiers,
+	}, validateStrictSchema(document, &yamltypes.ManagedClusterSet{})
+}
+
+// validateManagedClusterLabels validates a ManagedClusterLabels, parsed as the syncer parses it.
+func validateManagedClusterLabels(document []byte) (*objectSpec, []string) {
+	managedClusterLabels, err := yamltypes.NewManagedClusterLabelsFromBytes(document)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("schema error - %s", err.Error())}
+	}
+
+	messages := validateStrictSchema(document, &yamltypes.ManagedClusterLabels{})
+	if len(managedClusterLabels.Spec.Labels) == 0 {
+		messages = append(messages, "spec.labels is empty")
+	}
+
+	return &objectSpec{
+		labelKeys:   managedClusterLabels.GetLabelKeys(),
+		identifiers: managedClusterLabels.Spec.Identifiers,
+	}, messages
+}
+
+// validateStrictSchema returns the issues of fields that the syncer ignores (unknown or duplicate fields), which are
+// most likely typos.
+func validateStrictSchema(document []byte, object interface{}) []string {
+	if err := yaml.UnmarshalStrict(document, object); err != nil {
+		return []string{fmt.Sprintf("schema error - %s", err.Error())}
+	}
+
+	return nil
+}
+
+// validateLabelKeys returns the issues of label keys that would be dropped when assigned to managed clusters.
+func validateLabelKeys(labelKeys []string) []string {
+	messages := make([]string, 0)
+
+	for _, labelKey := range labelKeys {
+		if !db.LabelKeyIsAllowed(labelKey) {
+			messages = append(messages, fmt.Sprintf("label key '%s' is not allowed, only keys prefixed by %s or %s "+
+				"are assigned", labelKey, db.HubOfHubsGroup, db.ManagedClusterSetLabelKey))
+		}
+	}
+
+	return messages
+}
+
+// validateIdentifiers returns the issues of empty (identified or excluded) managed cluster names and of managed
+// clusters that are identified by name more than once (within the same or across identifiers of the same hub / hub
+// pattern). hubs that are not identified are reported as schema errors.
+func validateIdentifiers(identifiers []map[string]yamltypes.HubIdentifier) []string {
+	messages := make([]string, 0)
+	identifiedManagedClusters := make(map[string]struct{})
+
+	for identifierIndex, identifier := range identifiers {
+		for _, hubIdentifier := range identifier {
+			hubName := hubIdentifier.Name
+			if hubName == "" {
+				hubName = hubIdentifier.NamePattern
+			}
+
+			for _, managedClusterID := range hubIdentifier.ManagedClusterIDs {
+				if managedClusterID == "" {
+					messages = append(messages, fmt.Sprintf("identifier %d of hub '%s' has an empty managed cluster "+
+						"identifier", identifierIndex, hubName))
+
+					continue
+				}
+
+				managedCluster := fmt.Sprintf("%s/%s", hubName, managedClusterID)
+				if _, found := identifiedManagedClusters[managedCluster]; found {
+					messages = append(messages, fmt.Sprintf("managed cluster '%s' of hub '%s' is identified more "+
+						"than once", managedClusterID, hubName))
+
+					continue
+				}
+
+				identifiedManagedClusters[managedCluster] = struct{}{}
+			}
+
+			if hubIdentifier.Exclude == nil {
+				continue
+			}
+
+			for _, managedClusterID := range hubIdentifier.Exclude.ManagedClusterIDs {
+				if managedClusterID == "" {
+					messages = append(messages, fmt.Sprintf("identifier %d of hub '%s' has an empty excluded "+
+						"managed cluster identifier", identifierIndex, hubName))
+				}
+			}
+		}
+	}
+
+	return messages
+}
+
+// validateReferences returns the issues of objects that reference objects that are not defined in the validated files
+// (the syncer only resolves references within the same repo), or that reference themselves through a cycle.
+func validateReferences(objectIdentifierToLocationMap map[string]*objectLocation) []*Issue {
+	issues := make([]*Issue, 0)
+
+	objectIdentifiers := make([]string, 0, len(objectIdentifierToLocationMap))
+	for objectIdentifier := range objectIdentifierToLocationMap {
+		objectIdentifiers = append(objectIdentifiers, objectIdentifier)
+	}
+
+	sort.Strings(objectIdentifiers)
+
+	for _, objectIdentifier := range objectIdentifiers {
+		location := objectIdentifierToLocationMap[objectIdentifier]
+
+		newIssue := func(message string) *Issue {
+			return &Issue{FilePath: location.filePath, DocumentIndex: location.documentIndex,
+				Object: objectIdentifier, Message: message}
+		}
+
+		for _, reference := range location.references {
+			if _, found := objectIdentifierToLocationMap[reference]; !found {
+				issues = append(issues, newIssue(fmt.Sprintf("referenced object '%s' is not defined", reference)))
+			}
+		}
+
+		if cycle := findReferenceCycle(objectIdentifierToLocationMap, objectIdentifier,
+			[]string{objectIdentifier}); cycle != nil {
+			issues = append(issues, newIssue(fmt.Sprintf("object references itself through a cycle: %s",
+				strings.Join(cycle, " -> "))))
+		}
+	}
+
+	return issues
+}
+
+// validateLabelKeyCollisions returns the issues of ManagedClusterLabels objects that assign the label key of a
+// ManagedClustersGroup (the syncer rejects them, since the group removes its label from the managed clusters that it
+// does not identify).
+func validateLabelKeyCollisions(objectIdentifierToLocationMap map[string]*objectLocation) []*Issue {
+	issues := make([]*Issue, 0)
+	labelKeyToGroupMap := make(map[string]string)
+	objectIdentifiers := make([]string, 0, len(objectIdentifierToLocationMap))
+
+	for objectIdentifier, location := range objectIdentifierToLocationMap {
+		objectIdentifiers = append(objectIdentifiers, objectIdentifier)
+
+		if location.kind == yamltypes.ManagedClustersGroupKind {
+			for _, labelKey := range location.labelKeys {
+				labelKeyToGroupMap[labelKey] = objectIdentifier
+			}
+		}
+	}
+
+	sort.Strings(objectIdentifiers)
+
+	for _, objectIdentifier := range objectIdentifiers {
+		location := objectIdentifierToLocationMap[objectIdentifier]
+		if location.kind != yamltypes.ManagedClusterLabelsKind {
+			continue
+		}
+
+		for _, labelKey := range location.labelKeys {
+			if group, found := labelKeyToGroupMap[labelKey]; found {
+				issues = append(issues, &Issue{FilePath: location.filePath, DocumentIndex: location.documentIndex,
+					Object: objectIdentifier, Message: fmt.Sprintf("label key '%s' is assigned by %s", labelKey,
+						group)})
+			}
+		}
+	}
+
+	return issues
+}
+
+// findReferenceCycle returns the path of references from the last object of the given path back to the given object,
+// or nil if there is none.
+func findReferenceCycle(objectIdentifierToLocationMap map[string]*objectLocation, objectIdentifier string,
+	path []string,
+) []string {
+	location, found := objectIdentifierToLocationMap[path[len(path)-1]]
+	if !found {
+		return nil
+	}
+
+	for _, reference := range location.references {
+		if reference == objectIdentifier {
+			return append(path, reference)
+		}
+
+		visited := false
+
+		for _, pathObjectIdentifier := range path {
+			if pathObjectIdentifier == reference {
+				visited = true
+				break
+			}
+		}
+
+		if visited {
+			continue // a cycle that does not go through the object
+		}
+
+		if cycle := findReferenceCycle(objectIdentifierToLocationMap, objectIdentifier,
+			append(append(make([]string, 0, len(path)+1), path...), reference)); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
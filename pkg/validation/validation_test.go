@@ -0,0 +1,187 @@
+package validation
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/hub-of-hubs-nonk8s-gitops/pkg/controller/dbsyncer"
+)
+
+const (
+	testAWSGroup = `kind: ManagedClustersGroup
+metadata:
+  name: aws
+spec:
+  tagValue: 'true'
+  identifiers:
+  - hubIdentifier:
+      name: hub1
+      managedClusterIdentifiers:
+      - cluster1
+`
+	testGoldLabels = `kind: ManagedClusterLabels
+metadata:
+  name: gold
+spec:
+  labels:
+    hub-of-hubs.open-cluster-management.io/tier: gold
+  identifiers:
+  - hubIdentifier:
+      name: hub1
+      managedClusterIdentifiers:
+      - cluster1
+`
+)
+
+// newTestComposedGroup returns a document of a group that is composed of the given groups.
+func newTestComposedGroup(name string, groups ...string) string {
+	return `kind: ManagedClustersGroup
+metadata:
+  name: ` + name + `
+spec:
+  tagValue: 'true'
+  composition:
+    operator: union
+    groups: [` + strings.Join(groups, ", ") + `]
+`
+}
+
+// expectedIssue is an issue that is expected to be found, matched by its location and a substring of its message.
+type expectedIssue struct {
+	filePath      string
+	documentIndex int
+	object        string
+	message       string
+}
+
+func TestValidateDirectory(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		files          map[string]string
+		expectedIssues []expectedIssue
+	}{
+		{
+			name:  "valid objects",
+			files: map[string]string{"groups.yaml": testAWSGroup, "labels.yaml": testGoldLabels},
+		},
+		{
+			name:  "schema error",
+			files: map[string]string{"groups.yaml": strings.Replace(testAWSGroup, "tagValue", "tagValu", 1)},
+			expectedIssues: []expectedIssue{
+				{filePath: "groups.yaml", object: "ManagedClustersGroup/aws", message: "schema error"},
+			},
+		},
+		{
+			name: "unsupported kind",
+			files: map[string]string{"groups.yaml": testAWSGroup + "---\n" +
+				strings.Replace(testAWSGroup, "ManagedClustersGroup", "Group", 1)},
+			expectedIssues: []expectedIssue{
+				{filePath: "groups.yaml", documentIndex: 1, message: "kind 'Group' is not supported"},
+			},
+		},
+		{
+			name: "disallowed label key",
+			files: map[string]string{
+				"labels.yaml": strings.Replace(testGoldLabels, "hub-of-hubs.open-cluster-management.io/tier", "tier", 1),
+			},
+			expectedIssues: []expectedIssue{
+				{filePath: "labels.yaml", object: "ManagedClusterLabels/gold", message: "label key is not allowed: tier"},
+			},
+		},
+		{
+			name:  "duplicate name",
+			files: map[string]string{"groups.yaml": testAWSGroup, "more-groups.yaml": testAWSGroup},
+			expectedIssues: []expectedIssue{
+				{
+					filePath: "more-groups.yaml",
+					object:   "ManagedClustersGroup/aws",
+					message:  "duplicate name, object is already defined in groups.yaml (document 0)",
+				},
+			},
+		},
+		{
+			name:  "undefined reference",
+			files: map[string]string{"groups.yaml": newTestComposedGroup("all", "aws", "gcp") + "---\n" + testAWSGroup},
+			expectedIssues: []expectedIssue{
+				{
+					filePath: "groups.yaml",
+					object:   "ManagedClustersGroup/all",
+					message:  "referenced object 'ManagedClustersGroup/gcp' is not defined",
+				},
+			},
+		},
+		{
+			name: "reference cycle",
+			files: map[string]string{
+				"groups.yaml": newTestComposedGroup("a", "b") + "---\n" + newTestComposedGroup("b", "a"),
+			},
+			expectedIssues: []expectedIssue{
+				{
+					filePath: "groups.yaml",
+					object:   "ManagedClustersGroup/a",
+					message: "object references itself through a cycle: ManagedClustersGroup/a -> " +
+						"ManagedClustersGroup/b -> ManagedClustersGroup/a",
+				},
+				{
+					filePath:      "groups.yaml",
+					documentIndex: 1,
+					object:        "ManagedClustersGroup/b",
+					message: "object references itself through a cycle: ManagedClustersGroup/b -> " +
+						"ManagedClustersGroup/a -> ManagedClustersGroup/b",
+				},
+			},
+		},
+		{
+			name: "label key collision",
+			files: map[string]string{
+				"groups.yaml": testAWSGroup,
+				"labels.yaml": strings.Replace(testGoldLabels, "/tier", "/aws", 1),
+			},
+			expectedIssues: []expectedIssue{
+				{
+					filePath: "labels.yaml",
+					object:   "ManagedClusterLabels/gold",
+					message: "label key 'hub-of-hubs.open-cluster-management.io/aws' is assigned by " +
+						"ManagedClustersGroup/aws",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dirPath := t.TempDir()
+
+			for filePath, contents := range test.files {
+				if err := ioutil.WriteFile(filepath.Join(dirPath, filePath), []byte(contents), 0o600); err != nil {
+					t.Fatalf("failed to write file %s - %v", filePath, err)
+				}
+			}
+
+			issues, err := ValidateDirectory(dirPath, &dbsyncer.WorkPath{})
+			if err != nil {
+				t.Fatalf("failed to validate directory - %v", err)
+			}
+
+			if len(issues) != len(test.expectedIssues) {
+				t.Fatalf("expected %d issues, got %v", len(test.expectedIssues), issues)
+			}
+
+			for i, expected := range test.expectedIssues {
+				issue := issues[i]
+				if issue.FilePath != expected.filePath || issue.DocumentIndex != expected.documentIndex ||
+					issue.Object != expected.object || !strings.Contains(issue.Message, expected.message) {
+					t.Fatalf("expected issue %+v, got %s", expected, issue.String())
+				}
+			}
+		})
+	}
+}